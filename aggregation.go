@@ -0,0 +1,266 @@
+package elsearm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Aggregations is the results of aggregations. The key is a name of the aggregation.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations.html
+type Aggregations map[string]json.RawMessage
+
+// BucketsAggregation is a result of the bucket aggregations which returns multiple buckets.
+// For example, terms, date_histogram, histogram, range and filters.
+type BucketsAggregation struct {
+	Buckets []Bucket
+	// An upper bound of the error on the document counts. It is available only for the terms aggregation.
+	DocCountErrorUpperBound int
+	// A count of documents that are not included in the buckets. It is available only for the terms aggregation.
+	SumOtherDocCount int
+}
+
+// Bucket is a bucket of the BucketsAggregation.
+type Bucket struct {
+	// A key of the bucket. The type of value is string or float64.
+	Key         interface{}
+	KeyAsString string
+	DocCount    int
+	// A range of the bucket. It is available only for the range aggregation.
+	From         *float64
+	To           *float64
+	FromAsString string
+	ToAsString   string
+	// Results of the sub-aggregations.
+	Aggregations Aggregations
+}
+
+// SingleBucketAggregation is a result of the bucket aggregations which returns a single bucket.
+// For example, nested.
+type SingleBucketAggregation struct {
+	DocCount int
+	// Results of the sub-aggregations.
+	Aggregations Aggregations
+}
+
+// MetricAggregation is a result of the metrics aggregations which returns a single value.
+// For example, avg, sum, min, max and cardinality.
+type MetricAggregation struct {
+	// A value of the metric. It is nil when there are no documents to compute.
+	Value         *float64 `json:"value"`
+	ValueAsString string   `json:"value_as_string"`
+}
+
+// PercentilesAggregation is a result of the percentiles aggregation.
+type PercentilesAggregation struct {
+	// Values of the percentiles. The key is a percent. For example, "99.0".
+	Values map[string]*float64 `json:"values"`
+}
+
+// TopHitsAggregation is a result of the top_hits aggregation.
+type TopHitsAggregation struct {
+	res SearchResponse
+}
+
+// Terms returns a result of the terms aggregation.
+func (aggs Aggregations) Terms(name string) (*BucketsAggregation, error) {
+	return aggs.buckets(name)
+}
+
+// DateHistogram returns a result of the date_histogram aggregation.
+func (aggs Aggregations) DateHistogram(name string) (*BucketsAggregation, error) {
+	return aggs.buckets(name)
+}
+
+// Histogram returns a result of the histogram aggregation.
+func (aggs Aggregations) Histogram(name string) (*BucketsAggregation, error) {
+	return aggs.buckets(name)
+}
+
+// Range returns a result of the range aggregation.
+func (aggs Aggregations) Range(name string) (*BucketsAggregation, error) {
+	return aggs.buckets(name)
+}
+
+// Filters returns a result of the filters aggregation.
+// The key of each bucket is a name of the filter.
+func (aggs Aggregations) Filters(name string) (*BucketsAggregation, error) {
+	return aggs.buckets(name)
+}
+
+// Nested returns a result of the nested aggregation.
+func (aggs Aggregations) Nested(name string) (*SingleBucketAggregation, error) {
+	var agg SingleBucketAggregation
+	if err := aggs.decode(name, &agg); err != nil {
+		return nil, err
+	}
+	return &agg, nil
+}
+
+// Avg returns a result of the avg aggregation.
+func (aggs Aggregations) Avg(name string) (*MetricAggregation, error) {
+	return aggs.metric(name)
+}
+
+// Sum returns a result of the sum aggregation.
+func (aggs Aggregations) Sum(name string) (*MetricAggregation, error) {
+	return aggs.metric(name)
+}
+
+// Min returns a result of the min aggregation.
+func (aggs Aggregations) Min(name string) (*MetricAggregation, error) {
+	return aggs.metric(name)
+}
+
+// Max returns a result of the max aggregation.
+func (aggs Aggregations) Max(name string) (*MetricAggregation, error) {
+	return aggs.metric(name)
+}
+
+// Cardinality returns a result of the cardinality aggregation.
+func (aggs Aggregations) Cardinality(name string) (*MetricAggregation, error) {
+	return aggs.metric(name)
+}
+
+// Percentiles returns a result of the percentiles aggregation.
+func (aggs Aggregations) Percentiles(name string) (*PercentilesAggregation, error) {
+	var agg PercentilesAggregation
+	if err := aggs.decode(name, &agg); err != nil {
+		return nil, err
+	}
+	return &agg, nil
+}
+
+// TopHits returns a result of the top_hits aggregation.
+func (aggs Aggregations) TopHits(name string) (*TopHitsAggregation, error) {
+	var agg TopHitsAggregation
+	if err := aggs.decode(name, &agg.res); err != nil {
+		return nil, err
+	}
+	return &agg, nil
+}
+
+func (aggs Aggregations) buckets(name string) (*BucketsAggregation, error) {
+	var agg BucketsAggregation
+	if err := aggs.decode(name, &agg); err != nil {
+		return nil, err
+	}
+	return &agg, nil
+}
+
+func (aggs Aggregations) metric(name string) (*MetricAggregation, error) {
+	var agg MetricAggregation
+	if err := aggs.decode(name, &agg); err != nil {
+		return nil, err
+	}
+	return &agg, nil
+}
+
+func (aggs Aggregations) decode(name string, v interface{}) error {
+	raw, ok := aggs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAggregationNotFound, name)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// UnmarshalJSON parses the buckets. The keyed buckets are converted to a list in the order of the response.
+func (agg *BucketsAggregation) UnmarshalJSON(data []byte) error {
+	var res struct {
+		Buckets                 json.RawMessage `json:"buckets"`
+		DocCountErrorUpperBound int             `json:"doc_count_error_upper_bound"`
+		SumOtherDocCount        int             `json:"sum_other_doc_count"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+
+	agg.DocCountErrorUpperBound = res.DocCountErrorUpperBound
+	agg.SumOtherDocCount = res.SumOtherDocCount
+	agg.Buckets = []Bucket{}
+
+	raw := bytes.TrimSpace(res.Buckets)
+	if len(raw) == 0 || raw[0] != '{' {
+		if len(raw) == 0 {
+			return nil
+		}
+		return json.Unmarshal(raw, &agg.Buckets)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var bucket Bucket
+		if err := dec.Decode(&bucket); err != nil {
+			return err
+		}
+		if bucket.Key == nil {
+			bucket.Key = token
+		}
+		agg.Buckets = append(agg.Buckets, bucket)
+	}
+	return nil
+}
+
+// UnmarshalJSON parses the bucket. The fields except the known keys are treated as sub-aggregations.
+func (b *Bucket) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	knownFields := []struct {
+		name string
+		v    interface{}
+	}{
+		{"key", &b.Key},
+		{"key_as_string", &b.KeyAsString},
+		{"doc_count", &b.DocCount},
+		{"from", &b.From},
+		{"to", &b.To},
+		{"from_as_string", &b.FromAsString},
+		{"to_as_string", &b.ToAsString},
+	}
+	for _, f := range knownFields {
+		if raw, ok := fields[f.name]; ok {
+			if err := json.Unmarshal(raw, f.v); err != nil {
+				return err
+			}
+			delete(fields, f.name)
+		}
+	}
+	b.Aggregations = Aggregations(fields)
+	return nil
+}
+
+// UnmarshalJSON parses the bucket. The fields except doc_count are treated as sub-aggregations.
+func (agg *SingleBucketAggregation) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if raw, ok := fields["doc_count"]; ok {
+		if err := json.Unmarshal(raw, &agg.DocCount); err != nil {
+			return err
+		}
+		delete(fields, "doc_count")
+	}
+	agg.Aggregations = Aggregations(fields)
+	return nil
+}
+
+// Total returns the total number of hits.
+func (agg *TopHitsAggregation) Total() int {
+	return agg.res.Hits.Total.Value
+}
+
+// SetResult copies the hits to models.
+func (agg *TopHitsAggregation) SetResult(models interface{}) error {
+	return agg.res.SetResult(models)
+}
@@ -0,0 +1,151 @@
+package elsearm
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestAggregations(t *testing.T) {
+	str := `{
+		"hits": {
+			"total": { "value": 3, "relation": "eq" },
+			"hits": []
+		},
+		"aggregations": {
+			"teams": {
+				"doc_count_error_upper_bound": 0,
+				"sum_other_doc_count": 1,
+				"buckets": [
+					{ "key": "a", "doc_count": 2, "avg_age": { "value": 25.5 } },
+					{ "key": "b", "doc_count": 1, "avg_age": { "value": null } }
+				]
+			},
+			"created": {
+				"buckets": [
+					{ "key_as_string": "2020-01-01", "key": 1577836800000, "doc_count": 3 }
+				]
+			},
+			"ages": {
+				"buckets": [
+					{ "key": "*-20.0", "to": 20.0, "doc_count": 1 },
+					{ "key": "20.0-*", "from": 20.0, "doc_count": 2 }
+				]
+			},
+			"names": {
+				"buckets": {
+					"bob": { "doc_count": 1 },
+					"alice": { "doc_count": 2 }
+				}
+			},
+			"members": {
+				"doc_count": 5,
+				"member_names": {
+					"buckets": [ { "key": "Alice", "doc_count": 5 } ]
+				}
+			},
+			"percentiles": {
+				"values": { "50.0": 20.0, "99.0": 30.0 }
+			},
+			"latest": {
+				"hits": {
+					"total": { "value": 3, "relation": "eq" },
+					"hits": [
+						{ "_id": "1", "_source": { "id": 1, "name": "Alice" } }
+					]
+				}
+			}
+		}
+	}`
+	var res SearchResponse
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	teams, err := res.Aggregations.Terms("teams")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(teams.Buckets) != 2 || teams.SumOtherDocCount != 1 ||
+		teams.Buckets[0].Key != "a" || teams.Buckets[0].DocCount != 2 {
+		t.Errorf("invalid terms: got %#v", teams)
+	}
+	avg, err := teams.Buckets[0].Aggregations.Avg("avg_age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avg.Value == nil || *avg.Value != 25.5 {
+		t.Errorf("invalid avg: got %#v", avg)
+	}
+	avg, err = teams.Buckets[1].Aggregations.Avg("avg_age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avg.Value != nil {
+		t.Errorf("invalid avg: got %#v", avg)
+	}
+
+	created, err := res.Aggregations.DateHistogram("created")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created.Buckets) != 1 || created.Buckets[0].KeyAsString != "2020-01-01" ||
+		created.Buckets[0].Key != float64(1577836800000) {
+		t.Errorf("invalid date_histogram: got %#v", created)
+	}
+
+	ages, err := res.Aggregations.Range("ages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ages.Buckets) != 2 || ages.Buckets[0].From != nil || *ages.Buckets[0].To != 20 ||
+		*ages.Buckets[1].From != 20 || ages.Buckets[1].To != nil {
+		t.Errorf("invalid range: got %#v", ages)
+	}
+
+	names, err := res.Aggregations.Filters("names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names.Buckets) != 2 ||
+		names.Buckets[0].Key != "bob" || names.Buckets[0].DocCount != 1 ||
+		names.Buckets[1].Key != "alice" || names.Buckets[1].DocCount != 2 {
+		t.Errorf("invalid filters: got %#v", names)
+	}
+
+	members, err := res.Aggregations.Nested("members")
+	if err != nil {
+		t.Fatal(err)
+	}
+	memberNames, err := members.Aggregations.Terms("member_names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if members.DocCount != 5 || len(memberNames.Buckets) != 1 {
+		t.Errorf("invalid nested: got %#v", members)
+	}
+
+	percentiles, err := res.Aggregations.Percentiles("percentiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := percentiles.Values["99.0"]; p == nil || *p != 30 {
+		t.Errorf("invalid percentiles: got %#v", percentiles)
+	}
+
+	latest, err := res.Aggregations.TopHits("latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []User
+	if err := latest.SetResult(&users); err != nil {
+		t.Fatal(err)
+	}
+	if latest.Total() != 3 || len(users) != 1 || users[0].Name != "Alice" {
+		t.Errorf("invalid top_hits: got %#v", users)
+	}
+
+	if _, err := res.Aggregations.Terms("unknown"); !errors.Is(err, ErrAggregationNotFound) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
@@ -1,45 +1,166 @@
 package elsearm
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/elastic/go-elasticsearch/v7/esutil"
 )
 
 // BulkIndexer provides functions to bulk insert/update document in Elasticsearch.
 type BulkIndexer struct {
-	bulk esutil.BulkIndexer
-	ctx  context.Context
+	bulk        esutil.BulkIndexer
+	ctx         context.Context
+	cfg         *Config
+	onFailure   func(ctx context.Context, err *BulkItemError)
+	deadLetters DeadLetterSink
+	observer    Observer
+	retry       *RetryPolicy
+	state       *bulkState
 }
 
-// NewIndexer creates an Indexer.
+// bulkState is shared by the copies of BulkIndexer to stop the retries on Close.
+type bulkState struct {
+	mu      sync.Mutex
+	closing bool
+	closed  chan struct{}
+	retries sync.WaitGroup
+}
+
+// BulkItemError is an error of the item of BulkIndexer, which has the original model.
+type BulkItemError struct {
+	// A model which was added to the BulkIndexer.
+	Model interface{}
+	// An action of the item. (e.g. index, update and delete)
+	Action string
+	// An *ErrorResponse if Elasticsearch failed the item, otherwise an error of the bulk request.
+	Err error
+	// An error if the item could not be stored to the DeadLetterSink. It is nil if the item was stored, or if it was not a dead letter.
+	DeadLetterErr error
+}
+
+func (err *BulkItemError) Error() string {
+	return fmt.Sprintf("failed to %s %T: %s", err.Action, err.Model, err.Err)
+}
+
+// Unwrap returns the cause of the error.
+func (err *BulkItemError) Unwrap() error {
+	return err.Err
+}
+
+// NewBulkIndexer creates a BulkIndexer which adds the items to the esutil.BulkIndexer.
+// Use NewBulkIndexerFromConfig to handle the items of the bulk requests which fail as a whole.
 func NewBulkIndexer(bulk esutil.BulkIndexer) *BulkIndexer {
 	return &BulkIndexer{
-		bulk: bulk,
-		ctx:  context.Background(),
+		bulk:  bulk,
+		ctx:   context.Background(),
+		state: &bulkState{closed: make(chan struct{})},
 	}
 }
 
 // WithContext specifies a context to use and returns a new BulkIndexer.
 func (indexer *BulkIndexer) WithContext(ctx context.Context) *BulkIndexer {
-	return &BulkIndexer{
-		bulk: indexer.bulk,
-		ctx:  ctx,
+	newIndexer := *indexer
+	newIndexer.ctx = ctx
+	return &newIndexer
+}
+
+// WithConfig specifies a config to use instead of GlobalConfig and returns a new BulkIndexer.
+func (indexer *BulkIndexer) WithConfig(cfg Config) *BulkIndexer {
+	newIndexer := *indexer
+	newIndexer.cfg = &cfg
+	return &newIndexer
+}
+
+// WithFailureHandler specifies a function which is called with the error of each failed item, and returns a new BulkIndexer.
+// It is called on the goroutine of the worker of esutil.BulkIndexer, so it should not block for a long time.
+// When the whole bulk request fails, the BulkIndexer created by NewBulkIndexerFromConfig calls it with all items of the request,
+// but the one created by NewBulkIndexer can not, since esutil.BulkIndexer passes the error only to its OnError.
+// If the BulkIndexer has a RetryPolicy, it is not called for the delete item of the document which does not exist.
+func (indexer *BulkIndexer) WithFailureHandler(f func(ctx context.Context, err *BulkItemError)) *BulkIndexer {
+	newIndexer := *indexer
+	newIndexer.onFailure = f
+	return &newIndexer
+}
+
+// WithErrorChannel specifies a channel which receives the error of each failed item, and returns a new BulkIndexer.
+// The error is dropped when the channel is full, so that the worker is not blocked. The channel should be buffered.
+func (indexer *BulkIndexer) WithErrorChannel(ch chan<- *BulkItemError) *BulkIndexer {
+	return indexer.WithFailureHandler(func(ctx context.Context, err *BulkItemError) {
+		select {
+		case ch <- err:
+		default:
+		}
+	})
+}
+
+// WithRetryPolicy specifies a policy to retry the failed items and returns a new BulkIndexer.
+// By default, the items are not retried.
+// When the whole bulk request fails, the items which are not idempotent are not retried unless the status is 429 or RetryNonIdempotent is true.
+// ShouldRetry of the policy is not called for the items, since they have no request and response of their own.
+// Use Close instead of closing the esutil.BulkIndexer, otherwise the items may be added to it after it is closed.
+func (indexer *BulkIndexer) WithRetryPolicy(policy RetryPolicy) *BulkIndexer {
+	newIndexer := *indexer
+	newIndexer.retry = &policy
+	return &newIndexer
+}
+
+// Close flushes the remaining items and closes the esutil.BulkIndexer.
+// The items waiting for the retry are passed to the failure handler with the last failure, and the items which fail during Close are not retried.
+// The BulkIndexer and its copies can not be used after Close.
+func (indexer *BulkIndexer) Close(ctx context.Context) error {
+	state := indexer.state
+	state.mu.Lock()
+	if !state.closing {
+		state.closing = true
+		close(state.closed)
 	}
+	state.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		state.retries.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return indexer.bulk.Close(ctx)
+}
+
+// Stats returns the statistics of the esutil.BulkIndexer.
+func (indexer *BulkIndexer) Stats() esutil.BulkIndexerStats {
+	return indexer.bulk.Stats()
+}
+
+// IndexName returns an index name of the model, which is resolved by the config of the BulkIndexer.
+func (indexer *BulkIndexer) IndexName(model interface{}) string {
+	return indexer.config().IndexName(model)
 }
 
 // CreateWithoutID create a document in index without DocumentID.
 // Returns an error if the addition to the bulk indexer fails.
+// The generated DocumentID is set to the model when the item is flushed, if the model implements AutomaticIDModel.
 func (indexer *BulkIndexer) CreateWithoutID(model interface{}) error {
-	assertModel(model)
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
 
 	reader, err := DocumentBody(model)
 	if err != nil {
 		return err
 	}
 
-	return indexer.bulk.Add(indexer.ctx, esutil.BulkIndexerItem{
-		Index:  IndexName(model),
+	return indexer.add(model, esutil.BulkIndexerItem{
+		Index:  indexer.IndexName(model),
 		Action: "index",
 		Body:   reader,
 	})
@@ -47,8 +168,16 @@ func (indexer *BulkIndexer) CreateWithoutID(model interface{}) error {
 
 // Update (or create) the document in index.
 // Returns an error if the addition to the bulk indexer fails.
+// If the model has an external version, the item fails with ErrVersionConflict when the document has the same or newer version.
 func (indexer *BulkIndexer) Update(model interface{}) error {
-	assertModel(model)
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
+
+	version, hasVersion, err := ExternalVersion(model)
+	if err != nil {
+		return err
+	}
 
 	reader, err := DocumentBody(model)
 	if err != nil {
@@ -60,27 +189,205 @@ func (indexer *BulkIndexer) Update(model interface{}) error {
 		return err
 	}
 
-	return indexer.bulk.Add(indexer.ctx, esutil.BulkIndexerItem{
-		Index:      IndexName(model),
+	item := esutil.BulkIndexerItem{
+		Index:      indexer.IndexName(model),
 		DocumentID: documentId,
 		Action:     "index",
 		Body:       reader,
-	})
+	}
+	if hasVersion {
+		item.Version = &version
+		item.VersionType = "external"
+	}
+	return indexer.add(model, item)
 }
 
 // Delete a document from Index.
 // Returns an error if the addition to the bulk indexer fails.
 func (indexer *BulkIndexer) Delete(model interface{}) error {
-	assertModel(model)
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
 
 	documentId, err := DocumentID(model)
 	if err != nil {
 		return err
 	}
 
-	return indexer.bulk.Add(indexer.ctx, esutil.BulkIndexerItem{
-		Index:      IndexName(model),
+	return indexer.add(model, esutil.BulkIndexerItem{
+		Index:      indexer.IndexName(model),
 		DocumentID: documentId,
 		Action:     "delete",
 	})
 }
+
+// add adds the item of the model. When the item is flushed, the result is reflected to the model,
+// and the failure is passed to the failure handler.
+func (indexer *BulkIndexer) add(model interface{}, item esutil.BulkIndexerItem) error {
+	return indexer.addItem(model, item, isIdempotentItem(item))
+}
+
+// addItem adds the item in the same way as add. If idempotent is false, the item is not retried when the whole bulk request fails.
+func (indexer *BulkIndexer) addItem(model interface{}, item esutil.BulkIndexerItem, idempotent bool) error {
+	item.OnSuccess = func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
+		// NOTE: the error can not be returned from the callback, and SetDocumentID of AutomaticIDModel usually does not fail.
+		if item.DocumentID == "" && res.DocumentID != "" {
+			_ = SetDocumentID(model, res.DocumentID)
+		}
+		seqNo, primaryTerm, version := res.SeqNo, res.PrimTerm, res.Version
+		SetDocumentVersion(model, newDocumentVersion(&seqNo, &primaryTerm, &version))
+	}
+	ignoreStale := item.Version != nil && indexer.config().IgnoreStaleVersions
+	if onFailure, sink := indexer.onFailure, indexer.deadLetters; onFailure != nil || sink != nil {
+		item.OnFailure = func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+			if err == nil {
+				errRes := bulkResponseError(res)
+				if ignoreStale && errRes.Is(ErrVersionConflict) {
+					return
+				}
+				err = errRes
+			}
+			itemErr := &BulkItemError{Model: model, Action: item.Action, Err: err}
+			// NOTE: the document has been changed by others, so the item should not be replayed.
+			if sink != nil && !errors.Is(err, ErrVersionConflict) {
+				letter, letterErr := newDeadLetter(item, res.Status, err)
+				if letterErr == nil {
+					letterErr = sink.Write(ctx, letter)
+				}
+				itemErr.DeadLetterErr = letterErr
+			}
+			if onFailure != nil {
+				onFailure(ctx, itemErr)
+			}
+		}
+	}
+
+	if observer := indexer.observer; observer != nil {
+		var (
+			abort func(err error)
+			err   error
+		)
+		if item, abort, err = observeBulkItem(indexer.ctx, observer, item); err != nil {
+			return err
+		}
+		if err := indexer.bulk.Add(indexer.ctx, indexer.retryItem(item, idempotent)); err != nil {
+			abort(err)
+			return err
+		}
+		return nil
+	}
+	return indexer.bulk.Add(indexer.ctx, indexer.retryItem(item, idempotent))
+}
+
+// retryItem wraps the OnFailure of the item to add it again after the backoff, when it fails with a retryable error and the BulkIndexer has a RetryPolicy.
+// The OnFailure of the item is called when it fails with other errors, the retries run out or the BulkIndexer is closed.
+// With a RetryPolicy, the delete item of the document which does not exist is regarded as succeeded, since it may have been deleted by the previous attempt.
+func (indexer *BulkIndexer) retryItem(item esutil.BulkIndexerItem, idempotent bool) esutil.BulkIndexerItem {
+	policy, state := indexer.retryPolicy(), indexer.state
+	onSuccess, onFailure := item.OnSuccess, item.OnFailure
+	fail := func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+		if onFailure != nil {
+			onFailure(ctx, item, res, err)
+		}
+	}
+
+	attempt := 1
+	retried := item
+	retried.OnFailure = func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+		if policy != nil && err == nil && item.Action == "delete" && res.Status == http.StatusNotFound {
+			if onSuccess != nil {
+				onSuccess(ctx, item, res)
+			}
+			return
+		}
+		if policy == nil || attempt >= policy.maxAttempts() || !policy.canRetryItem(idempotent, res.Status, err) || !state.startRetry() {
+			fail(ctx, item, res, err)
+			return
+		}
+
+		var body []byte
+		if item.Body != nil {
+			b, readErr := ioutil.ReadAll(item.Body)
+			if readErr != nil {
+				state.retries.Done()
+				fail(ctx, item, res, err)
+				return
+			}
+			body = b
+		}
+		withBody := func(item esutil.BulkIndexerItem) esutil.BulkIndexerItem {
+			if body != nil {
+				item.Body = bytes.NewReader(body)
+			}
+			return item
+		}
+
+		wait := policy.backoff(attempt)
+		attempt++
+		go func() {
+			defer state.retries.Done()
+
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				if state.addRetry(indexer.ctx, indexer.bulk, withBody(retried)) {
+					return
+				}
+			case <-indexer.ctx.Done():
+			case <-state.closed:
+			}
+			// NOTE: the item could not be added again, so it is reported with the last failure.
+			fail(ctx, withBody(item), res, err)
+		}()
+	}
+	return retried
+}
+
+// retryPolicy returns the RetryPolicy of the BulkIndexer, or nil if the items should not be retried.
+func (indexer *BulkIndexer) retryPolicy() *RetryPolicy {
+	return indexer.retry
+}
+
+// startRetry registers a retry of an item, and returns false if the BulkIndexer is closing.
+func (state *bulkState) startRetry() bool {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.closing {
+		return false
+	}
+	state.retries.Add(1)
+	return true
+}
+
+// addRetry adds the retried item to the esutil.BulkIndexer, and returns false if the BulkIndexer is closing or the addition fails.
+// NOTE: esutil.BulkIndexer panics when the item is added after it is closed.
+func (state *bulkState) addRetry(ctx context.Context, bulk esutil.BulkIndexer, item esutil.BulkIndexerItem) bool {
+	state.mu.Lock()
+	closing := state.closing
+	state.mu.Unlock()
+	if closing {
+		return false
+	}
+	return bulk.Add(ctx, item) == nil
+}
+
+func (indexer *BulkIndexer) config() *Config {
+	if indexer.cfg != nil {
+		return indexer.cfg
+	}
+	return getGlobalConfig()
+}
+
+func bulkResponseError(res esutil.BulkIndexerResponseItem) *ErrorResponse {
+	errRes := &ErrorResponse{Status: uint(res.Status), documentNotFound: res.Result == "not_found"}
+	errRes.Err.Type = res.Error.Type
+	errRes.Err.Reason = res.Error.Reason
+	errRes.Err.CausedBy.Type = res.Error.Cause.Type
+	errRes.Err.CausedBy.Reason = res.Error.Cause.Reason
+	if errRes.Err.Reason == "" {
+		// NOTE: the item of delete has no error when the document is not found.
+		errRes.Err.Reason = http.StatusText(res.Status)
+	}
+	return errRes
+}
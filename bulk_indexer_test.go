@@ -1,26 +1,36 @@
 package elsearm
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
 	"testing"
 	"time"
 
-	elasticsearch "github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esutil"
 )
 
 var bulkIndexer *BulkIndexer
 
+const bulkFlushInterval = 50 * time.Millisecond
+
+// waitForBulkFlush waits until the items added to bulkIndexer are flushed.
+func waitForBulkFlush() {
+	time.Sleep(2 * bulkFlushInterval)
+}
+
 func init() {
-	esClient, err := elasticsearch.NewDefaultClient()
-	if err != nil {
-		panic("failed to create elasticsearch client")
-	}
+	esClient := newTestClient()
 	indexer = NewIndexer(esClient)
 	bulk, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
 		NumWorkers:    1,
 		Client:        esClient,
-		FlushInterval: 50 * time.Millisecond,
+		FlushInterval: bulkFlushInterval,
 	})
+	if err != nil {
+		panic("failed to create bulk indexer")
+	}
 	bulkIndexer = NewBulkIndexer(bulk)
 }
 
@@ -32,6 +42,7 @@ func TestBulkIndexerCreateWithoutID(t *testing.T) {
 	if err := bulkIndexer.CreateWithoutID(user); err != nil {
 		t.Error(err)
 	}
+	waitForBulkFlush()
 }
 
 func TestBulkIndexerUpdate(t *testing.T) {
@@ -42,7 +53,9 @@ func TestBulkIndexerUpdate(t *testing.T) {
 	if err := bulkIndexer.Update(user); err != nil {
 		t.Error(err)
 	}
+	waitForBulkFlush()
 }
+
 func TestBulkIndexerDelete(t *testing.T) {
 	if err := indexer.CreateIndexIfNotExist(&User{}); err != nil {
 		t.Error(err)
@@ -54,8 +67,205 @@ func TestBulkIndexerDelete(t *testing.T) {
 	if err := bulkIndexer.Delete(user); err != nil {
 		t.Error(err)
 	}
+	waitForBulkFlush()
 	user = &User{ID: 1}
 	if err := indexer.Get(user); err == nil {
 		t.Errorf("Get should fail but succeeded")
 	}
 }
+
+// newClosableBulkIndexer returns a BulkIndexer and a function that flushes the items and waits for the callbacks.
+func newClosableBulkIndexer(t *testing.T) (*BulkIndexer, func()) {
+	t.Helper()
+	bulk, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		NumWorkers: 1,
+		Client:     newTestClient(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bulkIndexer := NewBulkIndexer(bulk)
+	return bulkIndexer, func() {
+		if err := bulkIndexer.Close(context.Background()); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestBulkIndexer_mapResults(t *testing.T) {
+	if err := indexer.CreateIndexIfNotExist(&Organization{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.CreateIndexIfNotExist(&Wallet{}); err != nil {
+		t.Fatal(err)
+	}
+	bulkIndexer, closeBulk := newClosableBulkIndexer(t)
+
+	org := &Organization{Name: "Doodle"}
+	if err := bulkIndexer.CreateWithoutID(org); err != nil {
+		t.Fatal(err)
+	}
+	wallet := &Wallet{ID: 1, Balance: 100}
+	if err := bulkIndexer.Update(wallet); err != nil {
+		t.Fatal(err)
+	}
+	closeBulk()
+
+	if org.ID == nil || *org.ID == "" {
+		t.Errorf("the generated id should be set: got %#v", org)
+	}
+	if wallet.IsZero() || wallet.Version == 0 {
+		t.Errorf("the version should be set: got %#v", wallet.DocumentVersion)
+	}
+}
+
+func TestBulkIndexer_failures(t *testing.T) {
+	if err := indexer.CreateIndexIfNotExist(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	_ = indexer.Delete(&User{ID: 100})
+	bulk, closeBulk := newClosableBulkIndexer(t)
+
+	var (
+		mu     sync.Mutex
+		failed []*BulkItemError
+	)
+	bulkIndexer := bulk.WithFailureHandler(func(ctx context.Context, err *BulkItemError) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, err)
+	})
+
+	user := &User{ID: 100}
+	if err := bulkIndexer.PartialUpdate(user, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := bulkIndexer.Update(&User{ID: 101, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	closeBulk()
+
+	if len(failed) != 1 || failed[0].Model != user || failed[0].Action != "update" {
+		t.Fatalf("invalid failures: got %#v", failed)
+	}
+	if !errors.Is(failed[0], ErrDocumentNotFound) {
+		t.Errorf("invalid error: got %#v", failed[0].Err)
+	}
+}
+
+func TestBulkIndexer_errorChannel(t *testing.T) {
+	if err := indexer.CreateIndexIfNotExist(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	_ = indexer.Delete(&User{ID: 100})
+	bulk, closeBulk := newClosableBulkIndexer(t)
+
+	ch := make(chan *BulkItemError, 1)
+	bulkIndexer := bulk.WithErrorChannel(ch)
+
+	user := &User{ID: 100, Name: "Bob"}
+	if err := bulkIndexer.PartialUpdate(user, []string{"name"}); err != nil {
+		t.Fatal(err)
+	}
+	closeBulk()
+
+	select {
+	case err := <-ch:
+		if err.Model != user || !errors.Is(err, ErrDocumentNotFound) {
+			t.Errorf("invalid error: got %#v", err)
+		}
+	default:
+		t.Error("the error should be sent to the channel")
+	}
+}
+
+// newStubBulkIndexer returns a BulkIndexer created by NewBulkIndexerFromConfig, which sends the bulk requests to a stubTransport.
+func newStubBulkIndexer(t *testing.T, responses ...stubResponse) *BulkIndexer {
+	t.Helper()
+	_, client := newStubClient(t, responses...)
+	bulkIndexer, err := NewBulkIndexerFromConfig(esutil.BulkIndexerConfig{NumWorkers: 1, Client: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bulkIndexer
+}
+
+func TestBulkIndexer_requestFailures(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		failed []*BulkItemError
+	)
+	bulkIndexer := newStubBulkIndexer(t, unavailable).
+		WithFailureHandler(func(ctx context.Context, err *BulkItemError) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, err)
+		})
+
+	users := []*User{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	for _, user := range users {
+		if err := bulkIndexer.Update(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bulkIndexer.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) != len(users) {
+		t.Fatalf("all items should fail: got %#v", failed)
+	}
+	for i, err := range failed {
+		var errRes *ErrorResponse
+		if err.Model != users[i] || err.Action != "index" {
+			t.Errorf("invalid failure: got %#v", err)
+		}
+		if !errors.As(err, &errRes) || errRes.Status != http.StatusServiceUnavailable {
+			t.Errorf("invalid error: got %#v", err.Err)
+		}
+	}
+	if stats := bulkIndexer.Stats(); stats.NumFailed != 2 || stats.NumRequests != 1 {
+		t.Errorf("invalid stats: got %#v", stats)
+	}
+}
+
+func TestBulkIndexer_missingResults(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		failed []*BulkItemError
+	)
+	bulkIndexer := newStubBulkIndexer(t, bulkIndexed).
+		WithFailureHandler(func(ctx context.Context, err *BulkItemError) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, err)
+		})
+
+	users := []*User{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	for _, user := range users {
+		if err := bulkIndexer.Update(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bulkIndexer.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) != 1 || failed[0].Model != users[1] || !errors.Is(failed[0], errBulkItemMissing) {
+		t.Fatalf("only the item without the result should fail: got %#v", failed)
+	}
+}
+
+func TestBulkIndexer_errorChannelFull(t *testing.T) {
+	ch := make(chan *BulkItemError)
+	bulkIndexer := newStubBulkIndexer(t, bulkMapperFailed).WithErrorChannel(ch)
+	if err := bulkIndexer.Update(&User{ID: 1, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := bulkIndexer.Close(ctx); err != nil {
+		t.Errorf("the worker should not wait for the channel: got %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package elsearm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	elasticsearch "github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+)
+
+var (
+	// errBulkIndexerClosed is returned when the item is added after the BulkIndexer is closed.
+	errBulkIndexerClosed = errors.New("elsearm: the bulk indexer is closed")
+	// errBulkItemMissing is passed to the items which have no result in the bulk response.
+	errBulkItemMissing = errors.New("elsearm: the bulk response has no result of the item")
+)
+
+// NewBulkIndexerFromConfig creates a BulkIndexer which writes the bulk requests by itself instead of esutil.BulkIndexer.
+// It accepts the same config as esutil.NewBulkIndexer, and uses the same defaults.
+// Unlike NewBulkIndexer, when the whole bulk request fails, all items of the request are passed to OnFailure with the error,
+// so that they are retried, stored to the DeadLetterSink and passed to the failure handler.
+func NewBulkIndexerFromConfig(cfg esutil.BulkIndexerConfig) (*BulkIndexer, error) {
+	if cfg.Client == nil {
+		client, err := elasticsearch.NewDefaultClient()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Client = client
+	}
+	if cfg.NumWorkers <= 0 {
+		cfg.NumWorkers = runtime.NumCPU()
+	}
+	if cfg.FlushBytes <= 0 {
+		cfg.FlushBytes = 5e+6
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 30 * time.Second
+	}
+
+	w := &bulkWriter{cfg: cfg, queue: make(chan bulkItem, cfg.NumWorkers)}
+	w.wg.Add(cfg.NumWorkers)
+	for i := 0; i < cfg.NumWorkers; i++ {
+		go w.work(i + 1)
+	}
+	return NewBulkIndexer(w), nil
+}
+
+// bulkItem is an item of bulkWriter, which has the body read in advance to pass it to the callbacks.
+type bulkItem struct {
+	esutil.BulkIndexerItem
+	body []byte
+}
+
+// bulkMeta is the metadata line of an item of the bulk request.
+type bulkMeta struct {
+	Index           string `json:"_index,omitempty"`
+	DocumentID      string `json:"_id,omitempty"`
+	Routing         string `json:"routing,omitempty"`
+	RetryOnConflict *int   `json:"retry_on_conflict,omitempty"`
+	Version         *int64 `json:"version,omitempty"`
+	VersionType     string `json:"version_type,omitempty"`
+}
+
+// bulkWriter is an esutil.BulkIndexer which passes the error of the bulk request to all of its items.
+type bulkWriter struct {
+	cfg   esutil.BulkIndexerConfig
+	queue chan bulkItem
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+
+	numAdded, numFlushed, numFailed, numRequests   uint64
+	numIndexed, numCreated, numUpdated, numDeleted uint64
+}
+
+// Add adds the item. Unlike esutil.BulkIndexer, it returns an error instead of panicking after Close.
+func (w *bulkWriter) Add(ctx context.Context, it esutil.BulkIndexerItem) error {
+	item := bulkItem{BulkIndexerItem: it}
+	if it.Body != nil {
+		b, err := ioutil.ReadAll(it.Body)
+		if err != nil {
+			return err
+		}
+		item.body = b
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return errBulkIndexerClosed
+	}
+	select {
+	case w.queue <- item:
+	case <-ctx.Done():
+		w.onError(ctx, ctx.Err())
+		return ctx.Err()
+	}
+	atomic.AddUint64(&w.numAdded, 1)
+	return nil
+}
+
+// Close flushes the remaining items and waits for the workers.
+// It returns the error of the context if it is done before the workers finish.
+func (w *bulkWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		w.onError(ctx, ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// Stats returns the statistics of the bulkWriter.
+func (w *bulkWriter) Stats() esutil.BulkIndexerStats {
+	return esutil.BulkIndexerStats{
+		NumAdded:    atomic.LoadUint64(&w.numAdded),
+		NumFlushed:  atomic.LoadUint64(&w.numFlushed),
+		NumFailed:   atomic.LoadUint64(&w.numFailed),
+		NumIndexed:  atomic.LoadUint64(&w.numIndexed),
+		NumCreated:  atomic.LoadUint64(&w.numCreated),
+		NumUpdated:  atomic.LoadUint64(&w.numUpdated),
+		NumDeleted:  atomic.LoadUint64(&w.numDeleted),
+		NumRequests: atomic.LoadUint64(&w.numRequests),
+	}
+}
+
+func (w *bulkWriter) work(id int) {
+	defer w.wg.Done()
+	w.debugf("[worker-%03d] Started\n", id)
+
+	ctx := context.Background()
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var (
+		buf   bytes.Buffer
+		items []bulkItem
+	)
+	flush := func() {
+		if len(items) > 0 {
+			w.debugf("[worker-%03d] Flush: %d items\n", id, len(items))
+			w.flush(ctx, buf.Bytes(), items)
+		}
+		buf.Reset()
+		items = nil
+	}
+	for {
+		select {
+		case item, ok := <-w.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if err := writeBulkItem(&buf, item); err != nil {
+				atomic.AddUint64(&w.numFailed, 1)
+				if item.OnFailure != nil {
+					item.OnFailure(ctx, item.withBody(), esutil.BulkIndexerResponseItem{}, err)
+				}
+				continue
+			}
+			items = append(items, item)
+			if buf.Len() >= w.cfg.FlushBytes {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// flush sends the bulk request, and calls the callbacks of the items with the results.
+func (w *bulkWriter) flush(ctx context.Context, body []byte, items []bulkItem) {
+	if w.cfg.OnFlushStart != nil {
+		ctx = w.cfg.OnFlushStart(ctx)
+	}
+	if w.cfg.OnFlushEnd != nil {
+		defer w.cfg.OnFlushEnd(ctx)
+	}
+
+	atomic.AddUint64(&w.numRequests, 1)
+	req := esapi.BulkRequest{
+		Index:               w.cfg.Index,
+		Body:                bytes.NewReader(body),
+		Pipeline:            w.cfg.Pipeline,
+		Refresh:             w.cfg.Refresh,
+		Routing:             w.cfg.Routing,
+		Source:              w.cfg.Source,
+		SourceExcludes:      w.cfg.SourceExcludes,
+		SourceIncludes:      w.cfg.SourceIncludes,
+		Timeout:             w.cfg.Timeout,
+		WaitForActiveShards: w.cfg.WaitForActiveShards,
+		Pretty:              w.cfg.Pretty,
+		Human:               w.cfg.Human,
+		ErrorTrace:          w.cfg.ErrorTrace,
+		FilterPath:          w.cfg.FilterPath,
+		Header:              w.cfg.Header.Clone(),
+	}
+	res, err := req.Do(ctx, w.cfg.Client)
+	if err != nil {
+		w.failAll(ctx, items, 0, err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			w.failAll(ctx, items, res.StatusCode, err)
+			return
+		}
+		w.failAll(ctx, items, res.StatusCode, newErrorResponse(res.StatusCode, b))
+		return
+	}
+
+	var bulkRes esutil.BulkIndexerResponse
+	if err := w.decode(res.Body, &bulkRes); err != nil {
+		w.failAll(ctx, items, res.StatusCode, err)
+		return
+	}
+	for i, result := range bulkRes.Items {
+		if i >= len(items) {
+			break
+		}
+		item := items[i]
+		for action, info := range result {
+			if info.Error.Type != "" || info.Status > 201 {
+				atomic.AddUint64(&w.numFailed, 1)
+				if item.OnFailure != nil {
+					item.OnFailure(ctx, item.withBody(), info, nil)
+				}
+				continue
+			}
+
+			atomic.AddUint64(&w.numFlushed, 1)
+			switch action {
+			case "index":
+				atomic.AddUint64(&w.numIndexed, 1)
+			case "create":
+				atomic.AddUint64(&w.numCreated, 1)
+			case "update":
+				atomic.AddUint64(&w.numUpdated, 1)
+			case "delete":
+				atomic.AddUint64(&w.numDeleted, 1)
+			}
+			if item.OnSuccess != nil {
+				item.OnSuccess(ctx, item.withBody(), info)
+			}
+		}
+	}
+	if len(bulkRes.Items) < len(items) {
+		// NOTE: the results of the items may be dropped by FilterPath, so they are not known to be written.
+		w.failAll(ctx, items[len(bulkRes.Items):], 0, errBulkItemMissing)
+	}
+}
+
+func (w *bulkWriter) decode(r io.Reader, res *esutil.BulkIndexerResponse) error {
+	if w.cfg.Decoder != nil {
+		return w.cfg.Decoder.UnmarshalFromReader(r, res)
+	}
+	return json.NewDecoder(r).Decode(res)
+}
+
+// failAll passes the error to OnError and the OnFailure of all items.
+// status is the status of the bulk request, or zero if it has no response.
+func (w *bulkWriter) failAll(ctx context.Context, items []bulkItem, status int, err error) {
+	w.onError(ctx, err)
+	atomic.AddUint64(&w.numFailed, uint64(len(items)))
+	for _, item := range items {
+		if item.OnFailure != nil {
+			res := esutil.BulkIndexerResponseItem{Index: item.Index, DocumentID: item.DocumentID, Status: status}
+			item.OnFailure(ctx, item.withBody(), res, err)
+		}
+	}
+}
+
+func (w *bulkWriter) onError(ctx context.Context, err error) {
+	if w.cfg.OnError != nil {
+		w.cfg.OnError(ctx, err)
+	}
+}
+
+func (w *bulkWriter) debugf(format string, args ...interface{}) {
+	if w.cfg.DebugLogger != nil {
+		w.cfg.DebugLogger.Printf(format, args...)
+	}
+}
+
+// writeBulkItem writes the metadata line and the body of the item in the same way as esutil.BulkIndexer.
+func writeBulkItem(buf *bytes.Buffer, item bulkItem) error {
+	meta := bulkMeta{
+		Index:      item.Index,
+		DocumentID: item.DocumentID,
+		Routing:    item.Routing,
+	}
+	if item.DocumentID != "" {
+		meta.Version, meta.VersionType = item.Version, item.VersionType
+	}
+	if item.Action == "update" {
+		meta.RetryOnConflict = item.RetryOnConflict
+	}
+	b, err := json.Marshal(map[string]bulkMeta{item.Action: meta})
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	buf.WriteByte('\n')
+	if item.body != nil {
+		buf.Write(bytes.TrimSpace(item.body))
+		buf.WriteByte('\n')
+	}
+	return nil
+}
+
+// withBody returns the esutil.BulkIndexerItem which has a new reader of the body.
+func (item bulkItem) withBody() esutil.BulkIndexerItem {
+	it := item.BulkIndexerItem
+	if item.body != nil {
+		it.Body = bytes.NewReader(item.body)
+	}
+	return it
+}
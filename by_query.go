@@ -0,0 +1,159 @@
+package elsearm
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/soranoba/elsearm/query"
+)
+
+// ByQueryResult is a result of DeleteByQuery and UpdateByQuery.
+type ByQueryResult struct {
+	Took     int  `json:"took"`
+	TimedOut bool `json:"timed_out"`
+	TaskProgress
+}
+
+// DeleteByQuery deletes the documents that match the query from the search index of the model.
+// If the query is nil, it returns ErrQueryRequired. Use query.MatchAll() to delete all documents.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-delete-by-query.html
+func (indexer *Indexer) DeleteByQuery(model interface{}, q query.Query, reqFuncs ...func(*esapi.DeleteByQueryRequest)) (*ByQueryResult, error) {
+	req, err := indexer.deleteByQueryRequest(model, q, reqFuncs)
+	if err != nil {
+		return nil, err
+	}
+
+	var res ByQueryResult
+	if err := indexer.Do(req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// DeleteByQueryAsync starts DeleteByQuery with wait_for_completion=false, and returns the task.
+func (indexer *Indexer) DeleteByQueryAsync(model interface{}, q query.Query, reqFuncs ...func(*esapi.DeleteByQueryRequest)) (*Task, error) {
+	req, err := indexer.deleteByQueryRequest(model, q, reqFuncs)
+	if err != nil {
+		return nil, err
+	}
+	req.WaitForCompletion = boolPtr(false)
+	return indexer.startTask(req, "_delete_by_query")
+}
+
+// UpdateByQuery updates the documents that match the query in the search index of the model with the script.
+// If the query is nil, it updates all documents. If the script is nil, the documents are just reindexed. (e.g. to pick up the new mappings)
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-update-by-query.html
+func (indexer *Indexer) UpdateByQuery(model interface{}, q query.Query, script *Script, reqFuncs ...func(*esapi.UpdateByQueryRequest)) (*ByQueryResult, error) {
+	req, err := indexer.updateByQueryRequest(model, q, script, reqFuncs)
+	if err != nil {
+		return nil, err
+	}
+
+	var res ByQueryResult
+	if err := indexer.Do(req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UpdateByQueryAsync starts UpdateByQuery with wait_for_completion=false, and returns the task.
+func (indexer *Indexer) UpdateByQueryAsync(model interface{}, q query.Query, script *Script, reqFuncs ...func(*esapi.UpdateByQueryRequest)) (*Task, error) {
+	req, err := indexer.updateByQueryRequest(model, q, script, reqFuncs)
+	if err != nil {
+		return nil, err
+	}
+	req.WaitForCompletion = boolPtr(false)
+	return indexer.startTask(req, "_update_by_query")
+}
+
+func (indexer *Indexer) deleteByQueryRequest(model interface{}, q query.Query, reqFuncs []func(*esapi.DeleteByQueryRequest)) (*esapi.DeleteByQueryRequest, error) {
+	if err := indexer.config().assertModel(model); err != nil {
+		return nil, err
+	}
+	// NOTE: a nil query should not delete all documents by mistake.
+	if q == nil {
+		return nil, ErrQueryRequired
+	}
+
+	body, err := byQueryBody(q, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &esapi.DeleteByQueryRequest{
+		Index:   indexer.escapedSearchIndexName(model),
+		Body:    body,
+		Refresh: indexer.byQueryRefresh(),
+	}
+	for _, f := range reqFuncs {
+		f(req)
+	}
+	return req, nil
+}
+
+func (indexer *Indexer) updateByQueryRequest(model interface{}, q query.Query, script *Script, reqFuncs []func(*esapi.UpdateByQueryRequest)) (*esapi.UpdateByQueryRequest, error) {
+	if err := indexer.config().assertModel(model); err != nil {
+		return nil, err
+	}
+
+	body, err := byQueryBody(q, script)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &esapi.UpdateByQueryRequest{
+		Index:   indexer.escapedSearchIndexName(model),
+		Body:    body,
+		Refresh: indexer.byQueryRefresh(),
+	}
+	for _, f := range reqFuncs {
+		f(req)
+	}
+	return req, nil
+}
+
+func (indexer *Indexer) startTask(req Request, action string) (*Task, error) {
+	var res struct {
+		Task string `json:"task"`
+	}
+	if err := indexer.Do(req, &res); err != nil {
+		return nil, err
+	}
+	return indexer.newTask(res.Task, action), nil
+}
+
+func (indexer *Indexer) escapedSearchIndexName(model interface{}) []string {
+	rawIndexNames := indexer.SearchIndexName(model)
+	indexNames := make([]string, len(rawIndexNames))
+	for i, indexName := range rawIndexNames {
+		indexNames[i] = url.QueryEscape(indexName)
+	}
+	return indexNames
+}
+
+// byQueryRefresh returns the refresh of the config. The APIs by query do not support wait_for.
+func (indexer *Indexer) byQueryRefresh() *bool {
+	if indexer.config().Refresh == "true" {
+		return boolPtr(true)
+	}
+	return nil
+}
+
+func byQueryBody(q query.Query, script *Script) (io.Reader, error) {
+	if q == nil {
+		q = query.MatchAll()
+	}
+	body := map[string]interface{}{"query": q.Source()}
+	if script != nil {
+		body["script"] = script
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
@@ -0,0 +1,162 @@
+package elsearm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soranoba/elsearm/query"
+)
+
+func seedUsers(t *testing.T, indexer *Indexer, names ...string) {
+	t.Helper()
+	_ = indexer.DeleteIndex(&User{})
+	if err := indexer.CreateIndex(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range names {
+		if err := indexer.Update(&User{ID: uint(i + 1), Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIndexerDeleteByQuery(t *testing.T) {
+	indexer := indexer.WithConfig(Config{Refresh: "true"})
+	seedUsers(t, indexer, "Alice", "Bob", "Carol")
+
+	result, err := indexer.DeleteByQuery(&User{}, query.Terms("id", 1, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 2 || result.Deleted != 2 || result.VersionConflicts != 0 || len(result.Failures) != 0 {
+		t.Errorf("invalid result: got %#v", result)
+	}
+
+	count, err := indexer.Count(&User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("invalid count: gots %d, wants %d", count, 1)
+	}
+
+	if _, err := indexer.DeleteByQuery(&User{}, nil); !errors.Is(err, ErrQueryRequired) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if _, err := indexer.DeleteByQueryAsync(&User{}, nil); !errors.Is(err, ErrQueryRequired) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if count, err := indexer.Count(&User{}); err != nil || count != 1 {
+		t.Errorf("the documents should not be deleted: got %d, %v", count, err)
+	}
+}
+
+func TestIndexerUpdateByQuery(t *testing.T) {
+	indexer := indexer.WithConfig(Config{Refresh: "true"})
+	seedUsers(t, indexer, "Alice", "Bob")
+
+	result, err := indexer.UpdateByQuery(&User{}, query.Term("id", 2), &Script{
+		Source: "ctx._source.name = params.name",
+		Params: map[string]interface{}{"name": "Bobby"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 1 || result.Updated != 1 {
+		t.Errorf("invalid result: got %#v", result)
+	}
+
+	user := &User{ID: 2}
+	if err := indexer.Get(user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Bobby" {
+		t.Errorf("invalid result: got %#v", user)
+	}
+
+	// NOTE: all documents are reindexed without the query and script.
+	if result, err = indexer.UpdateByQuery(&User{}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 2 || result.Updated != 2 {
+		t.Errorf("invalid result: got %#v", result)
+	}
+}
+
+func TestIndexerDeleteByQueryAsync(t *testing.T) {
+	indexer := indexer.WithConfig(Config{Refresh: "true"})
+	seedUsers(t, indexer, "Alice", "Bob")
+
+	task, err := indexer.DeleteByQueryAsync(&User{}, query.MatchAll())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.ID == "" {
+		t.Fatal("the task id should be returned")
+	}
+
+	var status *TaskStatus
+	for i := 0; i < 100; i++ {
+		if status, err = task.Status(); err != nil {
+			t.Fatal(err)
+		}
+		if status.Completed {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !status.Completed || status.Err != nil || status.Progress.Deleted != 2 {
+		t.Errorf("invalid status: got %#v", status)
+	}
+	// NOTE: the task has already been completed.
+	if err := task.Cancel(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTask_cancelAndRethrottle(t *testing.T) {
+	if testCluster == nil {
+		t.Skip("the task can not be kept running in Elasticsearch")
+	}
+	indexer := indexer.WithConfig(Config{Refresh: "true"})
+	seedUsers(t, indexer, "Alice", "Bob")
+
+	testCluster.SuspendTasks()
+	defer testCluster.ResumeTasks()
+
+	task, err := indexer.UpdateByQueryAsync(&User{}, nil, nil, indexer.Q.UpdateByQuery.WithRequestsPerSecond(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := task.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Completed || status.Progress.RequestsPerSecond != 10 {
+		t.Errorf("invalid status: got %#v", status)
+	}
+
+	if err := task.Rethrottle(-1); err != nil {
+		t.Fatal(err)
+	}
+	if status, err = task.Status(); err != nil {
+		t.Fatal(err)
+	}
+	if status.Progress.RequestsPerSecond != -1 {
+		t.Errorf("invalid status: got %#v", status)
+	}
+
+	if err := task.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	if status, err = task.Status(); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Completed || status.Progress.Canceled == "" || status.Progress.Updated != 0 {
+		t.Errorf("invalid status: got %#v", status)
+	}
+	if err := task.Rethrottle(10); err == nil {
+		t.Errorf("the completed task should not be rethrottled")
+	}
+}
@@ -0,0 +1,157 @@
+package elsearm
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// DocumentVersion is a version of the document which is used for the optimistic concurrency control.
+// It implements VersionedModel when it is embedded in the model, and it is not included in the document body.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/optimistic-concurrency-control.html
+type DocumentVersion struct {
+	SeqNo       int64 `json:"-"`
+	PrimaryTerm int64 `json:"-"`
+	Version     int64 `json:"-"`
+}
+
+// IsZero reports whether the version is unknown. (e.g. the model has not been read from Elasticsearch)
+func (v DocumentVersion) IsZero() bool {
+	return v.PrimaryTerm == 0
+}
+
+// GetDocumentVersion returns the version.
+func (v *DocumentVersion) GetDocumentVersion() DocumentVersion {
+	return *v
+}
+
+// SetDocumentVersion sets the version.
+func (v *DocumentVersion) SetDocumentVersion(version DocumentVersion) {
+	*v = version
+}
+
+// RetryOnConflict reads the document of the model, calls f to modify the model, and updates the document.
+// If the document has been changed by others in the meantime, it reads the document again and retries up to maxRetries times.
+// The model must implement VersionedModel.
+//
+// The index name and the document id are resolved with the model, and only the fields in the document body are read,
+// so the other fields of the model (e.g. `json:"-"`) are kept.
+func (indexer *Indexer) RetryOnConflict(model interface{}, maxRetries int, f func(model interface{}) error) error {
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
+	if _, ok := model.(VersionedModel); !ok {
+		return indexer.config().fail(invalidModelError(model))
+	}
+
+	documentId, err := DocumentID(model)
+	if err != nil {
+		return err
+	}
+	index := url.QueryEscape(indexer.IndexName(model))
+
+	for i := 0; ; i++ {
+		if err := indexer.reload(model, index, documentId); err != nil {
+			return err
+		}
+		if err := f(model); err != nil {
+			return err
+		}
+		err := indexer.Update(model)
+		if err == nil || i >= maxRetries || !errors.Is(err, ErrVersionConflict) {
+			return err
+		}
+	}
+}
+
+// reload reads the document into the model. The fields of the model which are not in the document body are kept.
+func (indexer *Indexer) reload(model interface{}, index string, documentId string) error {
+	withIndex := func(req *esapi.GetRequest) {
+		req.Index = index
+	}
+	if _, ok := model.(CustomDocumentBodyModel); ok {
+		return indexer.get(model, documentId, withIndex)
+	}
+
+	// NOTE: the fields changed by f should not remain when reading the document again.
+	v := reflect.ValueOf(model).Elem()
+	fresh := reflect.New(v.Type())
+	if err := indexer.get(fresh.Interface(), documentId, withIndex); err != nil {
+		return err
+	}
+	copyJSONFields(v, fresh.Elem())
+	SetDocumentVersion(model, fresh.Interface().(VersionedModel).GetDocumentVersion())
+	return nil
+}
+
+// copyJSONFields copies the fields which are encoded to JSON from src to dst.
+func copyJSONFields(dst reflect.Value, src reflect.Value) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if _, ok := jsonFieldName(f); !ok {
+			continue
+		}
+
+		df, sf := dst.Field(i), src.Field(i)
+		// Embedded structs are flattened the same as encoding/json.
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			if df.Kind() == reflect.Struct {
+				copyJSONFields(df, sf)
+				continue
+			}
+			if df.Kind() == reflect.Ptr && df.Type().Elem().Kind() == reflect.Struct && !df.IsNil() && !sf.IsNil() {
+				copyJSONFields(df.Elem(), sf.Elem())
+				continue
+			}
+		}
+		if df.CanSet() {
+			df.Set(sf)
+		}
+	}
+}
+
+// documentMeta is the metadata of the document in the responses.
+type documentMeta struct {
+	SeqNo       *int64 `json:"_seq_no"`
+	PrimaryTerm *int64 `json:"_primary_term"`
+	Version     *int64 `json:"_version"`
+}
+
+func (meta *documentMeta) setTo(model interface{}) {
+	SetDocumentVersion(model, newDocumentVersion(meta.SeqNo, meta.PrimaryTerm, meta.Version))
+}
+
+func newDocumentVersion(seqNo *int64, primaryTerm *int64, version *int64) DocumentVersion {
+	var v DocumentVersion
+	if seqNo != nil && primaryTerm != nil {
+		v.SeqNo = *seqNo
+		v.PrimaryTerm = *primaryTerm
+	}
+	if version != nil {
+		v.Version = *version
+	}
+	return v
+}
+
+// concurrencyControl returns if_seq_no and if_primary_term of the model.
+// If the model does not implement VersionedModel or the version is unknown, it returns nil.
+func concurrencyControl(model interface{}) (*int, *int) {
+	versioned, ok := model.(VersionedModel)
+	if !ok {
+		return nil, nil
+	}
+	v := versioned.GetDocumentVersion()
+	if v.IsZero() {
+		return nil, nil
+	}
+	seqNo, primaryTerm := int(v.SeqNo), int(v.PrimaryTerm)
+	return &seqNo, &primaryTerm
+}
+
+func isVersionedModelType(t reflect.Type) bool {
+	return t.Implements(reflect.TypeOf((*VersionedModel)(nil)).Elem()) ||
+		reflect.PtrTo(t).Implements(reflect.TypeOf((*VersionedModel)(nil)).Elem())
+}
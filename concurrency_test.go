@@ -0,0 +1,355 @@
+package elsearm
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+)
+
+type Wallet struct {
+	DocumentVersion
+	ID      uint `json:"id"`
+	Balance int  `json:"balance"`
+}
+
+func TestDocumentVersion(t *testing.T) {
+	var _ VersionedModel = &Wallet{}
+
+	b, err := DocumentBody(&Wallet{DocumentVersion: DocumentVersion{SeqNo: 1, PrimaryTerm: 1}, ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(s) != `{"id":1,"balance":0}` {
+		t.Errorf("the version should not be included in the document body: got %s", s)
+	}
+
+	mappings, err := Mappings(&Wallet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props := mappings["properties"].(map[string]interface{}); len(props) != 2 {
+		t.Errorf("the version should not be included in the mappings: got %v", props)
+	}
+}
+
+func TestIndexerUpdate_versionConflict(t *testing.T) {
+	_ = indexer.DeleteIndex(&Wallet{})
+	if err := indexer.CreateIndex(&Wallet{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: the version is unknown, so it is last-write-wins.
+	if err := indexer.Update(&Wallet{ID: 1, Balance: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	w1 := &Wallet{ID: 1}
+	if err := indexer.Get(w1); err != nil {
+		t.Fatal(err)
+	}
+	if w1.IsZero() || w1.Version != 1 {
+		t.Errorf("the version should be set: got %#v", w1.DocumentVersion)
+	}
+	w2 := &Wallet{ID: 1}
+	if err := indexer.Get(w2); err != nil {
+		t.Fatal(err)
+	}
+
+	w1.Balance += 10
+	if err := indexer.Update(w1); err != nil {
+		t.Fatal(err)
+	}
+	if w1.Version != 2 || w1.SeqNo == w2.SeqNo {
+		t.Errorf("the version should be updated: got %#v", w1.DocumentVersion)
+	}
+
+	w2.Balance += 20
+	err := indexer.Update(w2)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.Delete(w2); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	// NOTE: w1 has the latest version.
+	if err := indexer.Update(w1); err != nil {
+		t.Error(err)
+	}
+	if err := indexer.Delete(w1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIndexerSearch_versionedModel(t *testing.T) {
+	_ = indexer.DeleteIndex(&Wallet{})
+	indexer := indexer.WithConfig(Config{Refresh: "true"})
+	if err := indexer.CreateIndex(&Wallet{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Update(&Wallet{ID: 1, Balance: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wallets []Wallet
+	if _, err := indexer.Search(&wallets); err != nil {
+		t.Fatal(err)
+	}
+	if len(wallets) != 1 || wallets[0].IsZero() || wallets[0].Version != 1 {
+		t.Fatalf("invalid result: got %#v", wallets)
+	}
+
+	wallets[0].Balance = 50
+	if err := indexer.Update(&wallets[0]); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIndexerRetryOnConflict(t *testing.T) {
+	_ = indexer.DeleteIndex(&Wallet{})
+	if err := indexer.CreateIndex(&Wallet{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Update(&Wallet{ID: 1, Balance: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	err := indexer.RetryOnConflict(&Wallet{ID: 1}, 3, func(model interface{}) error {
+		calls++
+		if calls == 1 {
+			// NOTE: another worker changes the document.
+			if err := indexer.Update(&Wallet{ID: 1, Balance: 200}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		model.(*Wallet).Balance += 10
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("f should be called twice: got %d", calls)
+	}
+	wallet := &Wallet{ID: 1}
+	if err := indexer.Get(wallet); err != nil {
+		t.Fatal(err)
+	}
+	if wallet.Balance != 210 {
+		t.Errorf("invalid balance: got %d", wallet.Balance)
+	}
+
+	err = indexer.RetryOnConflict(&Wallet{ID: 1}, 0, func(model interface{}) error {
+		if err := indexer.Update(&Wallet{ID: 1, Balance: 0}); err != nil {
+			t.Fatal(err)
+		}
+		return nil
+	})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	if err := indexer.RetryOnConflict(&User{ID: 1}, 0, func(interface{}) error { return nil }); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
+
+type TenantWallet struct {
+	DocumentVersion
+	ID      uint   `json:"-"`
+	Tenant  string `json:"-"`
+	Balance int    `json:"balance"`
+}
+
+func (w *TenantWallet) GetDocumentID() (string, error) {
+	return strconv.Itoa(int(w.ID)), nil
+}
+
+func (w *TenantWallet) GetIndexName() string {
+	return "wallet_" + w.Tenant
+}
+
+func TestIndexerRetryOnConflict_fieldsNotInSource(t *testing.T) {
+	_ = indexer.DeleteIndex(&TenantWallet{Tenant: "a"})
+	if err := indexer.CreateIndex(&TenantWallet{Tenant: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	defer indexer.DeleteIndex(&TenantWallet{Tenant: "a"})
+	if err := indexer.Update(&TenantWallet{ID: 1, Tenant: "a", Balance: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	wallet := &TenantWallet{ID: 1, Tenant: "a"}
+	err := indexer.RetryOnConflict(wallet, 0, func(model interface{}) error {
+		model.(*TenantWallet).Balance += 10
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet.ID != 1 || wallet.Tenant != "a" || wallet.Balance != 110 {
+		t.Errorf("invalid model: got %#v", wallet)
+	}
+
+	wallet = &TenantWallet{ID: 1, Tenant: "a"}
+	if err := indexer.Get(wallet); err != nil {
+		t.Fatal(err)
+	}
+	if wallet.Balance != 110 {
+		t.Errorf("invalid balance: got %d", wallet.Balance)
+	}
+}
+
+type Row struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at" elsearm:"version"`
+}
+
+type Revision struct {
+	Rev *int `elsearm:"version"`
+}
+
+type RevisionedRow struct {
+	Revision
+	ID uint `json:"id"`
+}
+
+func TestDefaultExternalVersion(t *testing.T) {
+	now := time.Now()
+	rev := 3
+	cases := []struct {
+		model   interface{}
+		version int64
+		ok      bool
+	}{
+		{&Row{UpdatedAt: now}, now.UnixNano(), true},
+		{&Row{}, 0, false},
+		{&RevisionedRow{Revision: Revision{Rev: &rev}}, 3, true},
+		{&RevisionedRow{}, 0, false},
+		{&User{ID: 1}, 0, false},
+	}
+	for _, c := range cases {
+		version, ok, err := DefaultExternalVersion(c.model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != c.version || ok != c.ok {
+			t.Errorf("invalid version of %#v: got (%d, %v), wants (%d, %v)", c.model, version, ok, c.version, c.ok)
+		}
+	}
+
+	rev = -1
+	if _, _, err := DefaultExternalVersion(&RevisionedRow{Revision: Revision{Rev: &rev}}); err == nil {
+		t.Errorf("negative version should be an error")
+	}
+}
+
+func TestIndexerUpdate_externalVersion(t *testing.T) {
+	_ = indexer.DeleteIndex(&Row{})
+	if err := indexer.CreateIndex(&Row{}); err != nil {
+		t.Fatal(err)
+	}
+
+	older := time.Now()
+	newer := older.Add(time.Second)
+	if err := indexer.Update(&Row{ID: 1, Name: "newer", UpdatedAt: newer}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Update(&Row{ID: 1, Name: "older", UpdatedAt: older}); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.Update(&Row{ID: 1, Name: "same", UpdatedAt: newer}); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.WithConfig(Config{IgnoreStaleVersions: true}).Update(&Row{ID: 1, Name: "older", UpdatedAt: older}); err != nil {
+		t.Error(err)
+	}
+
+	row := &Row{ID: 1}
+	if err := indexer.Get(row); err != nil {
+		t.Fatal(err)
+	}
+	if row.Name != "newer" {
+		t.Errorf("the older row should not overwrite: got %#v", row)
+	}
+}
+
+func TestBulkIndexerUpdate_externalVersion(t *testing.T) {
+	newBulkIndexers := map[string]func(t *testing.T) (*BulkIndexer, func()){
+		"NewBulkIndexer": newClosableBulkIndexer,
+		"NewBulkIndexerFromConfig": func(t *testing.T) (*BulkIndexer, func()) {
+			bulk, err := NewBulkIndexerFromConfig(esutil.BulkIndexerConfig{NumWorkers: 1, Client: newTestClient()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return bulk, func() {
+				if err := bulk.Close(context.Background()); err != nil {
+					t.Error(err)
+				}
+			}
+		},
+	}
+	for name, newBulkIndexer := range newBulkIndexers {
+		t.Run(name, func(t *testing.T) {
+			_ = indexer.DeleteIndex(&Row{})
+			if err := indexer.CreateIndex(&Row{}); err != nil {
+				t.Fatal(err)
+			}
+
+			bulk, closeBulk := newBulkIndexer(t)
+			var (
+				mu     sync.Mutex
+				failed []*BulkItemError
+			)
+			sink := NewMemoryDeadLetterSink()
+			bulk = bulk.WithDeadLetterSink(sink).WithFailureHandler(func(ctx context.Context, err *BulkItemError) {
+				mu.Lock()
+				defer mu.Unlock()
+				failed = append(failed, err)
+			})
+
+			older := time.Now()
+			newer := older.Add(time.Second)
+			if err := bulk.Update(&Row{ID: 1, Name: "newer", UpdatedAt: newer}); err != nil {
+				t.Fatal(err)
+			}
+			if err := bulk.Update(&Row{ID: 1, Name: "older", UpdatedAt: older}); err != nil {
+				t.Fatal(err)
+			}
+			if err := bulk.WithConfig(Config{IgnoreStaleVersions: true}).Update(&Row{ID: 1, Name: "stale", UpdatedAt: older}); err != nil {
+				t.Fatal(err)
+			}
+			closeBulk()
+
+			if len(failed) != 1 || !errors.Is(failed[0], ErrVersionConflict) {
+				t.Fatalf("only the older row should fail with ErrVersionConflict: got %v", failed)
+			}
+			if letters := sink.Letters(); len(letters) != 0 {
+				t.Errorf("the version conflict should not be a dead letter: got %#v", letters)
+			}
+			if stats := bulk.Stats(); stats.NumAdded != 3 || stats.NumIndexed != 1 || stats.NumFailed != 2 {
+				t.Errorf("invalid stats: got %#v", stats)
+			}
+
+			row := &Row{ID: 1}
+			if err := indexer.Get(row); err != nil {
+				t.Fatal(err)
+			}
+			if row.Name != "newer" {
+				t.Errorf("the older row should not overwrite: got %#v", row)
+			}
+		})
+	}
+}
@@ -1,17 +1,117 @@
 package elsearm
 
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
 type GlobalConfig struct {
 	// A prefix of index names. It is included in the return value of elsearm.IndexName.
 	IndexNamePrefix string
 	// A suffix of index names. It is included in the return value of elsearm.IndexName.
 	IndexNameSuffix string
+	// If it is true, the functions panic instead of returning ErrInvalidModel and ErrTooManyArguments.
+	// It is useful to find mistakes in tests.
+	Strict bool
+}
+
+// Config is a config of Indexer and BulkIndexer.
+// It is used instead of GlobalConfig by the Indexer and BulkIndexer which the config is set.
+type Config struct {
+	// A prefix of index names. It is included in the return value of IndexName.
+	IndexNamePrefix string
+	// A suffix of index names. It is included in the return value of IndexName.
+	IndexNameSuffix string
+	// A default refresh policy of write requests. The value is `true`, `false` or `wait_for`.
+	// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-refresh.html
+	//
+	// It is not used by BulkIndexer, because the items are flushed together with the items of other BulkIndexers
+	// that share the esutil.BulkIndexer. Use Refresh of esutil.BulkIndexerConfig instead.
+	Refresh string
+	// A default timeout of each request. If it is zero, no timeout is set.
+	//
+	// It is not used by BulkIndexer for the same reason as Refresh.
+	// Use Timeout of esutil.BulkIndexerConfig, or the context of esutil.BulkIndexer.Close instead.
+	Timeout time.Duration
+	// A function that returns an index name of the model which is not a CustomIndexNameModel.
+	// If it is nil, DefaultIndexName is used.
+	NamingStrategy func(model interface{}) string
+	// If it is true, Indexer.Update returns nil instead of ErrVersionConflict
+	// when the external version of the model is older than or equal to the one of the document.
+	IgnoreStaleVersions bool
+	// If it is true, the functions panic instead of returning ErrInvalidModel and ErrTooManyArguments.
+	// It is useful to find mistakes in tests.
+	Strict bool
 }
 
 var (
-	globalConfig GlobalConfig
+	globalConfig   GlobalConfig
+	globalConfigMu sync.RWMutex
 )
 
 // SetGlobalConfig sets the config that applies globally.
 func SetGlobalConfig(cfg GlobalConfig) {
+	globalConfigMu.Lock()
+	defer globalConfigMu.Unlock()
 	globalConfig = cfg
 }
+
+func getGlobalConfig() *Config {
+	globalConfigMu.RLock()
+	defer globalConfigMu.RUnlock()
+	return &Config{
+		IndexNamePrefix: globalConfig.IndexNamePrefix,
+		IndexNameSuffix: globalConfig.IndexNameSuffix,
+		Strict:          globalConfig.Strict,
+	}
+}
+
+// IndexName returns an index name of the model.
+// By default, it returns the return value of NamingStrategy or DefaultIndexName.
+func (cfg *Config) IndexName(model interface{}) string {
+	indexName := (func() string {
+		searchable, ok := model.(CustomIndexNameModel)
+		if ok {
+			return searchable.GetIndexName()
+		}
+		if cfg.NamingStrategy != nil {
+			return cfg.NamingStrategy(model)
+		}
+		return DefaultIndexName(model)
+	})()
+	return cfg.IndexNameWithAffix(indexName)
+}
+
+// SearchIndexName returns an index name of the model when searching.
+// By default, it returns the same index name as the return value of IndexName.
+func (cfg *Config) SearchIndexName(model interface{}) []string {
+	searchable, ok := model.(CustomSearchIndexNameModel)
+	if ok {
+		return cfg.IndexNamesWithAffix(searchable.GetSearchIndexName())
+	}
+	return []string{cfg.IndexName(model)}
+}
+
+// IndexNameWithAffix returns an index name appending prefix and suffix.
+func (cfg *Config) IndexNameWithAffix(indexName string) string {
+	// Dynamic index name
+	// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/date-math-index-names.html
+	if !strings.Contains(indexName, "<") {
+		return cfg.IndexNamePrefix + indexName + cfg.IndexNameSuffix
+	}
+	replacer := strings.NewReplacer(
+		"<", "<"+cfg.IndexNamePrefix,
+		">", cfg.IndexNameSuffix+">",
+	)
+	return replacer.Replace(indexName)
+}
+
+// IndexNamesWithAffix returns index names appending prefix and suffix.
+func (cfg *Config) IndexNamesWithAffix(indexNames []string) []string {
+	indexNamesWithAffix := make([]string, len(indexNames))
+	for i, indexName := range indexNames {
+		indexNamesWithAffix[i] = cfg.IndexNameWithAffix(indexName)
+	}
+	return indexNamesWithAffix
+}
@@ -0,0 +1,76 @@
+package elsearm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestIndexerConfig(t *testing.T) {
+	cases := []struct {
+		cfg       Config
+		wantsName string
+	}{
+		{Config{IndexNamePrefix: "a_"}, "a_organization"},
+		{Config{IndexNameSuffix: "_b"}, "organization_b"},
+		{Config{IndexNamePrefix: "c_", IndexNameSuffix: "_c"}, "c_organization_c"},
+		{
+			Config{NamingStrategy: func(model interface{}) string {
+				return strings.ToUpper(DefaultIndexName(model))
+			}},
+			"ORGANIZATION",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.wantsName, func(t *testing.T) {
+			t.Parallel()
+
+			scoped := indexer.WithConfig(c.cfg)
+			if name := scoped.IndexName(&Organization{}); name != c.wantsName {
+				t.Errorf("invalid index name: gots %s, wants %s", name, c.wantsName)
+			}
+			if names := scoped.SearchIndexName(&Organization{}); len(names) != 1 || names[0] != c.wantsName {
+				t.Errorf("invalid index name: gots %v, wants %s", names, c.wantsName)
+			}
+			if name := scoped.WithContext(context.Background()).IndexName(&Organization{}); name != c.wantsName {
+				t.Errorf("invalid index name: gots %s, wants %s", name, c.wantsName)
+			}
+			if name := bulkIndexer.WithConfig(c.cfg).IndexName(&Organization{}); name != c.wantsName {
+				t.Errorf("invalid index name: gots %s, wants %s", name, c.wantsName)
+			}
+		})
+	}
+}
+
+func TestIndexerConfig_customIndexName(t *testing.T) {
+	scoped := indexer.WithConfig(Config{
+		IndexNamePrefix: "prefix_",
+		IndexNameSuffix: "_suffix",
+	})
+
+	wantsName := "<prefix_my-index-{now/d}_suffix>,<prefix_my-index-{now/d-1d}_suffix>"
+	if name := scoped.IndexName(&DateMathSupportInIndexNames{}); name != wantsName {
+		t.Errorf("invalid index name: gots %s, wants %s", name, wantsName)
+	}
+	if name := IndexName(&DateMathSupportInIndexNames{}); name == wantsName {
+		t.Errorf("the config of the Indexer must not be applied globally")
+	}
+}
+
+func TestIndexerConfig_global(t *testing.T) {
+	SetGlobalConfig(GlobalConfig{
+		IndexNamePrefix: "prefix_",
+		IndexNameSuffix: "_suffix",
+	})
+	defer SetGlobalConfig(GlobalConfig{})
+
+	if name := indexer.IndexName(&User{}); name != "prefix_user_suffix" {
+		t.Errorf("invalid index name: gots %s, wants %s", name, "prefix_user_suffix")
+	}
+	cfg := indexer.Config()
+	if cfg.IndexNamePrefix != "prefix_" || cfg.IndexNameSuffix != "_suffix" {
+		t.Errorf("invalid config: got %#v", cfg)
+	}
+}
@@ -0,0 +1,176 @@
+package elsearm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+)
+
+// DeadLetter is a record of the bulk item that failed permanently.
+// It has everything to replay the item with BulkIndexer.Replay.
+type DeadLetter struct {
+	Index      string          `json:"index"`
+	DocumentID string          `json:"document_id,omitempty"`
+	Action     string          `json:"action"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	// An external version of the document, which is sent with version_type=external on Replay.
+	Version *int64    `json:"version,omitempty"`
+	Status  int       `json:"status"`
+	Error   string    `json:"error"`
+	Time    time.Time `json:"time"`
+}
+
+// DeadLetterSink is an interface to store the dead letters of BulkIndexer.
+type DeadLetterSink interface {
+	// Write stores the dead letter. It is called on the goroutine of the worker of esutil.BulkIndexer.
+	Write(ctx context.Context, letter *DeadLetter) error
+}
+
+// WithDeadLetterSink specifies a sink which stores the failed items, and returns a new BulkIndexer.
+// The items are stored when they fail with a non-retryable error or the retries run out. (See WithRetryPolicy)
+// The items which fail with ErrVersionConflict are not stored, since the document has been changed by others.
+// If the sink fails, the error is passed to the failure handler as DeadLetterErr of BulkItemError.
+//
+// When the bulk request fails itself, the BulkIndexer created by NewBulkIndexerFromConfig stores all of its items in the same way,
+// but the one created by NewBulkIndexer can not, since esutil.BulkIndexer passes the error only to OnError of esutil.BulkIndexerConfig.
+func (indexer *BulkIndexer) WithDeadLetterSink(sink DeadLetterSink) *BulkIndexer {
+	newIndexer := *indexer
+	newIndexer.deadLetters = sink
+	return &newIndexer
+}
+
+// Replay adds the item of the dead letter to the BulkIndexer again.
+// Returns an error if the addition to the bulk indexer fails.
+func (indexer *BulkIndexer) Replay(letter *DeadLetter) error {
+	item := esutil.BulkIndexerItem{
+		Index:      letter.Index,
+		DocumentID: letter.DocumentID,
+		Action:     letter.Action,
+	}
+	if len(letter.Body) > 0 {
+		item.Body = bytes.NewReader(letter.Body)
+	}
+	if letter.Version != nil {
+		item.Version = letter.Version
+		item.VersionType = "external"
+	}
+	return indexer.add(nil, item)
+}
+
+func newDeadLetter(item esutil.BulkIndexerItem, status int, err error) (*DeadLetter, error) {
+	letter := &DeadLetter{
+		Index:      item.Index,
+		DocumentID: item.DocumentID,
+		Action:     item.Action,
+		Version:    item.Version,
+		Status:     status,
+		Error:      err.Error(),
+		Time:       time.Now(),
+	}
+	if item.Body != nil {
+		b, err := ioutil.ReadAll(item.Body)
+		if err != nil {
+			return nil, err
+		}
+		letter.Body = b
+	}
+	return letter, nil
+}
+
+// NDJSONDeadLetterSink is a DeadLetterSink that writes the dead letters as newline delimited JSON.
+type NDJSONDeadLetterSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewNDJSONDeadLetterSink creates a NDJSONDeadLetterSink that writes to w.
+func NewNDJSONDeadLetterSink(w io.Writer) *NDJSONDeadLetterSink {
+	return &NDJSONDeadLetterSink{w: w}
+}
+
+// NewFileDeadLetterSink creates a NDJSONDeadLetterSink that appends to the file of the path.
+// The caller should call Close when finished.
+func NewFileDeadLetterSink(path string) (*NDJSONDeadLetterSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &NDJSONDeadLetterSink{w: file, closer: file}, nil
+}
+
+// Write writes the dead letter as a line.
+func (sink *NDJSONDeadLetterSink) Write(_ context.Context, letter *DeadLetter) error {
+	b, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	_, err = sink.w.Write(append(b, '\n'))
+	return err
+}
+
+// Close closes the file if the sink is created by NewFileDeadLetterSink.
+func (sink *NDJSONDeadLetterSink) Close() error {
+	if sink.closer == nil {
+		return nil
+	}
+	return sink.closer.Close()
+}
+
+// ReadDeadLetters reads the dead letters written by NDJSONDeadLetterSink.
+func ReadDeadLetters(r io.Reader) ([]*DeadLetter, error) {
+	var letters []*DeadLetter
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 100*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			return nil, err
+		}
+		letters = append(letters, &letter)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
+
+// MemoryDeadLetterSink is a DeadLetterSink that keeps the dead letters in memory. It is useful for tests.
+type MemoryDeadLetterSink struct {
+	mu      sync.Mutex
+	letters []*DeadLetter
+}
+
+// NewMemoryDeadLetterSink creates a MemoryDeadLetterSink.
+func NewMemoryDeadLetterSink() *MemoryDeadLetterSink {
+	return &MemoryDeadLetterSink{}
+}
+
+// Write appends the dead letter.
+func (sink *MemoryDeadLetterSink) Write(_ context.Context, letter *DeadLetter) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.letters = append(sink.letters, letter)
+	return nil
+}
+
+// Letters returns the dead letters in the order of writing.
+func (sink *MemoryDeadLetterSink) Letters() []*DeadLetter {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return append([]*DeadLetter(nil), sink.letters...)
+}
@@ -0,0 +1,114 @@
+package elsearm
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBulkIndexer_deadLetters(t *testing.T) {
+	if err := indexer.CreateIndexIfNotExist(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	_ = indexer.Delete(&User{ID: 100})
+	bulk, closeBulk := newClosableBulkIndexer(t)
+
+	sink := NewMemoryDeadLetterSink()
+	bulkIndexer := bulk.WithRetryPolicy(RetryPolicy{}).WithDeadLetterSink(sink)
+
+	if err := bulkIndexer.PartialUpdate(&User{ID: 100, Name: "Bob"}, []string{"name"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bulkIndexer.Update(&User{ID: 101, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: the document to delete does not exist, but it is not a failure with a RetryPolicy.
+	_ = indexer.Delete(&User{ID: 102})
+	if err := bulkIndexer.Delete(&User{ID: 102}); err != nil {
+		t.Fatal(err)
+	}
+	closeBulk()
+
+	letters := sink.Letters()
+	if len(letters) != 1 {
+		t.Fatalf("invalid dead letters: got %#v", letters)
+	}
+	letter := letters[0]
+	if letter.Index != IndexName(&User{}) || letter.DocumentID != "100" || letter.Action != "update" ||
+		letter.Status != 404 || letter.Error == "" || string(letter.Body) != `{"doc":{"name":"Bob"}}` {
+		t.Errorf("invalid dead letter: got %#v", letter)
+	}
+
+	if err := indexer.Update(&User{ID: 100, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	bulk, closeBulk = newClosableBulkIndexer(t)
+	bulkIndexer = bulk.WithDeadLetterSink(sink)
+	if err := bulkIndexer.Replay(letter); err != nil {
+		t.Fatal(err)
+	}
+	closeBulk()
+
+	if len(sink.Letters()) != 1 {
+		t.Errorf("invalid dead letters: got %#v", sink.Letters())
+	}
+	user := &User{ID: 100}
+	if err := indexer.Get(user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Bob" {
+		t.Errorf("invalid result: got %#v", user)
+	}
+}
+
+func TestFileDeadLetterSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letters.ndjson")
+	version := int64(3)
+	letters := []*DeadLetter{
+		{Index: "user", DocumentID: "1", Action: "update", Body: []byte(`{"doc":{"name":"Bob"}}`), Status: 404, Error: "not found"},
+		{Index: "user", DocumentID: "2", Action: "index", Body: []byte(`{"id":2}`), Version: &version, Status: 400, Error: "mapper_parsing_exception"},
+	}
+	for i, letter := range letters {
+		letter.Time = time.Date(2020, 1, 1, 0, 0, i, 0, time.UTC)
+	}
+
+	// NOTE: the file is appended, even if the sink is reopened.
+	for _, letter := range letters {
+		sink, err := NewFileDeadLetterSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Write(context.Background(), letter); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(b, []byte("\n")); n != len(letters) {
+		t.Errorf("invalid number of lines: got %d", n)
+	}
+	got, err := ReadDeadLetters(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, letters) {
+		t.Errorf("invalid dead letters: got %#v", got)
+	}
+
+	if _, err := ReadDeadLetters(bytes.NewReader([]byte("{"))); err == nil {
+		t.Errorf("ReadDeadLetters should fail but succeeded")
+	}
+	if _, err := NewFileDeadLetterSink(filepath.Join(path, "invalid")); err == nil {
+		t.Errorf("NewFileDeadLetterSink should fail but succeeded")
+	}
+}
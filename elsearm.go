@@ -1,58 +1,30 @@
 package elsearm
 
 import (
+	"fmt"
 	"io"
-	"strings"
 )
 
 // IndexName returns an index name of the model.
 // By default, it returns converted to snake case the struct name of model.
 func IndexName(model interface{}) string {
-	indexName := (func() string {
-		searchable, ok := model.(CustomIndexNameModel)
-		if ok {
-			return searchable.GetIndexName()
-		}
-		return DefaultIndexName(model)
-	})()
-	return IndexNameWithAffix(indexName)
+	return getGlobalConfig().IndexName(model)
 }
 
 // SearchIndexName returns an index name of the model when searching.
 // By default, it returns the same index name as the return value of IndexName.
 func SearchIndexName(model interface{}) []string {
-	searchable, ok := model.(CustomSearchIndexNameModel)
-	if ok {
-		names := searchable.GetSearchIndexName()
-		for i, name := range names {
-			names[i] = IndexNameWithAffix(name)
-		}
-		return names
-	}
-	return []string{IndexName(model)}
+	return getGlobalConfig().SearchIndexName(model)
 }
 
 // IndexNameWithAffix returns an index name appending prefix and suffix.
 func IndexNameWithAffix(indexName string) string {
-	// Dynamic index name
-	// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/date-math-index-names.html
-	if !strings.Contains(indexName, "<") {
-		return globalConfig.IndexNamePrefix + indexName + globalConfig.IndexNameSuffix
-	}
-	replacer := strings.NewReplacer(
-		"<", "<"+globalConfig.IndexNamePrefix,
-		">", globalConfig.IndexNameSuffix+">",
-	)
-	return replacer.Replace(indexName)
+	return getGlobalConfig().IndexNameWithAffix(indexName)
 }
 
 // IndexNamesWithAffix returns index names appending prefix and suffix.
 func IndexNamesWithAffix(indexNames []string) []string {
-	indexNamesWithAffix := make([]string, len(indexNames))
-	for i, indexName := range indexNames {
-		indexNamesWithAffix[i] = IndexNameWithAffix(indexName)
-	}
-	return indexNamesWithAffix
+	return getGlobalConfig().IndexNamesWithAffix(indexNames)
 }
 
 // DocumentID returns a document id of the model.
@@ -65,6 +37,16 @@ func DocumentID(model interface{}) (string, error) {
 	return DefaultDocumentID(model), nil
 }
 
+// ExternalVersion returns an external version of the model. If the model has no version, it returns false.
+// By default, it returns value of the field with `elsearm:"version"` tag.
+func ExternalVersion(model interface{}) (int64, bool, error) {
+	versioned, ok := model.(ExternalVersionModel)
+	if ok {
+		return versioned.GetExternalVersion()
+	}
+	return DefaultExternalVersion(model)
+}
+
 // DocumentBody transforms the model into a data structure that is stored in Elasticsearch.
 // By default, it execute json.Marshal.
 func DocumentBody(model interface{}) (io.Reader, error) {
@@ -85,6 +67,21 @@ func MustDocumentBody(model interface{}) io.Reader {
 	return reader
 }
 
+// IndexSettings returns a body of the create index API for the model.
+// By default, it returns the mappings generated by Mappings.
+// If the model implements CustomDocumentBodyModel, it must implement CustomIndexSettingsModel too, otherwise it returns ErrIndexSettingsRequired,
+// because the generated mappings may not match the document.
+func IndexSettings(model interface{}) (io.Reader, error) {
+	searchable, ok := model.(CustomIndexSettingsModel)
+	if ok {
+		return searchable.GetIndexSettings()
+	}
+	if _, ok := model.(CustomDocumentBodyModel); ok {
+		return nil, fmt.Errorf("%w: %T", ErrIndexSettingsRequired, model)
+	}
+	return DefaultIndexSettings(model)
+}
+
 // ParseDocument parses and applies the value to the model.
 // By default, it execute json.Unmarshal.
 func ParseDocument(model interface{}, reader io.Reader) error {
@@ -104,3 +101,11 @@ func SetDocumentID(model interface{}, id string) error {
 	}
 	return nil
 }
+
+// SetDocumentVersion set the version of the document to the model.
+// By default, no executed.
+func SetDocumentVersion(model interface{}, version DocumentVersion) {
+	if versioned, ok := model.(VersionedModel); ok {
+		versioned.SetDocumentVersion(version)
+	}
+}
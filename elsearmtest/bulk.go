@@ -0,0 +1,87 @@
+package elsearmtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+func (c *Cluster) bulk(req *request, defaultIndex string) (int, interface{}, *esError) {
+	var lines [][]byte
+	for _, line := range bytes.Split(req.body, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	hasErrors := false
+	items := make([]interface{}, 0, len(lines))
+	for i := 0; i < len(lines); i++ {
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+			conditions
+		}
+		if err := json.Unmarshal(lines[i], &action); err != nil || len(action) != 1 {
+			return 0, nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+				fmt.Sprintf("Malformed action/metadata line [%d]", i+1))
+		}
+
+		for typ, meta := range action {
+			if meta.Index == "" {
+				meta.Index = defaultIndex
+			}
+
+			var body []byte
+			if typ != "delete" {
+				if i+1 >= len(lines) {
+					return 0, nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+						"The bulk request must be terminated by a newline [\\n]")
+				}
+				i++
+				body = lines[i]
+			}
+
+			var (
+				status int
+				res    map[string]interface{}
+				err    *esError
+			)
+			switch typ {
+			case "index":
+				status, res, err = c.index(meta.Index, meta.ID, body, false, meta.conditions)
+			case "create":
+				status, res, err = c.index(meta.Index, meta.ID, body, true, meta.conditions)
+			case "update":
+				status, res, err = c.update(meta.Index, meta.ID, body, meta.conditions)
+			case "delete":
+				status, res, err = c.delete(meta.Index, meta.ID, meta.conditions)
+			default:
+				return 0, nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+					fmt.Sprintf("Malformed action/metadata line [%d], expected field [create], [delete], [index] or [update] but found [%s]", i+1, typ))
+			}
+
+			if err != nil {
+				status = err.status
+				res = map[string]interface{}{
+					"_index": meta.Index,
+					"_type":  "_doc",
+					"_id":    meta.ID,
+					"error":  err.cause(),
+				}
+			}
+			if status >= 300 {
+				hasErrors = true
+			}
+			res["status"] = status
+			items = append(items, map[string]interface{}{typ: res})
+		}
+	}
+
+	return http.StatusOK, map[string]interface{}{
+		"took":   0,
+		"errors": hasErrors,
+		"items":  items,
+	}, nil
+}
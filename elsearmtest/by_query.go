@@ -0,0 +1,159 @@
+package elsearmtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+func (c *Cluster) deleteByQuery(req *request, expr string) (int, interface{}, *esError) {
+	var body struct {
+		Query   map[string]interface{} `json:"query"`
+		MaxDocs *int                   `json:"max_docs"`
+	}
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	if _, err := c.resolve(expr, req.boolParam("ignore_unavailable")); err != nil {
+		return 0, nil, err
+	}
+
+	return c.startTask(req, "indices:data/write/delete/byquery", "delete-by-query ["+expr+"]", byQueryStatus(req),
+		func(t *task) (map[string]interface{}, *esError) {
+			hits, err := c.searchDocs(expr, body.Query, req.boolParam("ignore_unavailable"))
+			if err != nil {
+				return nil, err
+			}
+			hits = limitHits(hits, body.MaxDocs, req)
+
+			t.status["total"] = len(hits)
+			deleted := 0
+			for _, h := range hits {
+				if _, _, err := c.delete(h.idx.name, h.doc.id, conditions{}); err != nil {
+					return nil, err
+				}
+				deleted++
+			}
+			t.status["deleted"] = deleted
+			t.status["batches"] = batches(len(hits))
+			return byQueryResponse(t), nil
+		})
+}
+
+func (c *Cluster) updateByQuery(req *request, expr string) (int, interface{}, *esError) {
+	var body struct {
+		Query   map[string]interface{} `json:"query"`
+		Script  json.RawMessage        `json:"script"`
+		MaxDocs *int                   `json:"max_docs"`
+	}
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	if _, err := c.resolve(expr, req.boolParam("ignore_unavailable")); err != nil {
+		return 0, nil, err
+	}
+
+	var s *script
+	if len(body.Script) > 0 {
+		var err *esError
+		if s, err = parseScript(body.Script); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return c.startTask(req, "indices:data/write/update/byquery", "update-by-query ["+expr+"]", byQueryStatus(req),
+		func(t *task) (map[string]interface{}, *esError) {
+			hits, err := c.searchDocs(expr, body.Query, req.boolParam("ignore_unavailable"))
+			if err != nil {
+				return nil, err
+			}
+			hits = limitHits(hits, body.MaxDocs, req)
+
+			t.status["total"] = len(hits)
+			updated, deleted, noops := 0, 0, 0
+			for _, h := range hits {
+				fields := copyFields(h.doc.fields)
+				if s != nil {
+					op, err := s.run(fields)
+					if err != nil {
+						return nil, err
+					}
+					switch op {
+					case "delete":
+						if _, _, err := c.delete(h.idx.name, h.doc.id, conditions{}); err != nil {
+							return nil, err
+						}
+						deleted++
+						continue
+					case "none", "noop":
+						noops++
+						continue
+					}
+				}
+
+				source, e := json.Marshal(fields)
+				if e != nil {
+					return nil, newError(http.StatusBadRequest, "mapper_parsing_exception", e.Error())
+				}
+				c.put(h.idx, h.doc.id, source, fields)
+				updated++
+			}
+			t.status["updated"] = updated
+			t.status["deleted"] = deleted
+			t.status["noops"] = noops
+			t.status["batches"] = batches(len(hits))
+			return byQueryResponse(t), nil
+		})
+}
+
+func limitHits(hits []*hit, maxDocs *int, req *request) []*hit {
+	if maxDocs == nil {
+		if n, err := strconv.Atoi(req.param("max_docs")); err == nil {
+			maxDocs = &n
+		}
+	}
+	if maxDocs != nil && *maxDocs >= 0 && *maxDocs < len(hits) {
+		return hits[:*maxDocs]
+	}
+	return hits
+}
+
+// batches returns the number of the scroll batches, whose size is 1000 by default.
+func batches(total int) int {
+	if total == 0 {
+		return 0
+	}
+	return (total + 999) / 1000
+}
+
+func byQueryStatus(req *request) map[string]interface{} {
+	rps := float64(-1)
+	if v, err := strconv.ParseFloat(req.param("requests_per_second"), 64); err == nil && v > 0 {
+		rps = v
+	}
+	return map[string]interface{}{
+		"total":                  0,
+		"updated":                0,
+		"created":                0,
+		"deleted":                0,
+		"batches":                0,
+		"version_conflicts":      0,
+		"noops":                  0,
+		"retries":                map[string]interface{}{"bulk": 0, "search": 0},
+		"throttled_millis":       0,
+		"requests_per_second":    rps,
+		"throttled_until_millis": 0,
+	}
+}
+
+func byQueryResponse(t *task) map[string]interface{} {
+	res := map[string]interface{}{
+		"took":      0,
+		"timed_out": false,
+		"failures":  []interface{}{},
+	}
+	for k, v := range t.status {
+		res[k] = v
+	}
+	return res
+}
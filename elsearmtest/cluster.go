@@ -0,0 +1,334 @@
+// Package elsearmtest provides an in-memory fake of Elasticsearch for tests.
+//
+// The Cluster implements a subset of the REST APIs closely enough that elsearm.Indexer and esutil.BulkIndexer
+// can run against it unchanged. Documents are visible to searches immediately after they are written,
+// and the results are returned in the order of insertion.
+package elsearmtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	elasticsearch "github.com/elastic/go-elasticsearch/v7"
+)
+
+// Cluster is a fake Elasticsearch cluster that keeps the documents in memory.
+type Cluster struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	indices map[string]*index
+	scrolls map[string]*scroll
+	pits    map[string]*pit
+	order   int64
+
+	tasks     map[int64]*task
+	taskSeq   int64
+	suspended bool
+}
+
+// NewCluster starts a Cluster. The caller should call Close when finished.
+func NewCluster() *Cluster {
+	c := &Cluster{}
+	c.Reset()
+	c.server = httptest.NewServer(c)
+	return c
+}
+
+// URL returns a base URL of the Cluster.
+func (c *Cluster) URL() string {
+	return c.server.URL
+}
+
+// Close shuts down the Cluster.
+func (c *Cluster) Close() {
+	c.server.Close()
+}
+
+// Client returns a client that sends requests to the Cluster.
+func (c *Cluster) Client() (*elasticsearch.Client, error) {
+	return elasticsearch.NewClient(elasticsearch.Config{
+		Addresses:            []string{c.URL()},
+		UseResponseCheckOnly: true,
+	})
+}
+
+// Reset deletes all indices, documents, scroll contexts, point-in-times and tasks.
+func (c *Cluster) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.indices = make(map[string]*index)
+	c.scrolls = make(map[string]*scroll)
+	c.pits = make(map[string]*pit)
+	c.tasks = make(map[int64]*task)
+}
+
+// ServeHTTP handles the request in the same way as Elasticsearch.
+func (c *Cluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// NOTE: the client refuses the responses without the header, as Elasticsearch 7.14 or later sends it.
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, newError(http.StatusBadRequest, "parse_exception", err.Error()))
+		return
+	}
+
+	req := &request{
+		method: r.Method,
+		path:   splitPath(r.URL.Path),
+		params: r.URL.Query(),
+		body:   body,
+	}
+
+	c.mu.Lock()
+	status, res, esErr := c.route(req)
+	c.mu.Unlock()
+
+	if esErr != nil {
+		writeError(w, esErr)
+		return
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	writeJSON(w, status, res)
+}
+
+type request struct {
+	method string
+	path   []string
+	params map[string][]string
+	body   []byte
+}
+
+func (req *request) param(name string) string {
+	if values := req.params[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (req *request) boolParam(name string) bool {
+	values, ok := req.params[name]
+	return ok && (len(values) == 0 || values[0] == "" || values[0] == "true")
+}
+
+func (req *request) decodeBody(v interface{}) *esError {
+	if len(strings.TrimSpace(string(req.body))) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(req.body, v); err != nil {
+		return newError(http.StatusBadRequest, "parse_exception", "request body is invalid: "+err.Error())
+	}
+	return nil
+}
+
+func (c *Cluster) route(req *request) (int, interface{}, *esError) {
+	p := req.path
+	m := req.method
+
+	switch {
+	case len(p) == 0:
+		return http.StatusOK, map[string]interface{}{
+			"name":         "elsearmtest",
+			"cluster_name": "elsearmtest",
+			"version":      map[string]interface{}{"number": "7.17.10", "build_flavor": "default"},
+			"tagline":      "You Know, for Search",
+		}, nil
+	case p[0] == "_bulk":
+		return c.bulk(req, "")
+	case p[0] == "_search" && len(p) >= 2 && p[1] == "scroll":
+		if m == http.MethodDelete {
+			return c.clearScroll(req, p[2:])
+		}
+		return c.scroll(req, strings.Join(p[2:], ""))
+	case p[0] == "_search":
+		return c.search(req, "_all")
+	case p[0] == "_pit" && m == http.MethodDelete:
+		return c.closePointInTime(req)
+	case p[0] == "_count":
+		return c.count(req, "_all")
+	case p[0] == "_tasks" && len(p) == 2 && m == http.MethodGet:
+		return c.getTask(p[1])
+	case p[0] == "_tasks" && len(p) == 3 && p[2] == "_cancel" && m == http.MethodPost:
+		return c.cancelTask(p[1])
+	case (p[0] == "_delete_by_query" || p[0] == "_update_by_query" || p[0] == "_reindex") && len(p) == 3 && p[2] == "_rethrottle":
+		return c.rethrottleTask(req, p[1])
+	case p[0] == "_reindex":
+		return c.reindex(req)
+	case p[0] == "_mget":
+		return c.mget(req, "")
+	case p[0] == "_aliases":
+		return c.updateAliases(req)
+	case p[0] == "_alias":
+		return c.getAlias(req, "_all", p[1:])
+	case p[0] == "_refresh":
+		return c.refresh(req, "_all")
+	}
+
+	name := p[0]
+	if len(p) == 1 {
+		switch m {
+		case http.MethodHead:
+			return c.existsIndex(req, name)
+		case http.MethodPut:
+			return c.createIndex(req, name)
+		case http.MethodDelete:
+			return c.deleteIndex(req, name)
+		case http.MethodGet:
+			return c.getIndex(req, name)
+		}
+		return 0, nil, methodNotAllowed(req)
+	}
+
+	switch p[1] {
+	case "_bulk":
+		return c.bulk(req, name)
+	case "_search":
+		return c.search(req, name)
+	case "_count":
+		return c.count(req, name)
+	case "_alias", "_aliases":
+		return c.getAlias(req, name, p[2:])
+	case "_refresh":
+		return c.refresh(req, name)
+	case "_mget":
+		return c.mget(req, name)
+	case "_pit":
+		return c.openPointInTime(req, name)
+	case "_forcemerge":
+		return c.forceMerge(req, name)
+	case "_delete_by_query":
+		return c.deleteByQuery(req, name)
+	case "_update_by_query":
+		return c.updateByQuery(req, name)
+	case "_doc", "_create", "_update":
+		cond, err := parseConditions(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(p) == 2 && p[1] == "_doc" && m == http.MethodPost {
+			return c.index(name, "", req.body, false, cond)
+		}
+		// NOTE: esapi sends the update request to /{index}/_doc/{id}/_update.
+		if len(p) == 4 && p[1] == "_doc" && p[3] == "_update" && m == http.MethodPost {
+			return c.update(name, p[2], req.body, cond)
+		}
+		if len(p) != 3 {
+			break
+		}
+		id := p[2]
+		switch {
+		case p[1] == "_create":
+			return c.index(name, id, req.body, true, cond)
+		case p[1] == "_update":
+			return c.update(name, id, req.body, cond)
+		case m == http.MethodPut || m == http.MethodPost:
+			return c.index(name, id, req.body, req.param("op_type") == "create", cond)
+		case m == http.MethodGet || m == http.MethodHead:
+			return c.get(name, id)
+		case m == http.MethodDelete:
+			return c.delete(name, id, cond)
+		}
+	}
+	return 0, nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+		fmt.Sprintf("elsearmtest does not support [%s /%s]", m, strings.Join(p, "/")))
+}
+
+func (c *Cluster) nextOrder() int64 {
+	c.order++
+	return c.order
+}
+
+func (c *Cluster) refresh(req *request, expr string) (int, interface{}, *esError) {
+	if _, err := c.resolve(expr, req.boolParam("ignore_unavailable")); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, map[string]interface{}{"_shards": shards()}, nil
+}
+
+type esError struct {
+	status int
+	typ    string
+	reason string
+	index  string
+}
+
+func newError(status int, typ string, reason string) *esError {
+	return &esError{status: status, typ: typ, reason: reason}
+}
+
+func indexNotFound(name string) *esError {
+	return &esError{
+		status: http.StatusNotFound,
+		typ:    "index_not_found_exception",
+		reason: "no such index [" + name + "]",
+		index:  name,
+	}
+}
+
+func methodNotAllowed(req *request) *esError {
+	return newError(http.StatusMethodNotAllowed, "method_not_allowed",
+		fmt.Sprintf("Incorrect HTTP method for uri [/%s] and method [%s]", strings.Join(req.path, "/"), req.method))
+}
+
+func (e *esError) cause() map[string]interface{} {
+	cause := map[string]interface{}{"type": e.typ, "reason": e.reason}
+	if e.index != "" {
+		cause["index"] = e.index
+	}
+	return cause
+}
+
+func writeError(w http.ResponseWriter, e *esError) {
+	cause := e.cause()
+	cause["root_cause"] = []interface{}{e.cause()}
+	writeJSON(w, e.status, map[string]interface{}{"error": cause, "status": e.status})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func splitPath(path string) []string {
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+func shards() map[string]interface{} {
+	return map[string]interface{}{"total": 1, "successful": 1, "failed": 0}
+}
+
+func newID() string {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func sortedKeys(m map[string]*index) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,333 @@
+package elsearmtest_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	elasticsearch "github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/soranoba/elsearm"
+	"github.com/soranoba/elsearm/elsearmtest"
+	"github.com/soranoba/elsearm/query"
+)
+
+type Book struct {
+	ID     int      `json:"id"`
+	Title  string   `json:"title"`
+	Tags   []string `json:"tags"`
+	Rating int      `json:"rating"`
+}
+
+func (b *Book) GetDocumentID() string {
+	return strconv.Itoa(b.ID)
+}
+
+func newIndexer(t *testing.T) (*elsearmtest.Cluster, *elsearm.Indexer) {
+	t.Helper()
+	cluster := elsearmtest.NewCluster()
+	t.Cleanup(cluster.Close)
+
+	client, err := cluster.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cluster, elsearm.NewIndexer(client)
+}
+
+func seed(t *testing.T, indexer *elsearm.Indexer) {
+	t.Helper()
+	books := []*Book{
+		{ID: 1, Title: "The Go Programming Language", Tags: []string{"go", "programming"}, Rating: 5},
+		{ID: 2, Title: "Elasticsearch in Action", Tags: []string{"search"}, Rating: 4},
+		{ID: 3, Title: "Learning Go", Tags: []string{"go"}, Rating: 3},
+	}
+	for _, book := range books {
+		if err := indexer.Update(book); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCluster_info(t *testing.T) {
+	cluster := elsearmtest.NewCluster()
+	defer cluster.Close()
+
+	// NOTE: the client checks the info API before the first request, unless UseResponseCheckOnly is true.
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{cluster.URL()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info struct {
+		Version struct {
+			Number string `json:"number"`
+		} `json:"version"`
+	}
+	if err := elsearm.NewIndexer(client).Do(&esapi.InfoRequest{}, &info); err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: it should be the same version as the client.
+	major, minor, _, err := elasticsearch.ParseElasticsearchVersion(info.Version.Number)
+	if err != nil || major != 7 || minor != 17 {
+		t.Errorf("invalid version: got %s", info.Version.Number)
+	}
+}
+
+func TestCluster_index(t *testing.T) {
+	_, indexer := newIndexer(t)
+
+	if err := indexer.CreateIndex(&Book{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.CreateIndex(&Book{}); !errors.Is(err, elsearm.ErrIndexAlreadyExists) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.CreateIndexIfNotExist(&Book{}); err != nil {
+		t.Error(err)
+	}
+	if err := indexer.DeleteIndex(&Book{}); err != nil {
+		t.Error(err)
+	}
+	if err := indexer.DeleteIndex(&Book{}); !errors.Is(err, elsearm.ErrIndexNotFound) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
+
+func TestCluster_document(t *testing.T) {
+	_, indexer := newIndexer(t)
+	seed(t, indexer)
+
+	book := &Book{ID: 2}
+	if err := indexer.Get(book); err != nil {
+		t.Fatal(err)
+	}
+	if book.Title != "Elasticsearch in Action" || book.Rating != 4 {
+		t.Errorf("invalid result: got %#v", book)
+	}
+
+	if err := indexer.Delete(book); err != nil {
+		t.Error(err)
+	}
+	if err := indexer.Get(&Book{ID: 2}); !errors.Is(err, elsearm.ErrDocumentNotFound) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.Delete(book); !errors.Is(err, elsearm.ErrDocumentNotFound) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	count, err := indexer.Count(&Book{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("invalid count: gots %d, wants %d", count, 2)
+	}
+}
+
+func TestCluster_concurrencyControl(t *testing.T) {
+	_, indexer := newIndexer(t)
+	seed(t, indexer)
+
+	var res struct {
+		SeqNo       int `json:"_seq_no"`
+		PrimaryTerm int `json:"_primary_term"`
+	}
+	if err := indexer.Do(&esapi.GetRequest{Index: "book", DocumentID: "1"}, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := res.SeqNo - 1
+	if err := indexer.Update(&Book{ID: 1}, indexer.Q.Index.WithIfSeqNo(stale), indexer.Q.Index.WithIfPrimaryTerm(res.PrimaryTerm)); !errors.Is(err, elsearm.ErrVersionConflict) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.Delete(&Book{ID: 1}, indexer.Q.Delete.WithIfSeqNo(stale), indexer.Q.Delete.WithIfPrimaryTerm(res.PrimaryTerm)); !errors.Is(err, elsearm.ErrVersionConflict) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.Update(&Book{ID: 1}, indexer.Q.Index.WithIfSeqNo(res.SeqNo), indexer.Q.Index.WithIfPrimaryTerm(res.PrimaryTerm)); err != nil {
+		t.Error(err)
+	}
+
+	external := func(v int) func(*esapi.IndexRequest) {
+		return func(req *esapi.IndexRequest) {
+			req.Version = &v
+			req.VersionType = "external"
+		}
+	}
+	if err := indexer.Update(&Book{ID: 1}, external(10)); err != nil {
+		t.Error(err)
+	}
+	if err := indexer.Update(&Book{ID: 1}, external(10)); !errors.Is(err, elsearm.ErrVersionConflict) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.Update(&Book{ID: 1}, indexer.Q.Index.WithVersion(11)); err == nil {
+		t.Errorf("internal versioning should be rejected")
+	}
+}
+
+func TestCluster_search(t *testing.T) {
+	_, indexer := newIndexer(t)
+	seed(t, indexer)
+
+	tests := []struct {
+		name  string
+		query query.Query
+		wants []int
+	}{
+		{"match_all", query.MatchAll(), []int{1, 2, 3}},
+		{"term", query.Term("tags", "go"), []int{1, 3}},
+		{"term keyword", query.Term("title.keyword", "Learning Go"), []int{3}},
+		{"ids", query.IDs("3", "1"), []int{1, 3}},
+		{"match", query.Match("title", "go action"), []int{1, 2, 3}},
+		{"range", query.Range("rating").Gte(4), []int{1, 2}},
+		{"bool", query.Bool().
+			Must(query.Term("tags", "go")).
+			MustNot(query.Term("id", 1)), []int{3}},
+		{"bool should", query.Bool().
+			Should(query.Term("id", 1), query.Term("id", 2)).
+			Filter(query.Range("rating").Lt(5)), []int{2, 3}},
+		{"bool minimum_should_match", query.Bool().
+			Should(query.Term("id", 1), query.Term("id", 2)).
+			Filter(query.Range("rating").Lt(5)).
+			MinimumShouldMatch(1), []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var books []Book
+			result, err := indexer.Search(&books, query.Search(tt.query))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Total != len(tt.wants) || len(books) != len(tt.wants) {
+				t.Fatalf("invalid result: got %#v", books)
+			}
+			for i, id := range tt.wants {
+				if books[i].ID != id {
+					t.Errorf("invalid result: got %#v", books)
+				}
+			}
+		})
+	}
+
+	source := query.NewSearchSource().
+		Sort("rating", "asc").
+		Size(2).
+		Aggregation("tags", query.TermsAgg("tags"))
+
+	var books []Book
+	result, err := indexer.Search(&books, source.SearchRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 3 || len(books) != 2 || books[0].ID != 3 || books[1].ID != 2 {
+		t.Errorf("invalid result: got %#v", books)
+	}
+	tags, err := result.Aggregations.Terms("tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags.Buckets) != 3 || tags.Buckets[0].Key != "go" || tags.Buckets[0].DocCount != 2 {
+		t.Errorf("invalid aggregation: got %#v", tags)
+	}
+}
+
+func TestCluster_scroll(t *testing.T) {
+	_, indexer := newIndexer(t)
+	seed(t, indexer)
+
+	var books []Book
+	result, err := indexer.Search(&books, indexer.Q.Search.WithSize(2), indexer.Q.Search.WithScroll(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 || result.ScrollID == "" {
+		t.Fatalf("invalid result: got %#v", books)
+	}
+
+	books = nil
+	result, err = indexer.Scroll(&books, indexer.Q.Scroll.WithScrollID(result.ScrollID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 || books[0].ID != 3 || result.Total != 3 {
+		t.Errorf("invalid result: got %#v", books)
+	}
+
+	books = nil
+	if _, err := indexer.Scroll(&books, indexer.Q.Scroll.WithScrollID(result.ScrollID)); err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 0 {
+		t.Errorf("invalid result: got %#v", books)
+	}
+
+	if err := indexer.Do(&esapi.ClearScrollRequest{ScrollID: []string{result.ScrollID}}); err != nil {
+		t.Error(err)
+	}
+	if _, err := indexer.Scroll(&books, indexer.Q.Scroll.WithScrollID(result.ScrollID)); err == nil {
+		t.Errorf("Scroll should fail but succeeded")
+	}
+}
+
+func TestCluster_bulk(t *testing.T) {
+	cluster, indexer := newIndexer(t)
+	seed(t, indexer)
+
+	client, err := cluster.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bulk, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{Client: client, NumWorkers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failures []string
+	onFailure := func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+		failures = append(failures, item.DocumentID+":"+res.Error.Type)
+	}
+	items := []esutil.BulkIndexerItem{
+		{Action: "index", Index: "book", DocumentID: "4", Body: strings.NewReader(`{"id":4,"title":"Go in Action"}`)},
+		{Action: "create", Index: "book", DocumentID: "1", Body: strings.NewReader(`{"id":1}`)},
+		{Action: "update", Index: "book", DocumentID: "3", Body: strings.NewReader(`{"doc":{"rating":5}}`)},
+		{Action: "delete", Index: "book", DocumentID: "2"},
+		{Action: "delete", Index: "book", DocumentID: "5"},
+	}
+	for _, item := range items {
+		item.OnFailure = onFailure
+		if err := bulk.Add(context.Background(), item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bulk.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := bulk.Stats(); stats.NumFlushed != 3 || stats.NumFailed != 2 {
+		t.Errorf("invalid stats: got %#v", stats)
+	}
+	if len(failures) != 2 || failures[0] != "1:version_conflict_engine_exception" || failures[1] != "5:" {
+		t.Errorf("invalid failures: got %v", failures)
+	}
+
+	var books []Book
+	if _, err := indexer.Search(&books); err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 3 || books[0].ID != 1 || books[1].ID != 3 || books[1].Rating != 5 || books[2].ID != 4 {
+		t.Errorf("invalid result: got %#v", books)
+	}
+}
+
+func TestCluster_Reset(t *testing.T) {
+	cluster, indexer := newIndexer(t)
+	seed(t, indexer)
+
+	cluster.Reset()
+	if _, err := indexer.Count(&Book{}); !errors.Is(err, elsearm.ErrIndexNotFound) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
@@ -0,0 +1,466 @@
+package elsearmtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+// primaryTerm is the primary term of all documents, since the cluster has no replicas and never fails over.
+const primaryTerm = 1
+
+func (c *Cluster) get(name string, id string) (int, interface{}, *esError) {
+	idx, err := c.readIndex(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	doc := idx.docs[id]
+	if doc == nil {
+		return http.StatusNotFound, map[string]interface{}{
+			"_index": idx.name,
+			"_type":  "_doc",
+			"_id":    id,
+			"found":  false,
+		}, nil
+	}
+	return http.StatusOK, map[string]interface{}{
+		"_index":        idx.name,
+		"_type":         "_doc",
+		"_id":           id,
+		"_version":      doc.version,
+		"_seq_no":       doc.seqNo,
+		"_primary_term": primaryTerm,
+		"found":         true,
+		"_source":       doc.source,
+	}, nil
+}
+
+func (c *Cluster) mget(req *request, name string) (int, interface{}, *esError) {
+	var body struct {
+		IDs  []string `json:"ids"`
+		Docs []struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		} `json:"docs"`
+	}
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	for _, id := range body.IDs {
+		body.Docs = append(body.Docs, struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}{ID: id})
+	}
+
+	docs := make([]interface{}, 0, len(body.Docs))
+	for _, d := range body.Docs {
+		indexName := d.Index
+		if indexName == "" {
+			indexName = name
+		}
+		_, res, err := c.get(indexName, d.ID)
+		if err != nil {
+			docs = append(docs, map[string]interface{}{
+				"_index": indexName,
+				"_type":  "_doc",
+				"_id":    d.ID,
+				"error":  err.cause(),
+			})
+			continue
+		}
+		docs = append(docs, res)
+	}
+	return http.StatusOK, map[string]interface{}{"docs": docs}, nil
+}
+
+func (c *Cluster) index(name string, id string, body []byte, create bool, cond conditions) (int, map[string]interface{}, *esError) {
+	fields, err := decodeSource(body)
+	if err != nil {
+		return 0, nil, err
+	}
+	idx, err := c.writeIndex(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	if id == "" {
+		id = newID()
+	}
+	if doc := idx.docs[id]; doc != nil && create {
+		return 0, nil, &esError{
+			status: http.StatusConflict,
+			typ:    "version_conflict_engine_exception",
+			reason: fmt.Sprintf("[%s]: version conflict, document already exists (current version [%d])", id, doc.version),
+			index:  idx.name,
+		}
+	}
+	if err := cond.check(idx, id); err != nil {
+		return 0, nil, err
+	}
+
+	doc, created := c.put(idx, id, body, fields)
+	cond.apply(doc)
+	status, result := http.StatusOK, "updated"
+	if created {
+		status, result = http.StatusCreated, "created"
+	}
+	return status, writeResult(idx, doc, result), nil
+}
+
+func (c *Cluster) update(name string, id string, body []byte, cond conditions) (int, map[string]interface{}, *esError) {
+	var update struct {
+		Doc            map[string]interface{} `json:"doc"`
+		DocAsUpsert    bool                   `json:"doc_as_upsert"`
+		Upsert         map[string]interface{} `json:"upsert"`
+		Script         json.RawMessage        `json:"script"`
+		ScriptedUpsert bool                   `json:"scripted_upsert"`
+	}
+	if err := json.Unmarshal(body, &update); err != nil {
+		return 0, nil, newError(http.StatusBadRequest, "x_content_parse_exception", err.Error())
+	}
+
+	var s *script
+	if len(update.Script) > 0 {
+		var err *esError
+		if s, err = parseScript(update.Script); err != nil {
+			return 0, nil, err
+		}
+	} else if update.Doc == nil {
+		return 0, nil, newError(http.StatusBadRequest, "action_request_validation_exception",
+			"Validation Failed: 1: script or doc is missing;")
+	}
+
+	idx, err := c.writeIndex(name)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if cond.Version != nil {
+		return 0, nil, newError(http.StatusBadRequest, "action_request_validation_exception",
+			"Validation Failed: 1: can't provide version in update request;")
+	}
+	if err := cond.check(idx, id); err != nil {
+		return 0, nil, err
+	}
+
+	doc := idx.docs[id]
+	var fields map[string]interface{}
+	switch {
+	case doc != nil && s != nil:
+		fields = copyFields(doc.fields)
+		op, err := s.run(fields)
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case "delete":
+			return c.delete(idx.name, id, conditions{})
+		case "none", "noop":
+			return http.StatusOK, writeResult(idx, doc, "noop"), nil
+		}
+	case doc != nil:
+		fields = mergeFields(copyFields(doc.fields), update.Doc)
+	case update.Upsert != nil:
+		fields = update.Upsert
+		if s != nil && update.ScriptedUpsert {
+			if _, err := s.run(fields); err != nil {
+				return 0, nil, err
+			}
+		}
+	case update.DocAsUpsert && update.Doc != nil:
+		fields = update.Doc
+	default:
+		return 0, nil, &esError{
+			status: http.StatusNotFound,
+			typ:    "document_missing_exception",
+			reason: fmt.Sprintf("[_doc][%s]: document missing", id),
+			index:  idx.name,
+		}
+	}
+	if doc != nil && reflect.DeepEqual(fields, doc.fields) {
+		return http.StatusOK, writeResult(idx, doc, "noop"), nil
+	}
+
+	source, e := json.Marshal(fields)
+	if e != nil {
+		return 0, nil, newError(http.StatusBadRequest, "mapper_parsing_exception", e.Error())
+	}
+	doc, created := c.put(idx, id, source, fields)
+	status, result := http.StatusOK, "updated"
+	if created {
+		status, result = http.StatusCreated, "created"
+	}
+	return status, writeResult(idx, doc, result), nil
+}
+
+func (c *Cluster) delete(name string, id string, cond conditions) (int, map[string]interface{}, *esError) {
+	idx, err := c.readIndex(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := cond.check(idx, id); err != nil {
+		return 0, nil, err
+	}
+	doc := idx.docs[id]
+	if doc == nil {
+		idx.seqNo++
+		return http.StatusNotFound, writeResult(idx, &document{id: id, version: 1, seqNo: idx.seqNo}, "not_found"), nil
+	}
+	delete(idx.docs, id)
+	idx.seqNo++
+	doc.version++
+	doc.seqNo = idx.seqNo
+	cond.apply(doc)
+	return http.StatusOK, writeResult(idx, doc, "deleted"), nil
+}
+
+// put stores the document, and returns true if it is created.
+func (c *Cluster) put(idx *index, id string, source []byte, fields map[string]interface{}) (*document, bool) {
+	idx.seqNo++
+	doc := idx.docs[id]
+	created := doc == nil
+	if created {
+		doc = &document{id: id, order: c.nextOrder()}
+		idx.docs[id] = doc
+	}
+	doc.source = append(json.RawMessage(nil), bytes.TrimSpace(source)...)
+	doc.fields = fields
+	doc.version++
+	doc.seqNo = idx.seqNo
+	return doc, created
+}
+
+func (c *Cluster) reindex(req *request) (int, interface{}, *esError) {
+	var body struct {
+		Source struct {
+			Index interface{}            `json:"index"`
+			Query map[string]interface{} `json:"query"`
+		} `json:"source"`
+		Dest struct {
+			Index  string `json:"index"`
+			OpType string `json:"op_type"`
+		} `json:"dest"`
+		Conflicts string `json:"conflicts"`
+	}
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+
+	var expr string
+	switch v := body.Source.Index.(type) {
+	case string:
+		expr = v
+	case []interface{}:
+		for i, name := range v {
+			if i > 0 {
+				expr += ","
+			}
+			expr += fmt.Sprint(name)
+		}
+	}
+	if _, err := c.resolve(expr, false); err != nil {
+		return 0, nil, err
+	}
+
+	description := fmt.Sprintf("reindex from [%s] to [%s]", expr, body.Dest.Index)
+	return c.startTask(req, "indices:data/write/reindex", description, byQueryStatus(req),
+		func(t *task) (map[string]interface{}, *esError) {
+			docs, err := c.searchDocs(expr, body.Source.Query, false)
+			if err != nil {
+				return nil, err
+			}
+
+			t.status["total"] = len(docs)
+			created, updated, conflicts := 0, 0, 0
+			var failures []interface{}
+			for _, d := range docs {
+				status, _, err := c.index(body.Dest.Index, d.doc.id, d.doc.source, body.Dest.OpType == "create", conditions{})
+				if err != nil {
+					if err.status != http.StatusConflict {
+						return nil, err
+					}
+					// NOTE: the reindex is aborted by the first version conflict unless conflicts=proceed.
+					conflicts++
+					if body.Conflicts == "proceed" {
+						continue
+					}
+					failures = append(failures, map[string]interface{}{
+						"index":  body.Dest.Index,
+						"type":   "_doc",
+						"id":     d.doc.id,
+						"cause":  err.cause(),
+						"status": err.status,
+					})
+					break
+				}
+				if status == http.StatusCreated {
+					created++
+				} else {
+					updated++
+				}
+			}
+			t.status["created"] = created
+			t.status["updated"] = updated
+			t.status["version_conflicts"] = conflicts
+			t.status["batches"] = batches(len(docs))
+			res := byQueryResponse(t)
+			if len(failures) > 0 {
+				res["failures"] = failures
+			}
+			return res, nil
+		})
+}
+
+// conditions are the parameters of the optimistic concurrency control of the write request.
+type conditions struct {
+	IfSeqNo       *int64 `json:"if_seq_no"`
+	IfPrimaryTerm *int64 `json:"if_primary_term"`
+	Version       *int64 `json:"version"`
+	VersionType   string `json:"version_type"`
+}
+
+func parseConditions(req *request) (conditions, *esError) {
+	cond := conditions{VersionType: req.param("version_type")}
+	for name, p := range map[string]**int64{"if_seq_no": &cond.IfSeqNo, "if_primary_term": &cond.IfPrimaryTerm, "version": &cond.Version} {
+		value := req.param(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return cond, newError(http.StatusBadRequest, "illegal_argument_exception",
+				fmt.Sprintf("Failed to parse value [%s] for [%s]", value, name))
+		}
+		*p = &n
+	}
+	return cond, nil
+}
+
+// check returns a version conflict error if the document does not satisfy the conditions.
+func (cond conditions) check(idx *index, id string) *esError {
+	if cond.Version != nil {
+		return cond.checkVersion(idx, id)
+	}
+	if cond.IfSeqNo == nil && cond.IfPrimaryTerm == nil {
+		return nil
+	}
+	if cond.IfSeqNo == nil || cond.IfPrimaryTerm == nil {
+		return newError(http.StatusBadRequest, "action_request_validation_exception",
+			"Validation Failed: 1: ifSeqNo is set, but primary term is [0];")
+	}
+
+	required := fmt.Sprintf("[%s]: version conflict, required seqNo [%d], primary term [%d]", id, *cond.IfSeqNo, *cond.IfPrimaryTerm)
+	doc := idx.docs[id]
+	if doc == nil {
+		return &esError{
+			status: http.StatusConflict,
+			typ:    "version_conflict_engine_exception",
+			reason: required + " but no document was found",
+			index:  idx.name,
+		}
+	}
+	if doc.seqNo != *cond.IfSeqNo || *cond.IfPrimaryTerm != primaryTerm {
+		return &esError{
+			status: http.StatusConflict,
+			typ:    "version_conflict_engine_exception",
+			reason: fmt.Sprintf("%s. current document has seqNo [%d] and primary term [%d]", required, doc.seqNo, primaryTerm),
+			index:  idx.name,
+		}
+	}
+	return nil
+}
+
+// checkVersion checks the external version. The internal versioning is not supported, same as Elasticsearch 7.x.
+func (cond conditions) checkVersion(idx *index, id string) *esError {
+	if cond.IfSeqNo != nil || cond.IfPrimaryTerm != nil {
+		return newError(http.StatusBadRequest, "action_request_validation_exception",
+			"Validation Failed: 1: compare and write operations can not be used with version type ["+cond.VersionType+"];")
+	}
+	if cond.VersionType != "external" && cond.VersionType != "external_gte" {
+		return newError(http.StatusBadRequest, "action_request_validation_exception",
+			"Validation Failed: 1: internal versioning can not be used for optimistic concurrency control. "+
+				"Please use `if_seq_no` and `if_primary_term` instead;")
+	}
+	if *cond.Version < 0 {
+		return newError(http.StatusBadRequest, "action_request_validation_exception",
+			fmt.Sprintf("Validation Failed: 1: illegal version value [%d] for version type [%s];", *cond.Version, cond.VersionType))
+	}
+
+	doc := idx.docs[id]
+	if doc == nil {
+		return nil
+	}
+	if *cond.Version > doc.version || (cond.VersionType == "external_gte" && *cond.Version == doc.version) {
+		return nil
+	}
+	relation := "higher or equal to"
+	if cond.VersionType == "external_gte" {
+		relation = "higher than"
+	}
+	return &esError{
+		status: http.StatusConflict,
+		typ:    "version_conflict_engine_exception",
+		reason: fmt.Sprintf("[%s]: version conflict, current version [%d] is %s the one provided [%d]", id, doc.version, relation, *cond.Version),
+		index:  idx.name,
+	}
+}
+
+// apply sets the external version to the written document.
+func (cond conditions) apply(doc *document) {
+	if cond.Version != nil {
+		doc.version = *cond.Version
+	}
+}
+
+func writeResult(idx *index, doc *document, result string) map[string]interface{} {
+	return map[string]interface{}{
+		"_index":        idx.name,
+		"_type":         "_doc",
+		"_id":           doc.id,
+		"_version":      doc.version,
+		"result":        result,
+		"_shards":       shards(),
+		"_seq_no":       doc.seqNo,
+		"_primary_term": primaryTerm,
+	}
+}
+
+func decodeSource(body []byte) (map[string]interface{}, *esError) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		reason := "failed to parse"
+		if err != nil {
+			reason += ": " + err.Error()
+		}
+		return nil, newError(http.StatusBadRequest, "mapper_parsing_exception", reason)
+	}
+	return fields, nil
+}
+
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if m, ok := v.(map[string]interface{}); ok {
+			v = copyFields(m)
+		}
+		copied[k] = v
+	}
+	return copied
+}
+
+// mergeFields merges the partial document into the fields recursively.
+func mergeFields(fields map[string]interface{}, partial map[string]interface{}) map[string]interface{} {
+	for k, v := range partial {
+		src, ok1 := fields[k].(map[string]interface{})
+		dst, ok2 := v.(map[string]interface{})
+		if ok1 && ok2 {
+			fields[k] = mergeFields(src, dst)
+			continue
+		}
+		fields[k] = v
+	}
+	return fields
+}
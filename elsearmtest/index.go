@@ -0,0 +1,405 @@
+package elsearmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+type index struct {
+	name     string
+	mappings json.RawMessage
+	settings json.RawMessage
+	// The key is an alias name, and the value is whether the index is the write index of the alias.
+	aliases map[string]bool
+	docs    map[string]*document
+	seqNo   int64
+}
+
+type document struct {
+	id      string
+	source  json.RawMessage
+	fields  map[string]interface{}
+	version int64
+	seqNo   int64
+	order   int64
+}
+
+func newIndex(name string) *index {
+	return &index{
+		name:    name,
+		aliases: make(map[string]bool),
+		docs:    make(map[string]*document),
+	}
+}
+
+// sortedDocs returns the documents in the order of insertion.
+func (idx *index) sortedDocs() []*document {
+	docs := make([]*document, 0, len(idx.docs))
+	for _, doc := range idx.docs {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].order < docs[j].order })
+	return docs
+}
+
+func (c *Cluster) aliasIndices(alias string) []*index {
+	var indices []*index
+	for _, name := range sortedKeys(c.indices) {
+		if _, ok := c.indices[name].aliases[alias]; ok {
+			indices = append(indices, c.indices[name])
+		}
+	}
+	return indices
+}
+
+// resolve returns the indices of the expression, which consists of comma separated index names, aliases and wildcards.
+func (c *Cluster) resolve(expr string, ignoreUnavailable bool) ([]*index, *esError) {
+	found := make(map[string]*index)
+	for _, name := range strings.Split(expr, ",") {
+		switch {
+		case name == "" || name == "_all":
+			for k, idx := range c.indices {
+				found[k] = idx
+			}
+		case strings.Contains(name, "*"):
+			for k, idx := range c.indices {
+				if ok, _ := path.Match(name, k); ok {
+					found[k] = idx
+					continue
+				}
+				for alias := range idx.aliases {
+					if ok, _ := path.Match(name, alias); ok {
+						found[k] = idx
+					}
+				}
+			}
+		case c.indices[name] != nil:
+			found[name] = c.indices[name]
+		default:
+			indices := c.aliasIndices(name)
+			if len(indices) == 0 && !ignoreUnavailable {
+				return nil, indexNotFound(name)
+			}
+			for _, idx := range indices {
+				found[idx.name] = idx
+			}
+		}
+	}
+
+	indices := make([]*index, 0, len(found))
+	for _, name := range sortedKeys(found) {
+		indices = append(indices, found[name])
+	}
+	return indices, nil
+}
+
+// readIndex returns the index to read a document.
+func (c *Cluster) readIndex(name string) (*index, *esError) {
+	if idx := c.indices[name]; idx != nil {
+		return idx, nil
+	}
+	indices := c.aliasIndices(name)
+	switch len(indices) {
+	case 0:
+		return nil, indexNotFound(name)
+	case 1:
+		return indices[0], nil
+	}
+	return nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+		fmt.Sprintf("alias [%s] has more than one index associated with it, can't execute a single index op", name))
+}
+
+// writeIndex returns the index to write a document. If the index does not exist, it is created automatically.
+func (c *Cluster) writeIndex(name string) (*index, *esError) {
+	if idx := c.indices[name]; idx != nil {
+		return idx, nil
+	}
+	indices := c.aliasIndices(name)
+	if len(indices) == 1 {
+		return indices[0], nil
+	}
+	for _, idx := range indices {
+		if idx.aliases[name] {
+			return idx, nil
+		}
+	}
+	if len(indices) > 1 {
+		return nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+			fmt.Sprintf("no write index is defined for alias [%s]", name))
+	}
+	if err := validateIndexName(name); err != nil {
+		return nil, err
+	}
+	idx := newIndex(name)
+	c.indices[name] = idx
+	return idx, nil
+}
+
+func validateIndexName(name string) *esError {
+	if name == "" || strings.ToLower(name) != name || strings.ContainsAny(name, `\/*?"<>| ,#:`) ||
+		strings.HasPrefix(name, "_") || strings.HasPrefix(name, "-") || strings.HasPrefix(name, "+") {
+		return &esError{
+			status: http.StatusBadRequest,
+			typ:    "invalid_index_name_exception",
+			reason: fmt.Sprintf("Invalid index name [%s]", name),
+			index:  name,
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) existsIndex(req *request, expr string) (int, interface{}, *esError) {
+	indices, err := c.resolve(expr, req.boolParam("ignore_unavailable"))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(indices) == 0 && !req.boolParam("allow_no_indices") {
+		return 0, nil, indexNotFound(expr)
+	}
+	return http.StatusOK, nil, nil
+}
+
+func (c *Cluster) createIndex(req *request, name string) (int, interface{}, *esError) {
+	if c.indices[name] != nil {
+		return 0, nil, &esError{
+			status: http.StatusBadRequest,
+			typ:    "resource_already_exists_exception",
+			reason: fmt.Sprintf("index [%s] already exists", name),
+			index:  name,
+		}
+	}
+	if len(c.aliasIndices(name)) > 0 {
+		return 0, nil, &esError{
+			status: http.StatusBadRequest,
+			typ:    "invalid_index_name_exception",
+			reason: fmt.Sprintf("Invalid index name [%s], already exists as alias", name),
+			index:  name,
+		}
+	}
+	if err := validateIndexName(name); err != nil {
+		return 0, nil, err
+	}
+
+	var body struct {
+		Mappings json.RawMessage `json:"mappings"`
+		Settings json.RawMessage `json:"settings"`
+		Aliases  map[string]struct {
+			IsWriteIndex bool `json:"is_write_index"`
+		} `json:"aliases"`
+	}
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+
+	idx := newIndex(name)
+	idx.mappings = body.Mappings
+	idx.settings = body.Settings
+	for alias, opts := range body.Aliases {
+		idx.aliases[alias] = opts.IsWriteIndex
+	}
+	c.indices[name] = idx
+
+	return http.StatusOK, map[string]interface{}{
+		"acknowledged":        true,
+		"shards_acknowledged": true,
+		"index":               name,
+	}, nil
+}
+
+func (c *Cluster) deleteIndex(req *request, expr string) (int, interface{}, *esError) {
+	var names []string
+	for _, name := range strings.Split(expr, ",") {
+		switch {
+		case strings.Contains(name, "*") || name == "_all":
+			for k := range c.indices {
+				if ok, _ := path.Match(name, k); ok || name == "_all" {
+					names = append(names, k)
+				}
+			}
+		case c.indices[name] != nil:
+			names = append(names, name)
+		case len(c.aliasIndices(name)) > 0:
+			return 0, nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+				fmt.Sprintf("The provided expression [%s] matches an alias, specify the corresponding concrete indices instead.", name))
+		case !req.boolParam("ignore_unavailable"):
+			return 0, nil, indexNotFound(name)
+		}
+	}
+	for _, name := range names {
+		delete(c.indices, name)
+	}
+	return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+}
+
+func (c *Cluster) getIndex(req *request, expr string) (int, interface{}, *esError) {
+	indices, err := c.resolve(expr, req.boolParam("ignore_unavailable"))
+	if err != nil {
+		return 0, nil, err
+	}
+	res := make(map[string]interface{})
+	for _, idx := range indices {
+		mappings, settings := idx.mappings, idx.settings
+		if len(mappings) == 0 {
+			mappings = json.RawMessage("{}")
+		}
+		if len(settings) == 0 {
+			settings = json.RawMessage("{}")
+		}
+		res[idx.name] = map[string]interface{}{
+			"aliases":  aliasesSource(idx.aliases, nil),
+			"mappings": mappings,
+			"settings": settings,
+		}
+	}
+	return http.StatusOK, res, nil
+}
+
+func (c *Cluster) getAlias(req *request, expr string, names []string) (int, interface{}, *esError) {
+	indices, err := c.resolve(expr, req.boolParam("ignore_unavailable"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var patterns []string
+	if len(names) > 0 {
+		patterns = strings.Split(names[0], ",")
+	}
+
+	res := make(map[string]interface{})
+	for _, idx := range indices {
+		aliases := aliasesSource(idx.aliases, patterns)
+		if patterns != nil && len(aliases) == 0 {
+			continue
+		}
+		res[idx.name] = map[string]interface{}{"aliases": aliases}
+	}
+	if patterns != nil && len(res) == 0 {
+		return 0, nil, newError(http.StatusNotFound, "aliases_not_found_exception",
+			fmt.Sprintf("aliases [%s] missing", strings.Join(patterns, ",")))
+	}
+	return http.StatusOK, res, nil
+}
+
+func aliasesSource(aliases map[string]bool, patterns []string) map[string]interface{} {
+	res := make(map[string]interface{})
+	for alias, isWriteIndex := range aliases {
+		if patterns != nil && !matchAny(patterns, alias) {
+			continue
+		}
+		opts := map[string]interface{}{}
+		if isWriteIndex {
+			opts["is_write_index"] = true
+		}
+		res[alias] = opts
+	}
+	return res
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok || pattern == "_all" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cluster) updateAliases(req *request) (int, interface{}, *esError) {
+	var body struct {
+		Actions []map[string]struct {
+			Index        string   `json:"index"`
+			Indices      []string `json:"indices"`
+			Alias        string   `json:"alias"`
+			Aliases      []string `json:"aliases"`
+			IsWriteIndex bool     `json:"is_write_index"`
+		} `json:"actions"`
+	}
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+
+	// NOTE: the actions are applied atomically.
+	snapshot := make(map[string]*index, len(c.indices))
+	aliases := make(map[*index]map[string]bool, len(c.indices))
+	for name, idx := range c.indices {
+		snapshot[name] = idx
+		aliases[idx] = make(map[string]bool, len(idx.aliases))
+		for alias, isWriteIndex := range idx.aliases {
+			aliases[idx][alias] = isWriteIndex
+		}
+	}
+	rollback := func() {
+		c.indices = snapshot
+		for idx, a := range aliases {
+			idx.aliases = a
+		}
+	}
+
+	for _, action := range body.Actions {
+		for typ, opts := range action {
+			indexNames := append(opts.Indices, opts.Index)
+			aliasNames := append(opts.Aliases, opts.Alias)
+
+			var indices []*index
+			for _, name := range indexNames {
+				if name == "" {
+					continue
+				}
+				if typ == "remove_index" || !strings.Contains(name, "*") {
+					idx := c.indices[name]
+					if idx == nil {
+						rollback()
+						return 0, nil, indexNotFound(name)
+					}
+					indices = append(indices, idx)
+					continue
+				}
+				for _, k := range sortedKeys(c.indices) {
+					if ok, _ := path.Match(name, k); ok {
+						indices = append(indices, c.indices[k])
+					}
+				}
+			}
+
+			for _, idx := range indices {
+				switch typ {
+				case "add":
+					for _, alias := range aliasNames {
+						if alias == "" {
+							continue
+						}
+						if c.indices[alias] != nil {
+							rollback()
+							return 0, nil, newError(http.StatusBadRequest, "invalid_alias_name_exception",
+								fmt.Sprintf("Invalid alias name [%s], an index exists with the same name as the alias", alias))
+						}
+						idx.aliases[alias] = opts.IsWriteIndex
+					}
+				case "remove":
+					for _, alias := range aliasNames {
+						if alias == "" {
+							continue
+						}
+						if _, ok := idx.aliases[alias]; !ok {
+							rollback()
+							return 0, nil, newError(http.StatusNotFound, "aliases_not_found_exception",
+								fmt.Sprintf("aliases [%s] missing", alias))
+						}
+						delete(idx.aliases, alias)
+					}
+				case "remove_index":
+					delete(c.indices, idx.name)
+				default:
+					rollback()
+					return 0, nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+						fmt.Sprintf("unsupported action [%s]", typ))
+				}
+			}
+		}
+	}
+	return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+}
@@ -0,0 +1,316 @@
+package elsearmtest
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// matches returns true if the document matches the query. If the query is nil, it is treated as match_all.
+func matches(q map[string]interface{}, doc *document) (bool, *esError) {
+	if len(q) == 0 {
+		return true, nil
+	}
+	if len(q) > 1 {
+		return false, newError(http.StatusBadRequest, "parsing_exception",
+			"[_na] query malformed, no start_object after query name")
+	}
+
+	for typ, v := range q {
+		params, _ := v.(map[string]interface{})
+		switch typ {
+		case "match_all":
+			return true, nil
+		case "match_none":
+			return false, nil
+		case "bool":
+			return matchBool(params, doc)
+		case "ids":
+			values, _ := params["values"].([]interface{})
+			for _, id := range values {
+				if fmt.Sprint(id) == doc.id {
+					return true, nil
+				}
+			}
+			return false, nil
+		case "exists":
+			field, _ := params["field"].(string)
+			return len(fieldValues(doc, field)) > 0, nil
+		}
+
+		field, value, opts, err := fieldParams(typ, params)
+		if err != nil {
+			return false, err
+		}
+		switch typ {
+		case "term":
+			return containsValue(fieldValues(doc, field), func(v interface{}) bool { return equalValues(v, value) }), nil
+		case "terms":
+			values, _ := value.([]interface{})
+			return containsValue(fieldValues(doc, field), func(v interface{}) bool {
+				for _, value := range values {
+					if equalValues(v, value) {
+						return true
+					}
+				}
+				return false
+			}), nil
+		case "prefix":
+			prefix := fmt.Sprint(value)
+			return containsValue(fieldValues(doc, field), func(v interface{}) bool {
+				s, ok := v.(string)
+				return ok && strings.HasPrefix(s, prefix)
+			}), nil
+		case "wildcard":
+			pattern := fmt.Sprint(value)
+			return containsValue(fieldValues(doc, field), func(v interface{}) bool {
+				s, ok := v.(string)
+				ok2, _ := path.Match(pattern, s)
+				return ok && ok2
+			}), nil
+		case "match":
+			return matchText(fieldValues(doc, field), fmt.Sprint(value), opts["operator"]), nil
+		case "range":
+			return containsValue(fieldValues(doc, field), func(v interface{}) bool { return inRange(v, opts) }), nil
+		}
+		return false, newError(http.StatusBadRequest, "parsing_exception",
+			fmt.Sprintf("elsearmtest does not support [%s] query", typ))
+	}
+	return false, nil
+}
+
+// fieldParams parses the params of the query which is either `{field: value}` or `{field: {"value": value, ...}}`.
+func fieldParams(typ string, params map[string]interface{}) (string, interface{}, map[string]interface{}, *esError) {
+	for field, v := range params {
+		if field == "boost" || field == "_name" {
+			continue
+		}
+		opts, ok := v.(map[string]interface{})
+		if !ok || typ == "terms" {
+			return field, v, map[string]interface{}{}, nil
+		}
+		for _, key := range []string{"value", "query"} {
+			if value, ok := opts[key]; ok {
+				return field, value, opts, nil
+			}
+		}
+		return field, nil, opts, nil
+	}
+	return "", nil, nil, newError(http.StatusBadRequest, "parsing_exception",
+		fmt.Sprintf("[%s] query does not have a field", typ))
+}
+
+func matchBool(params map[string]interface{}, doc *document) (bool, *esError) {
+	clauses := func(key string) []map[string]interface{} {
+		var queries []map[string]interface{}
+		switch v := params[key].(type) {
+		case map[string]interface{}:
+			queries = append(queries, v)
+		case []interface{}:
+			for _, q := range v {
+				if m, ok := q.(map[string]interface{}); ok {
+					queries = append(queries, m)
+				}
+			}
+		}
+		return queries
+	}
+
+	must := append(clauses("must"), clauses("filter")...)
+	for _, q := range must {
+		ok, err := matches(q, doc)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	for _, q := range clauses("must_not") {
+		ok, err := matches(q, doc)
+		if err != nil || ok {
+			return false, err
+		}
+	}
+
+	should := clauses("should")
+	minimumShouldMatch := 0
+	if len(should) > 0 && len(must) == 0 {
+		minimumShouldMatch = 1
+	}
+	switch v := params["minimum_should_match"].(type) {
+	case float64:
+		minimumShouldMatch = int(v)
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			minimumShouldMatch = n
+		}
+	}
+
+	matched := 0
+	for _, q := range should {
+		ok, err := matches(q, doc)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matched++
+		}
+	}
+	return matched >= minimumShouldMatch, nil
+}
+
+func matchText(values []interface{}, text string, operator interface{}) bool {
+	tokens := make(map[string]bool)
+	for _, v := range values {
+		for _, token := range analyze(fmt.Sprint(v)) {
+			tokens[token] = true
+		}
+	}
+
+	queryTokens := analyze(text)
+	if len(queryTokens) == 0 {
+		return false
+	}
+	and := strings.EqualFold(fmt.Sprint(operator), "and")
+	for _, token := range queryTokens {
+		if tokens[token] && !and {
+			return true
+		}
+		if !tokens[token] && and {
+			return false
+		}
+	}
+	return and
+}
+
+// analyze splits the text into lowercase tokens like the standard analyzer.
+func analyze(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func inRange(v interface{}, opts map[string]interface{}) bool {
+	for op, bound := range opts {
+		cmp, ok := compareValues(v, bound)
+		switch op {
+		case "gt":
+			ok = ok && cmp > 0
+		case "gte", "from":
+			ok = ok && cmp >= 0
+		case "lt":
+			ok = ok && cmp < 0
+		case "lte", "to":
+			ok = ok && cmp <= 0
+		default:
+			continue
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func containsValue(values []interface{}, f func(v interface{}) bool) bool {
+	for _, v := range values {
+		if f(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldValues returns the values of the field. The values of arrays are flattened.
+// If the field ends with .keyword and it is not found, the value of the parent field is used.
+func fieldValues(doc *document, field string) []interface{} {
+	if field == "_id" {
+		return []interface{}{doc.id}
+	}
+
+	values := lookup(doc.fields, strings.Split(field, "."))
+	if len(values) == 0 && strings.HasSuffix(field, ".keyword") {
+		values = lookup(doc.fields, strings.Split(strings.TrimSuffix(field, ".keyword"), "."))
+	}
+	return values
+}
+
+func lookup(v interface{}, keys []string) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		var values []interface{}
+		for _, elem := range v {
+			values = append(values, lookup(elem, keys)...)
+		}
+		return values
+	case map[string]interface{}:
+		if len(keys) == 0 {
+			return nil
+		}
+		// NOTE: the field name may contain dots.
+		for i := len(keys); i > 0; i-- {
+			if child, ok := v[strings.Join(keys[:i], ".")]; ok {
+				return lookup(child, keys[i:])
+			}
+		}
+		return nil
+	}
+	if len(keys) > 0 {
+		return nil
+	}
+	return []interface{}{v}
+}
+
+func equalValues(a interface{}, b interface{}) bool {
+	cmp, ok := compareValues(a, b)
+	return ok && cmp == 0
+}
+
+// compareValues compares the values. The numbers are compared as numbers even if they are strings.
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	af, aIsNum := toNumber(a)
+	bf, bIsNum := toNumber(b)
+	if aIsNum && bIsNum {
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return strings.Compare(a, b), ok
+	case bool:
+		b, ok := b.(bool)
+		if !ok || a == b {
+			return 0, ok
+		}
+		if !a {
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,164 @@
+package elsearmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	assignStatement = regexp.MustCompile(`^ctx\.(_source(?:\.\w+)+|op)\s*(=|\+=|-=)\s*(.+)$`)
+	addStatement    = regexp.MustCompile(`^ctx\._source((?:\.\w+)+)\.add\((.+)\)$`)
+	removeStatement = regexp.MustCompile(`^ctx\._source\.remove\((.+)\)$`)
+)
+
+type script struct {
+	Source string                 `json:"source"`
+	Lang   string                 `json:"lang"`
+	Params map[string]interface{} `json:"params"`
+}
+
+func parseScript(raw json.RawMessage) (*script, *esError) {
+	var s script
+	if err := json.Unmarshal(raw, &s.Source); err == nil {
+		return &s, nil
+	}
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, newError(http.StatusBadRequest, "x_content_parse_exception", err.Error())
+	}
+	if s.Lang != "" && s.Lang != "painless" {
+		return nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+			fmt.Sprintf("script_lang not supported [%s]", s.Lang))
+	}
+	return &s, nil
+}
+
+// run executes the script on the fields, and returns the operation. (e.g. index, noop and delete)
+// It supports only a small subset of painless, which are the statements like the following.
+//
+//	ctx._source.field = params.value
+//	ctx._source.field += 1
+//	ctx._source.list.add(params.value)
+//	ctx._source.remove('field')
+//	ctx.op = 'delete'
+func (s *script) run(fields map[string]interface{}) (string, *esError) {
+	op := "index"
+	for _, stmt := range strings.Split(s.Source, ";") {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" {
+			continue
+		}
+
+		if m := assignStatement.FindStringSubmatch(stmt); m != nil {
+			value, err := s.eval(m[3], fields)
+			if err != nil {
+				return "", err
+			}
+			if m[1] == "op" {
+				op = fmt.Sprint(value)
+				continue
+			}
+
+			path := strings.Split(m[1], ".")[1:]
+			if m[2] != "=" {
+				current := getField(fields, path)
+				if value, err = arithmetic(current, value, m[2]); err != nil {
+					return "", err
+				}
+			}
+			setField(fields, path, value)
+			continue
+		}
+
+		if m := addStatement.FindStringSubmatch(stmt); m != nil {
+			value, err := s.eval(m[2], fields)
+			if err != nil {
+				return "", err
+			}
+			path := strings.Split(m[1], ".")[1:]
+			list, _ := getField(fields, path).([]interface{})
+			setField(fields, path, append(list, value))
+			continue
+		}
+
+		if m := removeStatement.FindStringSubmatch(stmt); m != nil {
+			value, err := s.eval(m[1], fields)
+			if err != nil {
+				return "", err
+			}
+			delete(fields, fmt.Sprint(value))
+			continue
+		}
+
+		return "", scriptError(stmt)
+	}
+	return op, nil
+}
+
+func (s *script) eval(expr string, fields map[string]interface{}) (interface{}, *esError) {
+	expr = strings.TrimSpace(expr)
+	switch {
+	case expr == "null":
+		return nil, nil
+	case expr == "true" || expr == "false":
+		return expr == "true", nil
+	case len(expr) >= 2 && (expr[0] == '\'' || expr[0] == '"') && expr[len(expr)-1] == expr[0]:
+		return expr[1 : len(expr)-1], nil
+	case strings.HasPrefix(expr, "params."):
+		return getField(s.Params, strings.Split(strings.TrimPrefix(expr, "params."), ".")), nil
+	case strings.HasPrefix(expr, "ctx._source."):
+		return getField(fields, strings.Split(strings.TrimPrefix(expr, "ctx._source."), ".")), nil
+	}
+	if f, err := strconv.ParseFloat(expr, 64); err == nil {
+		return f, nil
+	}
+	return nil, scriptError(expr)
+}
+
+func arithmetic(a interface{}, b interface{}, op string) (interface{}, *esError) {
+	af, ok1 := toNumber(a)
+	bf, ok2 := toNumber(b)
+	if _, isStr := a.(string); isStr && op == "+=" {
+		return a.(string) + fmt.Sprint(b), nil
+	}
+	if !ok1 || !ok2 {
+		return nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+			fmt.Sprintf("cannot apply [%s] to [%v] and [%v]", op, a, b))
+	}
+	if op == "-=" {
+		return af - bf, nil
+	}
+	return af + bf, nil
+}
+
+func getField(fields map[string]interface{}, path []string) interface{} {
+	var v interface{} = fields
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+func setField(fields map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := fields[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			fields[key] = child
+		}
+		fields = child
+	}
+	fields[path[len(path)-1]] = value
+}
+
+func scriptError(stmt string) *esError {
+	return newError(http.StatusBadRequest, "script_exception",
+		fmt.Sprintf("elsearmtest does not support the script [%s]", stmt))
+}
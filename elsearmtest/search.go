@@ -0,0 +1,629 @@
+package elsearmtest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type hit struct {
+	idx  *index
+	doc  *document
+	sort []interface{}
+}
+
+type sortField struct {
+	field string
+	desc  bool
+}
+
+type searchOptions struct {
+	sort             []sortField
+	includes         []string
+	excludes         []string
+	noSource         bool
+	seqNoPrimaryTerm bool
+	version          bool
+}
+
+type pit struct {
+	hits []*hit
+}
+
+type scroll struct {
+	hits  []interface{}
+	size  int
+	total int
+}
+
+type searchBody struct {
+	Query            map[string]interface{}            `json:"query"`
+	From             *int                              `json:"from"`
+	Size             *int                              `json:"size"`
+	Sort             interface{}                       `json:"sort"`
+	Source           interface{}                       `json:"_source"`
+	Aggs             map[string]map[string]interface{} `json:"aggs"`
+	Aggregations     map[string]map[string]interface{} `json:"aggregations"`
+	SeqNoPrimaryTerm bool                              `json:"seq_no_primary_term"`
+	Version          bool                              `json:"version"`
+	SearchAfter      []interface{}                     `json:"search_after"`
+	Slice            *struct {
+		ID  int64 `json:"id"`
+		Max int64 `json:"max"`
+	} `json:"slice"`
+	Pit *struct {
+		ID string `json:"id"`
+	} `json:"pit"`
+}
+
+// searchDocs returns the documents that match the query in the order of insertion.
+func (c *Cluster) searchDocs(expr string, q map[string]interface{}, ignoreUnavailable bool) ([]*hit, *esError) {
+	indices, err := c.resolve(expr, ignoreUnavailable)
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []*hit
+	for _, idx := range indices {
+		for _, doc := range idx.sortedDocs() {
+			hits = append(hits, &hit{idx: idx, doc: doc})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].doc.order < hits[j].doc.order })
+	return filterHits(hits, q)
+}
+
+func filterHits(hits []*hit, q map[string]interface{}) ([]*hit, *esError) {
+	var matched []*hit
+	for _, h := range hits {
+		ok, err := matches(q, h.doc)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, &hit{idx: h.idx, doc: h.doc})
+		}
+	}
+	return matched, nil
+}
+
+// sliceHits returns the hits of the slice. The documents are split by the order of insertion.
+func sliceHits(hits []*hit, id int64, max int64) ([]*hit, *esError) {
+	if max <= 1 || id < 0 || id >= max {
+		return nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+			fmt.Sprintf("invalid slice [id: %d, max: %d]", id, max))
+	}
+	var sliced []*hit
+	for _, h := range hits {
+		if h.doc.order%max == id {
+			sliced = append(sliced, h)
+		}
+	}
+	return sliced, nil
+}
+
+func (c *Cluster) openPointInTime(req *request, expr string) (int, interface{}, *esError) {
+	hits, err := c.searchDocs(expr, nil, req.boolParam("ignore_unavailable"))
+	if err != nil {
+		return 0, nil, err
+	}
+	// NOTE: the point-in-time keeps the documents at the time it is opened.
+	for _, h := range hits {
+		doc := *h.doc
+		h.doc = &doc
+	}
+	id := newID()
+	c.pits[id] = &pit{hits: hits}
+	return http.StatusOK, map[string]interface{}{"id": id}, nil
+}
+
+func (c *Cluster) closePointInTime(req *request) (int, interface{}, *esError) {
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	if _, ok := c.pits[body.ID]; !ok {
+		return http.StatusNotFound, map[string]interface{}{"succeeded": true, "num_freed": 0}, nil
+	}
+	delete(c.pits, body.ID)
+	return http.StatusOK, map[string]interface{}{"succeeded": true, "num_freed": 1}, nil
+}
+
+func (c *Cluster) search(req *request, expr string) (int, interface{}, *esError) {
+	var body searchBody
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+
+	from, size := 0, 10
+	if body.From != nil {
+		from = *body.From
+	}
+	if body.Size != nil {
+		size = *body.Size
+	}
+	if v := req.param("from"); v != "" {
+		from, _ = strconv.Atoi(v)
+	}
+	if v := req.param("size"); v != "" {
+		size, _ = strconv.Atoi(v)
+	}
+
+	opts, err := parseSearchOptions(req, &body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var hits []*hit
+	if body.Pit != nil {
+		p := c.pits[body.Pit.ID]
+		if p == nil {
+			return 0, nil, newError(http.StatusNotFound, "search_context_missing_exception",
+				fmt.Sprintf("No search context found for id [%s]", body.Pit.ID))
+		}
+		hits, err = filterHits(p.hits, body.Query)
+	} else {
+		hits, err = c.searchDocs(expr, body.Query, req.boolParam("ignore_unavailable"))
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if body.Slice != nil {
+		hits, err = sliceHits(hits, body.Slice.ID, body.Slice.Max)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	sortHits(hits, opts.sort)
+	if body.SearchAfter != nil {
+		if len(body.SearchAfter) != len(opts.sort) {
+			return 0, nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+				"search_after has different number of sort values than the sort")
+		}
+		i := 0
+		for i < len(hits) && compareSortValues(hits[i].sort, body.SearchAfter, opts.sort) <= 0 {
+			i++
+		}
+		hits = hits[i:]
+	}
+
+	aggs := body.Aggs
+	if aggs == nil {
+		aggs = body.Aggregations
+	}
+	aggregations, err := aggregate(aggs, hits)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rendered := make([]interface{}, 0, len(hits))
+	for _, h := range hits {
+		rendered = append(rendered, renderHit(h, opts))
+	}
+
+	if from > len(rendered) {
+		from = len(rendered)
+	}
+	end := from + size
+	if end > len(rendered) {
+		end = len(rendered)
+	}
+
+	res := searchResponse(rendered[from:end], len(rendered), len(opts.sort) == 0)
+	if aggregations != nil {
+		res["aggregations"] = aggregations
+	}
+	if body.Pit != nil {
+		res["pit_id"] = body.Pit.ID
+	}
+	if req.param("scroll") != "" {
+		scrollID := newID()
+		c.scrolls[scrollID] = &scroll{hits: rendered[end:], size: size, total: len(rendered)}
+		res["_scroll_id"] = scrollID
+	}
+	return http.StatusOK, res, nil
+}
+
+func (c *Cluster) scroll(req *request, scrollID string) (int, interface{}, *esError) {
+	var body struct {
+		ScrollID string `json:"scroll_id"`
+	}
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	if body.ScrollID != "" {
+		scrollID = body.ScrollID
+	}
+	if v := req.param("scroll_id"); v != "" {
+		scrollID = v
+	}
+
+	s := c.scrolls[scrollID]
+	if s == nil {
+		return 0, nil, newError(http.StatusNotFound, "search_context_missing_exception",
+			fmt.Sprintf("No search context found for id [%s]", scrollID))
+	}
+
+	end := s.size
+	if end > len(s.hits) {
+		end = len(s.hits)
+	}
+	res := searchResponse(s.hits[:end], s.total, true)
+	res["_scroll_id"] = scrollID
+	s.hits = s.hits[end:]
+	return http.StatusOK, res, nil
+}
+
+func (c *Cluster) clearScroll(req *request, path []string) (int, interface{}, *esError) {
+	var ids []string
+	if len(path) > 0 {
+		ids = strings.Split(path[0], ",")
+	}
+
+	var body struct {
+		ScrollID interface{} `json:"scroll_id"`
+	}
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	switch v := body.ScrollID.(type) {
+	case string:
+		ids = append(ids, v)
+	case []interface{}:
+		for _, id := range v {
+			ids = append(ids, fmt.Sprint(id))
+		}
+	}
+
+	freed := 0
+	for _, id := range ids {
+		if id == "_all" {
+			freed += len(c.scrolls)
+			c.scrolls = make(map[string]*scroll)
+			continue
+		}
+		if _, ok := c.scrolls[id]; ok {
+			delete(c.scrolls, id)
+			freed++
+		}
+	}
+
+	status := http.StatusOK
+	if freed == 0 && len(ids) > 0 {
+		status = http.StatusNotFound
+	}
+	return status, map[string]interface{}{"succeeded": true, "num_freed": freed}, nil
+}
+
+func (c *Cluster) count(req *request, expr string) (int, interface{}, *esError) {
+	var body struct {
+		Query map[string]interface{} `json:"query"`
+	}
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	hits, err := c.searchDocs(expr, body.Query, req.boolParam("ignore_unavailable"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, map[string]interface{}{"count": len(hits), "_shards": shards()}, nil
+}
+
+func searchResponse(hits []interface{}, total int, scored bool) map[string]interface{} {
+	var maxScore interface{}
+	if scored && len(hits) > 0 {
+		maxScore = 1.0
+	}
+	s := shards()
+	s["skipped"] = 0
+	return map[string]interface{}{
+		"took":      0,
+		"timed_out": false,
+		"_shards":   s,
+		"hits": map[string]interface{}{
+			"total":     map[string]interface{}{"value": total, "relation": "eq"},
+			"max_score": maxScore,
+			"hits":      hits,
+		},
+	}
+}
+
+func renderHit(h *hit, opts *searchOptions) map[string]interface{} {
+	res := map[string]interface{}{
+		"_index": h.idx.name,
+		"_type":  "_doc",
+		"_id":    h.doc.id,
+		"_score": 1.0,
+	}
+	if len(opts.sort) > 0 {
+		res["_score"] = nil
+		res["sort"] = h.sort
+	}
+	if opts.seqNoPrimaryTerm {
+		res["_seq_no"] = h.doc.seqNo
+		res["_primary_term"] = primaryTerm
+	}
+	if opts.version {
+		res["_version"] = h.doc.version
+	}
+	if !opts.noSource {
+		if len(opts.includes) == 0 && len(opts.excludes) == 0 {
+			res["_source"] = h.doc.source
+		} else {
+			res["_source"] = filterSource(h.doc.fields, "", opts.includes, opts.excludes)
+		}
+	}
+	return res
+}
+
+func parseSearchOptions(req *request, body *searchBody) (*searchOptions, *esError) {
+	opts := &searchOptions{
+		seqNoPrimaryTerm: body.SeqNoPrimaryTerm || req.boolParam("seq_no_primary_term"),
+		version:          body.Version || req.boolParam("version"),
+	}
+
+	switch v := body.Source.(type) {
+	case bool:
+		opts.noSource = !v
+	case string:
+		opts.includes = []string{v}
+	case []interface{}:
+		opts.includes = toStrings(v)
+	case map[string]interface{}:
+		if includes, ok := v["includes"].([]interface{}); ok {
+			opts.includes = toStrings(includes)
+		}
+		if excludes, ok := v["excludes"].([]interface{}); ok {
+			opts.excludes = toStrings(excludes)
+		}
+	}
+	if v := req.param("_source"); v != "" {
+		opts.noSource = v == "false"
+	}
+	if v := req.param("_source_includes"); v != "" {
+		opts.includes = strings.Split(v, ",")
+	}
+	if v := req.param("_source_excludes"); v != "" {
+		opts.excludes = strings.Split(v, ",")
+	}
+
+	var sorts []interface{}
+	switch v := body.Sort.(type) {
+	case nil:
+	case []interface{}:
+		sorts = v
+	default:
+		sorts = []interface{}{v}
+	}
+	if v := req.param("sort"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			field, order := s, "asc"
+			if i := strings.LastIndex(s, ":"); i >= 0 {
+				field, order = s[:i], s[i+1:]
+			}
+			sorts = append(sorts, map[string]interface{}{field: order})
+		}
+	}
+	for _, s := range sorts {
+		switch v := s.(type) {
+		case string:
+			opts.sort = append(opts.sort, sortField{field: v, desc: v == "_score"})
+		case map[string]interface{}:
+			for field, order := range v {
+				if m, ok := order.(map[string]interface{}); ok {
+					order = m["order"]
+				}
+				opts.sort = append(opts.sort, sortField{field: field, desc: order == "desc"})
+			}
+		default:
+			return nil, newError(http.StatusBadRequest, "parsing_exception", fmt.Sprintf("malformed sort [%v]", s))
+		}
+	}
+	return opts, nil
+}
+
+func sortHits(hits []*hit, fields []sortField) {
+	if len(fields) == 0 {
+		return
+	}
+	for _, h := range hits {
+		h.sort = make([]interface{}, len(fields))
+		for i, f := range fields {
+			h.sort[i] = sortValue(h, f)
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return compareSortValues(hits[i].sort, hits[j].sort, fields) < 0
+	})
+}
+
+func compareSortValues(a []interface{}, b []interface{}, fields []sortField) int {
+	for k, f := range fields {
+		// NOTE: the documents which do not have the field are sorted last.
+		if a[k] == nil || b[k] == nil {
+			if (a[k] == nil) != (b[k] == nil) {
+				if a[k] == nil {
+					return 1
+				}
+				return -1
+			}
+			continue
+		}
+		cmp, _ := compareValues(a[k], b[k])
+		if f.desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+func sortValue(h *hit, f sortField) interface{} {
+	switch f.field {
+	case "_doc", "_shard_doc":
+		return h.doc.order
+	case "_score":
+		return 1.0
+	}
+
+	var value interface{}
+	for _, v := range fieldValues(h.doc, f.field) {
+		if value == nil {
+			value = v
+			continue
+		}
+		// NOTE: the minimum value is used in ascending order, and the maximum value is used in descending order.
+		if cmp, ok := compareValues(v, value); ok && (cmp < 0) != f.desc && cmp != 0 {
+			value = v
+		}
+	}
+	return value
+}
+
+// filterSource returns the fields that match the includes and do not match the excludes.
+func filterSource(fields map[string]interface{}, prefix string, includes []string, excludes []string) map[string]interface{} {
+	res := make(map[string]interface{})
+	for k, v := range fields {
+		name := prefix + k
+		if matchAny(excludes, name) {
+			continue
+		}
+		included := len(includes) == 0 || matchAny(includes, name)
+		if m, ok := v.(map[string]interface{}); ok {
+			subIncludes := includes
+			if included {
+				subIncludes = nil
+			}
+			if sub := filterSource(m, name+".", subIncludes, excludes); len(sub) > 0 || included {
+				res[k] = sub
+			}
+			continue
+		}
+		if included {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func toStrings(values []interface{}) []string {
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		strs = append(strs, fmt.Sprint(v))
+	}
+	return strs
+}
+
+// aggregate computes the aggregations. Only the terms aggregation is supported.
+func aggregate(aggs map[string]map[string]interface{}, hits []*hit) (map[string]interface{}, *esError) {
+	if len(aggs) == 0 {
+		return nil, nil
+	}
+
+	res := make(map[string]interface{}, len(aggs))
+	for name, agg := range aggs {
+		subAggs := make(map[string]map[string]interface{})
+		for _, key := range []string{"aggs", "aggregations"} {
+			if sub, ok := agg[key].(map[string]interface{}); ok {
+				for k, v := range sub {
+					if m, ok := v.(map[string]interface{}); ok {
+						subAggs[k] = m
+					}
+				}
+			}
+		}
+
+		params, ok := agg["terms"].(map[string]interface{})
+		if !ok {
+			var types []string
+			for typ := range agg {
+				if typ != "aggs" && typ != "aggregations" && typ != "meta" {
+					types = append(types, typ)
+				}
+			}
+			return nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+				fmt.Sprintf("elsearmtest does not support [%s] aggregation", strings.Join(types, ",")))
+		}
+		terms, err := termsAggregation(params, subAggs, hits)
+		if err != nil {
+			return nil, err
+		}
+		res[name] = terms
+	}
+	return res, nil
+}
+
+func termsAggregation(params map[string]interface{}, subAggs map[string]map[string]interface{}, hits []*hit) (map[string]interface{}, *esError) {
+	field, _ := params["field"].(string)
+	size := 10
+	if v, ok := params["size"].(float64); ok {
+		size = int(v)
+	}
+
+	type bucket struct {
+		key  interface{}
+		hits []*hit
+	}
+	var buckets []*bucket
+	for _, h := range hits {
+		var seen []interface{}
+	values:
+		for _, v := range fieldValues(h.doc, field) {
+			for _, s := range seen {
+				if equalValues(s, v) {
+					continue values
+				}
+			}
+			seen = append(seen, v)
+
+			for _, b := range buckets {
+				if equalValues(b.key, v) {
+					b.hits = append(b.hits, h)
+					continue values
+				}
+			}
+			buckets = append(buckets, &bucket{key: v, hits: []*hit{h}})
+		}
+	}
+
+	sort.SliceStable(buckets, func(i, j int) bool {
+		if len(buckets[i].hits) != len(buckets[j].hits) {
+			return len(buckets[i].hits) > len(buckets[j].hits)
+		}
+		cmp, _ := compareValues(buckets[i].key, buckets[j].key)
+		return cmp < 0
+	})
+
+	sumOtherDocCount := 0
+	if len(buckets) > size {
+		for _, b := range buckets[size:] {
+			sumOtherDocCount += len(b.hits)
+		}
+		buckets = buckets[:size]
+	}
+
+	results := make([]interface{}, 0, len(buckets))
+	for _, b := range buckets {
+		result, err := aggregate(subAggs, b.hits)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = make(map[string]interface{})
+		}
+		result["key"] = b.key
+		result["doc_count"] = len(b.hits)
+		results = append(results, result)
+	}
+	return map[string]interface{}{
+		"doc_count_error_upper_bound": 0,
+		"sum_other_doc_count":         sumOtherDocCount,
+		"buckets":                     results,
+	}, nil
+}
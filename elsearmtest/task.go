@@ -0,0 +1,213 @@
+package elsearmtest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const nodeID = "elsearmtest"
+
+// task is a task which is started with wait_for_completion=false.
+type task struct {
+	id          int64
+	action      string
+	description string
+	start       time.Time
+	run         func(*task) (map[string]interface{}, *esError)
+
+	// status is the progress of the task, which is same as the response without took, timed_out and failures.
+	status    map[string]interface{}
+	response  map[string]interface{}
+	err       *esError
+	completed bool
+}
+
+func (t *task) taskID() string {
+	return nodeID + ":" + strconv.FormatInt(t.id, 10)
+}
+
+func (t *task) info() map[string]interface{} {
+	return map[string]interface{}{
+		"node":                  nodeID,
+		"id":                    t.id,
+		"type":                  "transport",
+		"action":                t.action,
+		"status":                t.status,
+		"description":           t.description,
+		"start_time_in_millis":  t.start.UnixNano() / int64(time.Millisecond),
+		"running_time_in_nanos": time.Since(t.start).Nanoseconds(),
+		"cancellable":           true,
+		"headers":               map[string]interface{}{},
+	}
+}
+
+func (t *task) complete() {
+	t.response, t.err = t.run(t)
+	t.completed = true
+}
+
+// SuspendTasks makes the tasks which are started with wait_for_completion=false keep running until ResumeTasks is called.
+// By default, the tasks are completed immediately. It is useful to test polling, cancellation and throttling.
+func (c *Cluster) SuspendTasks() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.suspended = true
+}
+
+// ResumeTasks completes the suspended tasks, and the tasks started later are completed immediately.
+func (c *Cluster) ResumeTasks() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.suspended = false
+
+	ids := make([]int64, 0, len(c.tasks))
+	for id := range c.tasks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if t := c.tasks[id]; !t.completed {
+			t.complete()
+		}
+	}
+}
+
+// startTask runs the operation. If wait_for_completion=false, it returns the task id instead of the result.
+func (c *Cluster) startTask(req *request, action string, description string, status map[string]interface{},
+	run func(*task) (map[string]interface{}, *esError)) (int, interface{}, *esError) {
+	t := &task{
+		action:      action,
+		description: description,
+		start:       time.Now(),
+		run:         run,
+		status:      status,
+	}
+	if req.param("wait_for_completion") != "false" {
+		res, err := run(t)
+		if err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, res, nil
+	}
+
+	c.taskSeq++
+	t.id = c.taskSeq
+	c.tasks[t.id] = t
+	if !c.suspended {
+		t.complete()
+	}
+	return http.StatusOK, map[string]interface{}{"task": t.taskID()}, nil
+}
+
+func (c *Cluster) findTask(taskID string) (*task, *esError) {
+	var id int64
+	if strings.HasPrefix(taskID, nodeID+":") {
+		id, _ = strconv.ParseInt(strings.TrimPrefix(taskID, nodeID+":"), 10, 64)
+	}
+	if t := c.tasks[id]; t != nil {
+		return t, nil
+	}
+	return nil, newError(http.StatusNotFound, "resource_not_found_exception",
+		fmt.Sprintf("task [%s] isn't running and hasn't stored its results", taskID))
+}
+
+func (c *Cluster) getTask(taskID string) (int, interface{}, *esError) {
+	t, err := c.findTask(taskID)
+	if err != nil {
+		return 0, nil, err
+	}
+	res := map[string]interface{}{
+		"completed": t.completed,
+		"task":      t.info(),
+	}
+	if t.err != nil {
+		res["error"] = t.err.cause()
+	} else if t.response != nil {
+		res["response"] = t.response
+	}
+	return http.StatusOK, res, nil
+}
+
+func (c *Cluster) cancelTask(taskID string) (int, interface{}, *esError) {
+	t, err := c.findTask(taskID)
+	if err != nil {
+		return http.StatusOK, nodeFailures(err), nil
+	}
+	if t.completed {
+		return http.StatusOK, map[string]interface{}{"nodes": map[string]interface{}{}}, nil
+	}
+
+	t.status["canceled"] = "by user request"
+	t.response = map[string]interface{}{"took": 0, "timed_out": false, "failures": []interface{}{}}
+	for k, v := range t.status {
+		t.response[k] = v
+	}
+	t.completed = true
+	return http.StatusOK, taskNodes(t), nil
+}
+
+func (c *Cluster) rethrottleTask(req *request, taskID string) (int, interface{}, *esError) {
+	rps := req.param("requests_per_second")
+	if rps == "" {
+		return 0, nil, newError(http.StatusBadRequest, "action_request_validation_exception",
+			"Validation Failed: 1: requests_per_second is required;")
+	}
+	value, e := strconv.ParseFloat(rps, 64)
+	if e != nil || value == 0 {
+		return 0, nil, newError(http.StatusBadRequest, "illegal_argument_exception",
+			fmt.Sprintf("[requests_per_second] must be a float greater than 0. Use -1 to disable throttling but was [%s]", rps))
+	}
+
+	t, err := c.findTask(taskID)
+	if err == nil && t.completed {
+		err = newError(http.StatusNotFound, "resource_not_found_exception", fmt.Sprintf("task [%s] is missing", taskID))
+	}
+	if err != nil {
+		return http.StatusOK, nodeFailures(err), nil
+	}
+	if value < 0 {
+		t.status["requests_per_second"] = -1
+	} else {
+		t.status["requests_per_second"] = value
+	}
+	return http.StatusOK, taskNodes(t), nil
+}
+
+func (c *Cluster) forceMerge(req *request, expr string) (int, interface{}, *esError) {
+	if _, err := c.resolve(expr, req.boolParam("ignore_unavailable")); err != nil {
+		return 0, nil, err
+	}
+	return c.startTask(req, "indices:admin/forcemerge", "Force-merge indices ["+expr+"]", map[string]interface{}{},
+		func(*task) (map[string]interface{}, *esError) {
+			return map[string]interface{}{"_shards": shards()}, nil
+		})
+}
+
+func taskNodes(t *task) map[string]interface{} {
+	return map[string]interface{}{
+		"nodes": map[string]interface{}{
+			nodeID: map[string]interface{}{
+				"name":  nodeID,
+				"tasks": map[string]interface{}{t.taskID(): t.info()},
+			},
+		},
+	}
+}
+
+func nodeFailures(err *esError) map[string]interface{} {
+	return map[string]interface{}{
+		"node_failures": []interface{}{
+			map[string]interface{}{
+				"type":      "failed_node_exception",
+				"reason":    "Failed node [" + nodeID + "]",
+				"node_id":   nodeID,
+				"caused_by": err.cause(),
+			},
+		},
+		"nodes": map[string]interface{}{},
+	}
+}
@@ -0,0 +1,67 @@
+package elsearm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrInvalidModel is returned when the model is not the type that the function accepts.
+	ErrInvalidModel = errors.New("invalid model")
+	// ErrTooManyArguments is returned when the function receives more arguments than it accepts.
+	ErrTooManyArguments = errors.New("too many arguments")
+	// ErrAggregationNotFound is returned when the aggregation of the name is not included in the response.
+	ErrAggregationNotFound = errors.New("aggregation not found")
+	// ErrTaskCanceled is returned when the task has been canceled.
+	ErrTaskCanceled = errors.New("task canceled")
+	// ErrTaskFailed is returned when the documents of the task have failed. (see TaskFailedError)
+	ErrTaskFailed = errors.New("task failed")
+	// ErrExternalVersionUnsupported is returned when the function can not send the external version of the model.
+	ErrExternalVersionUnsupported = errors.New("external version is not supported")
+	// ErrUnknownField is returned when the field name is not a JSON field of the model.
+	ErrUnknownField = errors.New("unknown field")
+	// ErrQueryRequired is returned when the query is nil, but the function does not regard it as match_all.
+	ErrQueryRequired = errors.New("query is required")
+	// ErrIndexSettingsRequired is returned when the model has a custom document body, but does not implement CustomIndexSettingsModel.
+	ErrIndexSettingsRequired = errors.New("index settings are required")
+	// ErrNoPreviousVersion is returned when the index has no previous version to roll back to.
+	ErrNoPreviousVersion = errors.New("no previous version")
+)
+
+// The errors of Elasticsearch. They can be used with errors.Is for the error returned by Indexer.
+var (
+	// ErrDocumentNotFound means that the document does not exist.
+	ErrDocumentNotFound = errors.New("document not found")
+	// ErrIndexNotFound means that the index does not exist.
+	ErrIndexNotFound = errors.New("index not found")
+	// ErrIndexAlreadyExists means that the index to create already exists.
+	ErrIndexAlreadyExists = errors.New("index already exists")
+	// ErrVersionConflict means that the document has been changed by others.
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrTooManyRequests means that Elasticsearch rejected the request because of the load.
+	ErrTooManyRequests = errors.New("too many requests")
+	// ErrMappingConflict means that the document or mappings does not match the mappings of the index.
+	ErrMappingConflict = errors.New("mapping conflict")
+)
+
+func invalidModelError(model interface{}) error {
+	return fmt.Errorf("%w: %#v", ErrInvalidModel, model)
+}
+
+// fail returns the err. If the strict mode is enabled, it panics instead.
+func (cfg *Config) fail(err error) error {
+	if cfg.Strict {
+		panic(err.Error())
+	}
+	return err
+}
+
+// assertModel returns an error if the model is not a pointer of struct.
+func (cfg *Config) assertModel(model interface{}) error {
+	v := reflect.ValueOf(model)
+	if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+		return nil
+	}
+	return cfg.fail(invalidModelError(model))
+}
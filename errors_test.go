@@ -0,0 +1,76 @@
+package elsearm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+func TestErrInvalidModel(t *testing.T) {
+	if err := indexer.Update(User{}); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.Delete(nil); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if _, err := indexer.Count(&[]User{}); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := bulkIndexer.Update(User{}); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	var users []User
+	if _, err := indexer.Search(users); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	var ids []int
+	if _, err := indexer.Search(&ids); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if _, err := indexer.Scroll(&ids); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	res := &SearchResponse{}
+	if err := res.SetResult(&User{}); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
+
+func TestErrTooManyArguments(t *testing.T) {
+	var a, b map[string]interface{}
+	if err := indexer.Do(&esapi.InfoRequest{}, &a, &b); !errors.Is(err, ErrTooManyArguments) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	assertPanic := func(f func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("it should panic but not")
+			}
+		}()
+		f()
+	}
+
+	strict := indexer.WithConfig(Config{Strict: true})
+	assertPanic(func() { _ = strict.Update(User{}) })
+	assertPanic(func() { _, _ = strict.Search([]User{}) })
+	assertPanic(func() { _ = (&SearchResponse{}).setResult(&User{}, strict.config()) })
+	assertPanic(func() {
+		var a, b map[string]interface{}
+		_ = strict.Do(&esapi.InfoRequest{}, &a, &b)
+	})
+
+	SetGlobalConfig(GlobalConfig{Strict: true})
+	defer SetGlobalConfig(GlobalConfig{})
+	assertPanic(func() { _ = indexer.Update(User{}) })
+	assertPanic(func() { _ = (&SearchResponse{}).SetResult(&User{}) })
+	if err := (&SearchResponse{}).setResult(&User{}, strict.WithConfig(Config{}).config()); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
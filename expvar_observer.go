@@ -0,0 +1,59 @@
+package elsearm
+
+import (
+	"context"
+	"expvar"
+	"sync"
+)
+
+// ExpvarObserver is an Observer that records the metrics to expvar.
+//
+// The metrics are recorded per operation as follows.
+//
+//	requests          a number of the finished operations
+//	errors            a number of the failed operations
+//	in_flight         a number of the running operations
+//	duration_ns       a sum of the durations in nanoseconds
+//	request_bytes     a sum of the bytes of the request bodies
+//	response_bytes    a sum of the bytes of the response bodies
+type ExpvarObserver struct {
+	mu sync.Mutex
+	m  *expvar.Map
+}
+
+// NewExpvarObserver creates an ExpvarObserver that records the metrics to m.
+// For example, `elsearm.NewExpvarObserver(expvar.NewMap("elsearm"))` publishes them as `elsearm` in /debug/vars.
+func NewExpvarObserver(m *expvar.Map) *ExpvarObserver {
+	return &ExpvarObserver{m: m}
+}
+
+// OnRequestStart increments in_flight of the operation.
+func (o *ExpvarObserver) OnRequestStart(ctx context.Context, event *RequestEvent) context.Context {
+	o.metrics(event.Operation).Add("in_flight", 1)
+	return ctx
+}
+
+// OnRequestEnd records the result of the operation.
+func (o *ExpvarObserver) OnRequestEnd(_ context.Context, event *RequestEvent) {
+	metrics := o.metrics(event.Operation)
+	metrics.Add("in_flight", -1)
+	metrics.Add("requests", 1)
+	if event.Err != nil {
+		metrics.Add("errors", 1)
+	}
+	metrics.Add("duration_ns", int64(event.Duration))
+	metrics.Add("request_bytes", event.RequestBytes)
+	metrics.Add("response_bytes", event.ResponseBytes)
+}
+
+func (o *ExpvarObserver) metrics(operation string) *expvar.Map {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if metrics, ok := o.m.Get(operation).(*expvar.Map); ok {
+		return metrics
+	}
+	metrics := new(expvar.Map).Init()
+	o.m.Set(operation, metrics)
+	return metrics
+}
@@ -1,5 +1,5 @@
 module github.com/soranoba/elsearm
 
-go 1.14
+go 1.18
 
-require github.com/elastic/go-elasticsearch/v7 v7.9.0
+require github.com/elastic/go-elasticsearch/v7 v7.17.10
@@ -0,0 +1,19 @@
+module github.com/soranoba/elsearm/gormsync
+
+go 1.20
+
+replace github.com/soranoba/elsearm => ../
+
+require (
+	github.com/elastic/go-elasticsearch/v7 v7.17.10
+	github.com/soranoba/elsearm v0.0.0-00010101000000-000000000000
+	gorm.io/driver/sqlite v1.5.7
+	gorm.io/gorm v1.25.12
+)
+
+require (
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	github.com/mattn/go-sqlite3 v1.14.22 // indirect
+	golang.org/x/text v0.14.0 // indirect
+)
@@ -0,0 +1,372 @@
+// Package gormsync is a GORM plugin that synchronizes the documents of Elasticsearch with the models.
+//
+// The models which implement Model are indexed after the transaction is committed,
+// and the documents are deleted when the models are deleted (including soft deletes).
+//
+// The plugin records the primary keys of the changed rows, and reloads the rows after the commit.
+// The rows which are found are indexed, and the others are deleted from the index.
+// So batch creates, updates and deletes with conditions are also synchronized.
+// The models should have a single primary key. Raw SQL (e.g. db.Exec) is not synchronized.
+package gormsync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+
+	"github.com/soranoba/elsearm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	primaryKeysKey = "elsearm:gormsync:primary_keys"
+	// reloadBatchSize is a maximum number of the primary keys per query to reload the rows.
+	reloadBatchSize = 1000
+)
+
+var (
+	// ErrUnmanagedTransaction is returned from the statement when the models are changed in a transaction which is not started by Plugin.Transaction.
+	// The statement is not executed, because the plugin can not know when the transaction is committed.
+	ErrUnmanagedTransaction = errors.New("gormsync: the transaction is not started by Plugin.Transaction")
+	// ErrCompositePrimaryKey is passed to OnError when the model has no primary key or multiple primary keys.
+	ErrCompositePrimaryKey = errors.New("gormsync: the model should have a single primary key")
+)
+
+// Model is a marker interface of the models which are synchronized.
+//
+//	func (*User) ElsearmDocument() {}
+type Model interface {
+	ElsearmDocument()
+}
+
+// Config is a config of Plugin.
+type Config struct {
+	// If it is set, the documents are updated through the BulkIndexer instead of the Indexer.
+	// The failed items are passed to the failure handler of the BulkIndexer.
+	BulkIndexer *elsearm.BulkIndexer
+	// A function which is called with the errors of the synchronization.
+	// If it is nil, the errors are written to the logger of GORM.
+	OnError func(ctx context.Context, err error)
+}
+
+// Plugin is a GORM plugin that synchronizes the documents.
+type Plugin struct {
+	indexer *elsearm.Indexer
+	cfg     Config
+	db      *gorm.DB
+}
+
+// changes is the primary keys of the changed rows per model.
+type changes struct {
+	schemas []*schema.Schema
+	keys    map[*schema.Schema][]interface{}
+	seen    map[*schema.Schema]map[interface{}]bool
+}
+
+type changesKey struct {
+	plugin *Plugin
+}
+
+// New creates a Plugin. It should be registered with db.Use.
+func New(indexer *elsearm.Indexer, cfg Config) *Plugin {
+	return &Plugin{indexer: indexer, cfg: cfg}
+}
+
+// Name returns the name of the plugin.
+func (p *Plugin) Name() string {
+	return "elsearm:gormsync"
+}
+
+// Initialize registers the callbacks.
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	p.db = db
+
+	create := db.Callback().Create()
+	if err := create.Before("gorm:create").Register("elsearm:gormsync:check", p.checkTransaction); err != nil {
+		return err
+	}
+	if err := create.After("gorm:create").Register("elsearm:gormsync:collect", p.collectCreated); err != nil {
+		return err
+	}
+	if err := create.After("gorm:commit_or_rollback_transaction").Register("elsearm:gormsync:sync", p.sync); err != nil {
+		return err
+	}
+
+	update := db.Callback().Update()
+	if err := update.Before("gorm:update").Register("elsearm:gormsync:collect", p.collectTargets); err != nil {
+		return err
+	}
+	if err := update.After("gorm:commit_or_rollback_transaction").Register("elsearm:gormsync:sync", p.sync); err != nil {
+		return err
+	}
+
+	del := db.Callback().Delete()
+	if err := del.Before("gorm:delete").Register("elsearm:gormsync:collect", p.collectTargets); err != nil {
+		return err
+	}
+	return del.After("gorm:commit_or_rollback_transaction").Register("elsearm:gormsync:sync", p.sync)
+}
+
+// Transaction executes fc in a transaction, and synchronizes the changed models after the transaction is committed.
+// It should be used instead of db.Transaction, when the synchronized models are changed in the transaction.
+// Otherwise the statements fail with ErrUnmanagedTransaction.
+func (p *Plugin) Transaction(db *gorm.DB, fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Value(changesKey{p}).(*changes); ok {
+		// NOTE: the nested transaction is synchronized by the outermost one.
+		return db.Transaction(fc, opts...)
+	}
+
+	c := newChanges()
+	if err := db.WithContext(context.WithValue(ctx, changesKey{p}, c)).Transaction(fc, opts...); err != nil {
+		return err
+	}
+	p.flush(ctx, c)
+	return nil
+}
+
+// checkTransaction fails the statement, if it changes the models in a transaction which is not started by Plugin.Transaction.
+func (p *Plugin) checkTransaction(db *gorm.DB) {
+	if p.isTarget(db) && p.inUnmanagedTransaction(db) {
+		_ = db.AddError(ErrUnmanagedTransaction)
+	}
+}
+
+// collectCreated records the primary keys of the created rows.
+func (p *Plugin) collectCreated(db *gorm.DB) {
+	if !p.isTarget(db) {
+		return
+	}
+	keys, _ := primaryKeys(db)
+	db.InstanceSet(primaryKeysKey, keys)
+}
+
+// collectTargets records the primary keys of the rows to update or delete.
+func (p *Plugin) collectTargets(db *gorm.DB) {
+	if !p.isTarget(db) {
+		return
+	}
+	if p.inUnmanagedTransaction(db) {
+		_ = db.AddError(ErrUnmanagedTransaction)
+		return
+	}
+
+	keys, ok := primaryKeys(db)
+	if !ok {
+		// NOTE: the rows are specified by the conditions, so they are found before they are changed.
+		var err error
+		if keys, err = findPrimaryKeys(db); err != nil {
+			p.onError(db.Statement.Context, err)
+			return
+		}
+	}
+	db.InstanceSet(primaryKeysKey, keys)
+}
+
+// sync synchronizes the changed rows after the transaction of the statement is committed.
+func (p *Plugin) sync(db *gorm.DB) {
+	v, ok := db.InstanceGet(primaryKeysKey)
+	if !ok || db.Error != nil {
+		return
+	}
+	keys := v.([]interface{})
+	if len(keys) == 0 {
+		return
+	}
+
+	ctx := db.Statement.Context
+	if c, ok := ctx.Value(changesKey{p}).(*changes); ok {
+		c.add(db.Statement.Schema, keys)
+		return
+	}
+	c := newChanges()
+	c.add(db.Statement.Schema, keys)
+	p.flush(ctx, c)
+}
+
+// flush reloads the changed rows, and updates or deletes the documents.
+func (p *Plugin) flush(ctx context.Context, c *changes) {
+	for _, s := range c.schemas {
+		keys := c.keys[s]
+		for len(keys) > 0 {
+			n := len(keys)
+			if n > reloadBatchSize {
+				n = reloadBatchSize
+			}
+			if err := p.flushKeys(ctx, s, keys[:n]); err != nil {
+				p.onError(ctx, err)
+			}
+			keys = keys[n:]
+		}
+	}
+}
+
+func (p *Plugin) flushKeys(ctx context.Context, s *schema.Schema, keys []interface{}) error {
+	field := s.PrioritizedPrimaryField
+	models := reflect.New(reflect.SliceOf(reflect.PtrTo(s.ModelType)))
+	err := p.db.Session(&gorm.Session{NewDB: true, Context: ctx}).
+		Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Values: keys}).
+		Find(models.Interface()).Error
+	if err != nil {
+		return err
+	}
+
+	found := make(map[interface{}]bool, len(keys))
+	models = models.Elem()
+	for i := 0; i < models.Len(); i++ {
+		model := models.Index(i)
+		key, _ := field.ValueOf(ctx, model.Elem())
+		found[key] = true
+		if err := p.update(ctx, model.Interface()); err != nil {
+			p.onError(ctx, err)
+		}
+	}
+
+	for _, key := range keys {
+		if found[key] {
+			continue
+		}
+		model := reflect.New(s.ModelType)
+		if err := field.Set(ctx, model.Elem(), key); err != nil {
+			return err
+		}
+		if err := p.delete(ctx, model.Interface()); err != nil {
+			p.onError(ctx, err)
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) update(ctx context.Context, model interface{}) error {
+	if bulk := p.cfg.BulkIndexer; bulk != nil {
+		return bulk.WithContext(ctx).Update(model)
+	}
+	return p.indexer.WithContext(ctx).Update(model)
+}
+
+func (p *Plugin) delete(ctx context.Context, model interface{}) error {
+	if bulk := p.cfg.BulkIndexer; bulk != nil {
+		return bulk.WithContext(ctx).Delete(model)
+	}
+	err := p.indexer.WithContext(ctx).Delete(model)
+	if errors.Is(err, elsearm.ErrDocumentNotFound) || errors.Is(err, elsearm.ErrIndexNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (p *Plugin) onError(ctx context.Context, err error) {
+	if p.cfg.OnError != nil {
+		p.cfg.OnError(ctx, err)
+		return
+	}
+	p.db.Logger.Error(ctx, "%s", err)
+}
+
+func newChanges() *changes {
+	return &changes{
+		keys: map[*schema.Schema][]interface{}{},
+		seen: map[*schema.Schema]map[interface{}]bool{},
+	}
+}
+
+func (c *changes) add(s *schema.Schema, keys []interface{}) {
+	seen, ok := c.seen[s]
+	if !ok {
+		seen = map[interface{}]bool{}
+		c.seen[s] = seen
+		c.schemas = append(c.schemas, s)
+	}
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			c.keys[s] = append(c.keys[s], key)
+		}
+	}
+}
+
+// inUnmanagedTransaction reports whether the statement is executed in a transaction which is not started by Plugin.Transaction.
+// The transaction which GORM starts for the statement is committed before sync, so it is not unmanaged.
+func (p *Plugin) inUnmanagedTransaction(db *gorm.DB) bool {
+	if _, ok := db.Statement.Context.Value(changesKey{p}).(*changes); ok {
+		return false
+	}
+	if _, ok := db.InstanceGet("gorm:started_transaction"); ok {
+		return false
+	}
+	_, inTx := db.Statement.ConnPool.(gorm.TxCommitter)
+	return inTx
+}
+
+// isTarget reports whether the models of the statement are synchronized.
+func (p *Plugin) isTarget(db *gorm.DB) bool {
+	s := db.Statement.Schema
+	if db.Error != nil || s == nil {
+		return false
+	}
+	if _, ok := reflect.New(s.ModelType).Interface().(Model); !ok {
+		return false
+	}
+	if s.PrioritizedPrimaryField == nil {
+		p.onError(db.Statement.Context, ErrCompositePrimaryKey)
+		return false
+	}
+	return true
+}
+
+// primaryKeys returns the primary keys of the models of the statement.
+// It returns false if the models do not have the primary keys.
+func primaryKeys(db *gorm.DB) ([]interface{}, bool) {
+	field := db.Statement.Schema.PrioritizedPrimaryField
+	ctx := db.Statement.Context
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	var keys []interface{}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			elem := reflect.Indirect(rv.Index(i))
+			if elem.Kind() != reflect.Struct {
+				continue
+			}
+			if key, zero := field.ValueOf(ctx, elem); !zero {
+				keys = append(keys, key)
+			}
+		}
+		return keys, len(keys) > 0
+	case reflect.Struct:
+		if key, zero := field.ValueOf(ctx, rv); !zero {
+			return []interface{}{key}, true
+		}
+	}
+	return nil, false
+}
+
+// findPrimaryKeys returns the primary keys of the rows which match the conditions of the statement.
+func findPrimaryKeys(db *gorm.DB) ([]interface{}, error) {
+	stmt := db.Statement
+	field := stmt.Schema.PrioritizedPrimaryField
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Model(reflect.New(stmt.Schema.ModelType).Interface())
+	if stmt.Unscoped {
+		tx = tx.Unscoped()
+	}
+	if where, ok := stmt.Clauses["WHERE"]; ok {
+		tx.Statement.AddClause(where.Expression.(clause.Where))
+	}
+
+	values := reflect.New(reflect.SliceOf(field.FieldType))
+	if err := tx.Pluck(field.DBName, values.Interface()).Error; err != nil {
+		return nil, err
+	}
+	values = values.Elem()
+	keys := make([]interface{}, values.Len())
+	for i := range keys {
+		keys[i] = values.Index(i).Interface()
+	}
+	return keys, nil
+}
@@ -0,0 +1,328 @@
+package gormsync_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/soranoba/elsearm"
+	"github.com/soranoba/elsearm/elsearmtest"
+	"github.com/soranoba/elsearm/gormsync"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type User struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	Name      string         `json:"name"`
+	Age       int            `json:"age"`
+	DeletedAt gorm.DeletedAt `json:"-"`
+}
+
+func (*User) ElsearmDocument() {}
+
+type Log struct {
+	ID      uint   `gorm:"primarykey" json:"id"`
+	Message string `json:"message"`
+}
+
+var dbSeq int64
+
+type errorRecorder struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (r *errorRecorder) onError(ctx context.Context, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, err)
+}
+
+func setup(t *testing.T, cfg func(cluster *elsearmtest.Cluster, cfg *gormsync.Config)) (*gorm.DB, *elsearm.Indexer, *gormsync.Plugin, *errorRecorder) {
+	t.Helper()
+	cluster := elsearmtest.NewCluster()
+	t.Cleanup(cluster.Close)
+	client, err := cluster.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer := elsearm.NewIndexer(client)
+
+	dsn := "file:gormsync" + strconv.FormatInt(atomic.AddInt64(&dbSeq, 1), 10) + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&User{}, &Log{}); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &errorRecorder{}
+	config := gormsync.Config{OnError: recorder.onError}
+	if cfg != nil {
+		cfg(cluster, &config)
+	}
+	plugin := gormsync.New(indexer, config)
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+	return db, indexer, plugin, recorder
+}
+
+func documents(t *testing.T, indexer *elsearm.Indexer) map[uint]User {
+	t.Helper()
+	var users []User
+	if _, err := indexer.Search(&users); err != nil {
+		if errors.Is(err, elsearm.ErrIndexNotFound) {
+			return map[uint]User{}
+		}
+		t.Fatal(err)
+	}
+	result := make(map[uint]User, len(users))
+	for _, user := range users {
+		result[user.ID] = user
+	}
+	return result
+}
+
+func TestPlugin_create(t *testing.T) {
+	db, indexer, _, recorder := setup(t, nil)
+
+	if err := db.Create(&User{Name: "Alice", Age: 20}).Error; err != nil {
+		t.Fatal(err)
+	}
+	users := []User{{Name: "Bob", Age: 18}, {Name: "Carol", Age: 30}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Log{Message: "created"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	docs := documents(t, indexer)
+	if len(docs) != 3 || docs[1].Name != "Alice" || docs[2].Name != "Bob" || docs[3].Age != 30 {
+		t.Errorf("invalid documents: got %#v", docs)
+	}
+	if _, err := indexer.Count(&Log{}); !errors.Is(err, elsearm.ErrIndexNotFound) {
+		t.Errorf("the model which is not gormsync.Model should not be indexed: %v", err)
+	}
+	if len(recorder.errs) != 0 {
+		t.Errorf("invalid errors: got %v", recorder.errs)
+	}
+}
+
+func TestPlugin_update(t *testing.T) {
+	db, indexer, _, recorder := setup(t, nil)
+
+	users := []User{{Name: "Alice", Age: 20}, {Name: "Bob", Age: 18}, {Name: "Carol", Age: 30}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Model(&User{}).Where("age >= ?", 20).Update("name", "adult").Error; err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: the other fields of the document are reloaded from the database.
+	if err := db.Model(&User{ID: 2}).Update("age", 19).Error; err != nil {
+		t.Fatal(err)
+	}
+	users[0].Age = 21
+	if err := db.Save(&users[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	docs := documents(t, indexer)
+	wants := map[uint]User{1: {ID: 1, Name: "Alice", Age: 21}, 2: {ID: 2, Name: "Bob", Age: 19}, 3: {ID: 3, Name: "adult", Age: 30}}
+	if len(docs) != len(wants) {
+		t.Fatalf("invalid documents: got %#v", docs)
+	}
+	for id, want := range wants {
+		if docs[id] != want {
+			t.Errorf("invalid document: got %#v, wants %#v", docs[id], want)
+		}
+	}
+	if len(recorder.errs) != 0 {
+		t.Errorf("invalid errors: got %v", recorder.errs)
+	}
+}
+
+func TestPlugin_delete(t *testing.T) {
+	db, indexer, _, recorder := setup(t, nil)
+
+	users := []User{{Name: "Alice", Age: 20}, {Name: "Bob", Age: 18}, {Name: "Carol", Age: 30}, {Name: "Dave", Age: 15}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Delete(&users[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("age < ?", 19).Delete(&User{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	docs := documents(t, indexer)
+	if len(docs) != 1 || docs[3].Name != "Carol" {
+		t.Errorf("invalid documents: got %#v", docs)
+	}
+
+	// NOTE: the soft deleted row is restored.
+	if err := db.Unscoped().Model(&User{}).Where("id = ?", 1).Update("deleted_at", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Unscoped().Delete(&User{}, 3).Error; err != nil {
+		t.Fatal(err)
+	}
+	docs = documents(t, indexer)
+	if len(docs) != 1 || docs[1].Name != "Alice" {
+		t.Errorf("invalid documents: got %#v", docs)
+	}
+	if len(recorder.errs) != 0 {
+		t.Errorf("invalid errors: got %v", recorder.errs)
+	}
+}
+
+func TestPlugin_Transaction(t *testing.T) {
+	db, indexer, plugin, recorder := setup(t, nil)
+
+	errRollback := errors.New("rollback")
+	err := plugin.Transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Create(&User{Name: "Alice"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("invalid error: got %#v", err)
+	}
+	if docs := documents(t, indexer); len(docs) != 0 {
+		t.Errorf("invalid documents: got %#v", docs)
+	}
+
+	users := []User{{Name: "Bob"}, {Name: "Carol"}}
+	err = plugin.Transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Create(&users).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&users[0]).Update("age", 18).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&users[1]).Error; err != nil {
+			return err
+		}
+		if docs := documents(t, indexer); len(docs) != 0 {
+			t.Errorf("the documents should be updated after the commit: %#v", docs)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := documents(t, indexer)
+	if bob := docs[users[0].ID]; len(docs) != 1 || bob.Name != "Bob" || bob.Age != 18 {
+		t.Errorf("invalid documents: got %#v", docs)
+	}
+	if len(recorder.errs) != 0 {
+		t.Errorf("invalid errors: got %v", recorder.errs)
+	}
+
+	// NOTE: the transaction which is not started by the plugin.
+	unmanaged := map[string]func(tx *gorm.DB) error{
+		"create": func(tx *gorm.DB) error {
+			return tx.Create(&User{Name: "Dave"}).Error
+		},
+		"update": func(tx *gorm.DB) error {
+			return tx.Model(&users[0]).Update("age", 20).Error
+		},
+		"delete": func(tx *gorm.DB) error {
+			return tx.Delete(&users[0]).Error
+		},
+	}
+	for name, fc := range unmanaged {
+		if err := db.Transaction(fc); !errors.Is(err, gormsync.ErrUnmanagedTransaction) {
+			t.Errorf("%s should fail with ErrUnmanagedTransaction: got %#v", name, err)
+		}
+	}
+	var count int64
+	if err := db.Model(&User{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	var bob User
+	if err := db.First(&bob, users[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || bob.Age != 18 {
+		t.Errorf("the statements should not be executed: got %d rows, %#v", count, bob)
+	}
+	if docs := documents(t, indexer); len(docs) != 1 {
+		t.Errorf("invalid documents: got %#v", docs)
+	}
+
+	// NOTE: the models which are not synchronized can be changed in the transaction.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&Log{Message: "hello"}).Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.errs) != 0 {
+		t.Errorf("invalid errors: got %v", recorder.errs)
+	}
+}
+
+func TestPlugin_failedStatement(t *testing.T) {
+	db, indexer, _, _ := setup(t, nil)
+
+	if err := db.Create(&User{ID: 1, Name: "Alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&User{ID: 1, Name: "Bob"}).Error; err == nil {
+		t.Fatal("Create should fail but succeeded")
+	}
+	docs := documents(t, indexer)
+	if len(docs) != 1 || docs[1].Name != "Alice" {
+		t.Errorf("invalid documents: got %#v", docs)
+	}
+}
+
+func TestPlugin_bulkIndexer(t *testing.T) {
+	var bulk esutil.BulkIndexer
+	db, indexer, _, _ := setup(t, func(cluster *elsearmtest.Cluster, cfg *gormsync.Config) {
+		client, err := cluster.Client()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bulk, err = esutil.NewBulkIndexer(esutil.BulkIndexerConfig{Client: client, NumWorkers: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.BulkIndexer = elsearm.NewBulkIndexer(bulk)
+	})
+
+	users := []User{{Name: "Alice"}, {Name: "Bob"}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(&users[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := bulk.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	docs := documents(t, indexer)
+	if len(docs) != 1 || docs[2].Name != "Bob" {
+		t.Errorf("invalid documents: got %#v", docs)
+	}
+}
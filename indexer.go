@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"reflect"
+	"strconv"
+	"time"
 
 	elasticsearch "github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esapi"
@@ -15,9 +20,13 @@ import (
 
 // Indexer provides functions to update/delete document in Elasticsearch.
 type Indexer struct {
-	Q      *esapi.API
-	client *elasticsearch.Client
-	ctx    context.Context
+	Q            *esapi.API
+	client       *elasticsearch.Client
+	ctx          context.Context
+	cfg          *Config
+	retry        *RetryPolicy
+	interceptors []Interceptor
+	observer     Observer
 }
 
 // SearchResult is the metadata of the search result.
@@ -29,6 +38,8 @@ type SearchResult struct {
 	// Accuracy of the total. The value is `eq` or `gte`.
 	// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-search.html
 	TotalAccuracy string
+	// Results of the aggregations
+	Aggregations Aggregations
 }
 
 type source struct {
@@ -51,18 +62,47 @@ func NewIndexer(client *elasticsearch.Client) *Indexer {
 
 // WithContext specifies a context to use and returns a new Indexer.
 func (indexer *Indexer) WithContext(ctx context.Context) *Indexer {
-	return &Indexer{
-		client: indexer.client,
-		ctx:    ctx,
-	}
+	newIndexer := *indexer
+	newIndexer.ctx = ctx
+	return &newIndexer
+}
+
+// WithConfig specifies a config to use instead of GlobalConfig and returns a new Indexer.
+func (indexer *Indexer) WithConfig(cfg Config) *Indexer {
+	newIndexer := *indexer
+	newIndexer.cfg = &cfg
+	return &newIndexer
+}
+
+// Config returns the config that the Indexer uses.
+// If it is not set, it returns the config that is made from GlobalConfig.
+func (indexer *Indexer) Config() Config {
+	return *indexer.config()
+}
+
+// IndexName returns an index name of the model, which is resolved by the config of the Indexer.
+func (indexer *Indexer) IndexName(model interface{}) string {
+	return indexer.config().IndexName(model)
+}
+
+// SearchIndexName returns an index name of the model when searching, which is resolved by the config of the Indexer.
+func (indexer *Indexer) SearchIndexName(model interface{}) []string {
+	return indexer.config().SearchIndexName(model)
+}
+
+// IndexNameWithAffix returns an index name appending prefix and suffix of the config of the Indexer.
+func (indexer *Indexer) IndexNameWithAffix(indexName string) string {
+	return indexer.config().IndexNameWithAffix(indexName)
 }
 
 // CreateIndexIfNotExist creates an index, if it to save the model does not exist.
 func (indexer *Indexer) CreateIndexIfNotExist(model interface{}, reqFuncs ...func(*esapi.IndicesCreateRequest)) error {
-	assertModel(model)
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
 
 	createReq := &esapi.IndicesCreateRequest{
-		Index: url.QueryEscape(IndexName(model)),
+		Index: url.QueryEscape(indexer.IndexName(model)),
 	}
 	for _, f := range reqFuncs {
 		f(createReq)
@@ -72,18 +112,33 @@ func (indexer *Indexer) CreateIndexIfNotExist(model interface{}, reqFuncs ...fun
 		Index: []string{createReq.Index},
 	}
 	if err := indexer.Do(existsReq); err != nil {
-		return indexer.CreateIndex(model, reqFuncs...)
+		var errRes *ErrorResponse
+		if !errors.As(err, &errRes) || errRes.Status != http.StatusNotFound {
+			return err
+		}
+		if err := indexer.CreateIndex(model, reqFuncs...); err != nil && !errors.Is(err, ErrIndexAlreadyExists) {
+			return err
+		}
 	}
 	return nil
 }
 
 // CreateIndex creates an index that to save the model.
+// The settings and mappings of the index are decided by IndexSettings.
 // If it already exists, it returns an error.
 func (indexer *Indexer) CreateIndex(model interface{}, reqFuncs ...func(*esapi.IndicesCreateRequest)) error {
-	assertModel(model)
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
+
+	reader, err := IndexSettings(model)
+	if err != nil {
+		return err
+	}
 
 	createReq := &esapi.IndicesCreateRequest{
-		Index: url.QueryEscape(IndexName(model)),
+		Index: url.QueryEscape(indexer.IndexName(model)),
+		Body:  reader,
 	}
 	for _, f := range reqFuncs {
 		f(createReq)
@@ -93,10 +148,12 @@ func (indexer *Indexer) CreateIndex(model interface{}, reqFuncs ...func(*esapi.I
 
 // DeleteIndex deletes an index that to save the model.
 func (indexer *Indexer) DeleteIndex(model interface{}, reqFuncs ...func(*esapi.IndicesDeleteRequest)) error {
-	assertModel(model)
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
 
 	deleteReq := &esapi.IndicesDeleteRequest{
-		Index: []string{url.QueryEscape(IndexName(model))},
+		Index: []string{url.QueryEscape(indexer.IndexName(model))},
 	}
 	for _, f := range reqFuncs {
 		f(deleteReq)
@@ -104,9 +161,34 @@ func (indexer *Indexer) DeleteIndex(model interface{}, reqFuncs ...func(*esapi.I
 	return indexer.Do(deleteReq)
 }
 
+// ForceMergeAsync starts to merge the segments of the index of the model, and returns the task.
+// If maxNumSegments is zero, Elasticsearch decides whether the segments should be merged.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-forcemerge.html
+func (indexer *Indexer) ForceMergeAsync(model interface{}, maxNumSegments int) (*Task, error) {
+	if err := indexer.config().assertModel(model); err != nil {
+		return nil, err
+	}
+
+	// NOTE: esapi.IndicesForcemergeRequest does not have wait_for_completion.
+	forceMergeReq := &rawRequest{
+		Name:   "IndicesForcemerge",
+		Method: http.MethodPost,
+		Path:   "/" + url.QueryEscape(indexer.IndexName(model)) + "/_forcemerge",
+		Params: map[string]string{"wait_for_completion": "false"},
+	}
+	if maxNumSegments > 0 {
+		forceMergeReq.Params["max_num_segments"] = strconv.Itoa(maxNumSegments)
+	}
+	return indexer.startTask(forceMergeReq, "")
+}
+
 // Delete a document from Index.
+// If the model implements VersionedModel and has the version, it fails with ErrVersionConflict
+// when the document has been changed since the model was read.
 func (indexer *Indexer) Delete(model interface{}, reqFuncs ...func(*esapi.DeleteRequest)) error {
-	assertModel(model)
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
 
 	documentId, err := DocumentID(model)
 	if err != nil {
@@ -114,9 +196,11 @@ func (indexer *Indexer) Delete(model interface{}, reqFuncs ...func(*esapi.Delete
 	}
 
 	deleteReq := &esapi.DeleteRequest{
-		Index:      url.QueryEscape(IndexName(model)),
+		Index:      url.QueryEscape(indexer.IndexName(model)),
 		DocumentID: documentId,
+		Refresh:    indexer.config().Refresh,
 	}
+	deleteReq.IfSeqNo, deleteReq.IfPrimaryTerm = concurrencyControl(model)
 	for _, f := range reqFuncs {
 		f(deleteReq)
 	}
@@ -126,36 +210,50 @@ func (indexer *Indexer) Delete(model interface{}, reqFuncs ...func(*esapi.Delete
 
 // Get a document from Index.
 func (indexer *Indexer) Get(model interface{}, reqFuncs ...func(*esapi.GetRequest)) error {
-	assertModel(model)
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
 
 	documentId, err := DocumentID(model)
 	if err != nil {
 		return err
 	}
+	return indexer.get(model, documentId, reqFuncs...)
+}
 
+func (indexer *Indexer) get(model interface{}, documentId string, reqFuncs ...func(*esapi.GetRequest)) error {
 	getReq := &esapi.GetRequest{
-		Index:      url.QueryEscape(IndexName(model)),
+		Index:      url.QueryEscape(indexer.IndexName(model)),
 		DocumentID: documentId,
 	}
 	for _, f := range reqFuncs {
 		f(getReq)
 	}
 
-	var result map[string]*source
+	var result struct {
+		Source *source `json:"_source"`
+		documentMeta
+	}
 	if err := indexer.Do(getReq, &result); err != nil {
 		return err
 	}
 
-	s := result["_source"]
+	s := result.Source
 	if s == nil {
 		s = &source{}
 	}
-	return ParseDocument(model, bytes.NewReader(s.data))
+	if err := ParseDocument(model, bytes.NewReader(s.data)); err != nil {
+		return err
+	}
+	result.setTo(model)
+	return nil
 }
 
 // CreateWithoutID create a document in index without DocumentID.
 func (indexer *Indexer) CreateWithoutID(model interface{}, reqFuncs ...func(*esapi.IndexRequest)) error {
-	assertModel(model)
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
 
 	reader, err := DocumentBody(model)
 	if err != nil {
@@ -163,8 +261,9 @@ func (indexer *Indexer) CreateWithoutID(model interface{}, reqFuncs ...func(*esa
 	}
 
 	indexReq := &esapi.IndexRequest{
-		Index: url.QueryEscape(IndexName(model)),
-		Body:  reader,
+		Index:   url.QueryEscape(indexer.IndexName(model)),
+		Body:    reader,
+		Refresh: indexer.config().Refresh,
 	}
 	for _, f := range reqFuncs {
 		f(indexReq)
@@ -183,8 +282,13 @@ func (indexer *Indexer) CreateWithoutID(model interface{}, reqFuncs ...func(*esa
 }
 
 // Update (or create) the document in index.
+// If the model implements VersionedModel and has the version, it fails with ErrVersionConflict
+// when the document has been changed since the model was read.
+// If the model has an external version, it fails with ErrVersionConflict when the document has the same or newer version.
 func (indexer *Indexer) Update(model interface{}, reqFuncs ...func(*esapi.IndexRequest)) error {
-	assertModel(model)
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
 
 	reader, err := DocumentBody(model)
 	if err != nil {
@@ -197,23 +301,45 @@ func (indexer *Indexer) Update(model interface{}, reqFuncs ...func(*esapi.IndexR
 	}
 
 	indexReq := &esapi.IndexRequest{
-		Index:      url.QueryEscape(IndexName(model)),
+		Index:      url.QueryEscape(indexer.IndexName(model)),
 		DocumentID: documentId,
 		Body:       reader,
+		Refresh:    indexer.config().Refresh,
+	}
+	version, hasVersion, err := ExternalVersion(model)
+	if err != nil {
+		return err
+	}
+	if hasVersion {
+		v := int(version)
+		indexReq.Version = &v
+		indexReq.VersionType = "external"
+	} else {
+		indexReq.IfSeqNo, indexReq.IfPrimaryTerm = concurrencyControl(model)
 	}
 	for _, f := range reqFuncs {
 		f(indexReq)
 	}
 
-	return indexer.Do(indexReq)
+	var meta documentMeta
+	if err := indexer.Do(indexReq, &meta); err != nil {
+		if hasVersion && indexer.config().IgnoreStaleVersions && errors.Is(err, ErrVersionConflict) {
+			return nil
+		}
+		return err
+	}
+	meta.setTo(model)
+	return nil
 }
 
 // Count returns count of documents saved in index.
 func (indexer *Indexer) Count(model interface{}, reqFuncs ...func(*esapi.CountRequest)) (int, error) {
-	assertModel(model)
+	if err := indexer.config().assertModel(model); err != nil {
+		return 0, err
+	}
 
 	countReq := &esapi.CountRequest{
-		Index: []string{url.QueryEscape(IndexName(model))},
+		Index: []string{url.QueryEscape(indexer.IndexName(model))},
 	}
 	for _, f := range reqFuncs {
 		f(countReq)
@@ -233,28 +359,35 @@ func (indexer *Indexer) Count(model interface{}, reqFuncs ...func(*esapi.CountRe
 func (indexer *Indexer) Search(models interface{}, reqFuncs ...func(*esapi.SearchRequest)) (*SearchResult, error) {
 	v := reflect.ValueOf(models)
 	if v.Kind() != reflect.Ptr {
-		panic(fmt.Sprintf("invalid model: %#v", models))
+		return nil, indexer.config().fail(invalidModelError(models))
 	}
 
 	v = reflect.Indirect(v)
 	var size *int
+	var t reflect.Type
 	if v.Kind() == reflect.Struct {
 		s := 1
 		size = &s
+		t = v.Type()
 		v = reflect.ValueOf(&[...]interface{}{models}).Elem()
 	} else if v.Kind() == reflect.Array {
 		s := v.Len()
 		size = &s
-	} else if v.Kind() != reflect.Slice {
-		panic(fmt.Sprintf("invalid model: %#v", models))
+		t = v.Type().Elem()
+	} else if v.Kind() == reflect.Slice {
+		t = v.Type().Elem()
+	} else {
+		return nil, indexer.config().fail(invalidModelError(models))
 	}
 
-	t := v.Type().Elem()
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
+	if t.Kind() != reflect.Struct {
+		return nil, indexer.config().fail(invalidModelError(models))
+	}
 
-	rawSearchIndexNames := SearchIndexName(reflect.New(t).Interface())
+	rawSearchIndexNames := indexer.SearchIndexName(reflect.New(t).Interface())
 	searchIndexNames := make([]string, len(rawSearchIndexNames))
 	for i, indexName := range rawSearchIndexNames {
 		searchIndexNames[i] = url.QueryEscape(indexName)
@@ -264,6 +397,10 @@ func (indexer *Indexer) Search(models interface{}, reqFuncs ...func(*esapi.Searc
 		Index: searchIndexNames,
 		Size:  size,
 	}
+	if isVersionedModelType(t) {
+		searchReq.SeqNoPrimaryTerm = boolPtr(true)
+		searchReq.Version = boolPtr(true)
+	}
 	for _, f := range reqFuncs {
 		f(searchReq)
 	}
@@ -273,7 +410,7 @@ func (indexer *Indexer) Search(models interface{}, reqFuncs ...func(*esapi.Searc
 		return nil, err
 	}
 
-	if err := res.SetResult(v); err != nil {
+	if err := res.setResult(v, indexer.config()); err != nil {
 		return nil, err
 	}
 
@@ -281,6 +418,7 @@ func (indexer *Indexer) Search(models interface{}, reqFuncs ...func(*esapi.Searc
 		ScrollID:      res.ScrollID,
 		Total:         res.Hits.Total.Value,
 		TotalAccuracy: res.Hits.Total.Relation,
+		Aggregations:  res.Aggregations,
 	}, nil
 }
 
@@ -288,14 +426,25 @@ func (indexer *Indexer) Search(models interface{}, reqFuncs ...func(*esapi.Searc
 func (indexer *Indexer) Scroll(model interface{}, reqFuncs ...func(*esapi.ScrollRequest)) (*SearchResult, error) {
 	v := reflect.ValueOf(model)
 	if v.Kind() != reflect.Ptr {
-		panic(fmt.Sprintf("invalid model: %#v", model))
+		return nil, indexer.config().fail(invalidModelError(model))
 	}
 
 	v = reflect.Indirect(v)
+	var t reflect.Type
 	if v.Kind() == reflect.Struct {
+		t = v.Type()
 		v = reflect.ValueOf(&[...]interface{}{model}).Elem()
-	} else if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
-		panic(fmt.Sprintf("invalid model: %#v", model))
+	} else if v.Kind() == reflect.Array || v.Kind() == reflect.Slice {
+		t = v.Type().Elem()
+	} else {
+		return nil, indexer.config().fail(invalidModelError(model))
+	}
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, indexer.config().fail(invalidModelError(model))
 	}
 
 	scrollReq := &esapi.ScrollRequest{}
@@ -308,7 +457,7 @@ func (indexer *Indexer) Scroll(model interface{}, reqFuncs ...func(*esapi.Scroll
 		return nil, err
 	}
 
-	if err := res.SetResult(v); err != nil {
+	if err := res.setResult(v, indexer.config()); err != nil {
 		return nil, err
 	}
 
@@ -316,6 +465,7 @@ func (indexer *Indexer) Scroll(model interface{}, reqFuncs ...func(*esapi.Scroll
 		ScrollID:      res.ScrollID,
 		Total:         res.Hits.Total.Value,
 		TotalAccuracy: res.Hits.Total.Relation,
+		Aggregations:  res.Aggregations,
 	}, nil
 }
 
@@ -323,13 +473,51 @@ func (indexer *Indexer) Scroll(model interface{}, reqFuncs ...func(*esapi.Scroll
 // When models specified, it parses and set a model if succeeded.
 func (indexer *Indexer) Do(req Request, models ...interface{}) error {
 	if len(models) > 1 {
-		panic("Do only accept one or two arguments")
+		return indexer.config().fail(fmt.Errorf("%w: Do only accept one or two arguments", ErrTooManyArguments))
+	}
+
+	observer := indexer.observer
+	if observer == nil {
+		return indexer.do(indexer.ctx, req, models, nil)
+	}
+
+	event := newRequestEvent(req)
+	ctx := observer.OnRequestStart(indexer.ctx, event)
+	start := time.Now()
+	err := indexer.do(ctx, req, models, event)
+	event.Duration = time.Since(start)
+	event.Err = err
+	observer.OnRequestEnd(ctx, event)
+	return err
+}
+
+// do executes the request. If the event is not nil, the status and bytes are recorded to it.
+func (indexer *Indexer) do(ctx context.Context, req Request, models []interface{}, event *RequestEvent) error {
+	if timeout := indexer.config().Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	res, err := req.Do(indexer.ctx, indexer.client)
+	var transport esapi.Transport = indexer.client
+	if policy := indexer.retry; policy != nil && policy.canRetry(req) {
+		transport = &retryTransport{transport: transport, policy: policy}
+	}
+	if event != nil {
+		req = countRequestBytes(req, event)
+	}
+
+	res, err := indexer.invoker(transport)(ctx, req)
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
+	if event != nil {
+		event.Status = res.StatusCode
+		res.Body = &countingReadCloser{ReadCloser: res.Body, n: &event.ResponseBytes}
+		// NOTE: the body is read to the end to count the bytes of the response.
+		defer io.Copy(ioutil.Discard, res.Body)
+	}
 
 	if !res.IsError() && len(models) == 0 {
 		return nil
@@ -349,19 +537,13 @@ func (indexer *Indexer) Do(req Request, models ...interface{}) error {
 }
 
 func (indexer *Indexer) handleResponse(model interface{}, res *esapi.Response) error {
-	defer res.Body.Close()
-
 	b, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return err
 	}
 
 	if res.IsError() {
-		var errRes ErrorResponse
-		if err := json.Unmarshal(b, &errRes); err != nil {
-			return err
-		}
-		return &errRes
+		return newErrorResponse(res.StatusCode, b)
 	}
 
 	if err := json.Unmarshal(b, model); err != nil {
@@ -370,10 +552,9 @@ func (indexer *Indexer) handleResponse(model interface{}, res *esapi.Response) e
 	return nil
 }
 
-func assertModel(model interface{}) {
-	v := reflect.ValueOf(model)
-	if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
-		return
+func (indexer *Indexer) config() *Config {
+	if indexer.cfg != nil {
+		return indexer.cfg
 	}
-	panic(fmt.Sprintf("invalid model: %#v", model))
+	return getGlobalConfig()
 }
@@ -1,20 +1,46 @@
 package elsearm
 
 import (
+	"errors"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
 	elasticsearch "github.com/elastic/go-elasticsearch/v7"
+	"github.com/soranoba/elsearm/elsearmtest"
+	"github.com/soranoba/elsearm/query"
 )
 
 var indexer *Indexer
 
+var (
+	testClient     *elasticsearch.Client
+	testClientOnce sync.Once
+	// testCluster is the fake cluster of testClient. It is nil if ELASTICSEARCH_URL is set.
+	testCluster *elsearmtest.Cluster
+)
+
+// newTestClient returns a client of the Elasticsearch of ELASTICSEARCH_URL.
+// If ELASTICSEARCH_URL is not set, it returns a client of the in-memory fake cluster.
+func newTestClient() *elasticsearch.Client {
+	testClientOnce.Do(func() {
+		var err error
+		if os.Getenv("ELASTICSEARCH_URL") != "" {
+			testClient, err = elasticsearch.NewDefaultClient()
+		} else {
+			testCluster = elsearmtest.NewCluster()
+			testClient, err = testCluster.Client()
+		}
+		if err != nil {
+			panic("failed to create elasticsearch client")
+		}
+	})
+	return testClient
+}
+
 func init() {
-	esClient, err := elasticsearch.NewDefaultClient()
-	if err != nil {
-		panic("failed to create elasticsearch client")
-	}
-	indexer = NewIndexer(esClient)
+	indexer = NewIndexer(newTestClient())
 }
 
 func TestIndexerCreateIndexIfNotExist(t *testing.T) {
@@ -335,3 +361,95 @@ func TestIndexerScroll(t *testing.T) {
 		t.Errorf("invalid result: got %#v", users)
 	}
 }
+
+func TestIndexerSearch_query(t *testing.T) {
+	_ = indexer.DeleteIndex(&User{})
+	if err := indexer.CreateIndex(&User{}); err != nil {
+		t.Error(err)
+	}
+
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		if err := indexer.CreateWithoutID(&User{Name: name}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// NOTE: default refresh interval.
+	time.Sleep(1 * time.Second)
+
+	q := query.Bool().Should(query.Match("name", "Alice"), query.Match("name", "Carol"))
+
+	var users []User
+	if _, err := indexer.Search(&users, query.Search(q)); err != nil {
+		t.Error(err)
+	}
+	if len(users) != 2 {
+		t.Errorf("invalid result: got %#v", users)
+	}
+
+	count, err := indexer.Count(&User{}, query.Count(q))
+	if err != nil {
+		t.Error(err)
+	}
+	if count != 2 {
+		t.Errorf("invalid count: gots %d, wants %d", count, 2)
+	}
+}
+
+func TestIndexerSearch_aggregation(t *testing.T) {
+	_ = indexer.DeleteIndex(&User{})
+	if err := indexer.CreateIndex(&User{}); err != nil {
+		t.Error(err)
+	}
+
+	for _, name := range []string{"Alice", "Bob", "Alice"} {
+		if err := indexer.CreateWithoutID(&User{Name: name}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// NOTE: default refresh interval.
+	time.Sleep(1 * time.Second)
+
+	source := query.NewSearchSource().
+		Aggregation("names", query.TermsAgg("name.keyword"))
+
+	var users []User
+	result, err := indexer.Search(&users, source.SearchRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Errorf("invalid result: got %#v", users)
+	}
+
+	names, err := result.Aggregations.Terms("names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names.Buckets) != 2 ||
+		names.Buckets[0].Key != "Alice" || names.Buckets[0].DocCount != 2 ||
+		names.Buckets[1].Key != "Bob" || names.Buckets[1].DocCount != 1 {
+		t.Errorf("invalid aggregation: got %#v", names)
+	}
+}
+
+func TestIndexerErrors(t *testing.T) {
+	_ = indexer.DeleteIndex(&User{})
+	if err := indexer.Get(&User{ID: 1}); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	if err := indexer.CreateIndex(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.CreateIndex(&User{}); !errors.Is(err, ErrIndexAlreadyExists) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.Get(&User{ID: 1}); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.Delete(&User{ID: 1}); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
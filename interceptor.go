@@ -0,0 +1,249 @@
+package elsearm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// RedactedValue is the value that replaces the redacted fields in the logged body.
+const RedactedValue = "[REDACTED]"
+
+// Invoker executes the request.
+type Invoker func(ctx context.Context, req Request) (*esapi.Response, error)
+
+// Interceptor is a middleware of the requests of Indexer.
+// It should call next to execute the request, and it can return a response or an error without calling next.
+// The response may have no body. (e.g. &esapi.Response{StatusCode: 503})
+type Interceptor func(ctx context.Context, req Request, next Invoker) (*esapi.Response, error)
+
+// WithInterceptors appends the interceptors and returns a new Indexer.
+// The first interceptor is the outermost, and the retries of RetryPolicy are done inside of the interceptors.
+func (indexer *Indexer) WithInterceptors(interceptors ...Interceptor) *Indexer {
+	newIndexer := *indexer
+	newIndexer.interceptors = append(append([]Interceptor(nil), indexer.interceptors...), interceptors...)
+	return &newIndexer
+}
+
+func (indexer *Indexer) invoker(transport esapi.Transport) Invoker {
+	invoke := func(ctx context.Context, req Request) (*esapi.Response, error) {
+		return req.Do(ctx, transport)
+	}
+	for i := len(indexer.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := indexer.interceptors[i], invoke
+		invoke = func(ctx context.Context, req Request) (*esapi.Response, error) {
+			res, err := interceptor(ctx, req, next)
+			if res == nil && err == nil {
+				return nil, errors.New("elsearm: the interceptor returned neither a response nor an error")
+			}
+			if res != nil && res.Body == nil {
+				// NOTE: the interceptor may return a response without the body. (e.g. fault injection)
+				res.Body = http.NoBody
+			}
+			return res, err
+		}
+	}
+	return invoke
+}
+
+// WrapTransport returns a Request that executes req with the transport wrapped by wrap.
+// It is useful for the interceptors to access the http.Request (e.g. to set headers).
+func WrapTransport(req Request, wrap func(transport esapi.Transport) esapi.Transport) Request {
+	return &wrappedRequest{Request: req, wrap: wrap}
+}
+
+// TransportFunc is an adapter to use the function as esapi.Transport.
+type TransportFunc func(req *http.Request) (*http.Response, error)
+
+// Perform calls f(req).
+func (f TransportFunc) Perform(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type wrappedRequest struct {
+	Request
+	wrap func(transport esapi.Transport) esapi.Transport
+}
+
+// Do executes the request with the wrapped transport.
+func (r *wrappedRequest) Do(ctx context.Context, transport esapi.Transport) (*esapi.Response, error) {
+	return r.Request.Do(ctx, r.wrap(transport))
+}
+
+// OperationName returns a name of the request. It is the name of the esapi request without the suffix (e.g. Index, IndicesCreate).
+func OperationName(req Request) string {
+	req = unwrapRequest(req)
+	if raw, ok := req.(*rawRequest); ok {
+		return raw.Name
+	}
+
+	t := reflect.TypeOf(req)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return strings.TrimSuffix(t.Name(), "Request")
+}
+
+func unwrapRequest(req Request) Request {
+	for {
+		switch r := req.(type) {
+		case *wrappedRequest:
+			req = r.Request
+		case *nonIdempotentRequest:
+			req = r.Request
+		default:
+			return req
+		}
+	}
+}
+
+// HeaderInterceptor returns an Interceptor that sets the headers to each request. (e.g. Authorization)
+func HeaderInterceptor(header http.Header) Interceptor {
+	return func(ctx context.Context, req Request, next Invoker) (*esapi.Response, error) {
+		return next(ctx, WrapTransport(req, func(transport esapi.Transport) esapi.Transport {
+			return TransportFunc(func(r *http.Request) (*http.Response, error) {
+				for k, values := range header {
+					r.Header.Del(k)
+					for _, v := range values {
+						r.Header.Add(k, v)
+					}
+				}
+				return transport.Perform(r)
+			})
+		}))
+	}
+}
+
+// RequestLog is a log of the request.
+type RequestLog struct {
+	// A name of the request. (see OperationName)
+	Operation string
+	Method    string
+	// A path and query of the request.
+	Path string
+	// A request body which the fields are redacted.
+	Body     string
+	Status   int
+	Duration time.Duration
+	Err      error
+}
+
+// String returns a log line of the request.
+func (entry *RequestLog) String() string {
+	result := fmt.Sprintf("%s %s %s status=%d duration=%s", entry.Operation, entry.Method, entry.Path, entry.Status, entry.Duration)
+	if entry.Err != nil {
+		result += fmt.Sprintf(" error=%q", entry.Err.Error())
+	}
+	if entry.Body != "" {
+		result += " body=" + entry.Body
+	}
+	return result
+}
+
+// LoggingInterceptor returns an Interceptor that writes the log of each request with logf.
+// The values of redactFields in the request body are replaced by RedactedValue at any depth.
+// If the body is not JSON or NDJSON and the redactFields are specified, the whole body is redacted.
+func LoggingInterceptor(logf func(ctx context.Context, entry *RequestLog), redactFields ...string) Interceptor {
+	return func(ctx context.Context, req Request, next Invoker) (*esapi.Response, error) {
+		res, entry, err := invokeWithLog(ctx, req, next, redactFields)
+		logf(ctx, entry)
+		return res, err
+	}
+}
+
+// SlowRequestInterceptor returns an Interceptor that reports the requests that take threshold or more.
+// The values of redactFields in the request body are redacted the same as LoggingInterceptor.
+func SlowRequestInterceptor(threshold time.Duration, report func(ctx context.Context, entry *RequestLog), redactFields ...string) Interceptor {
+	return func(ctx context.Context, req Request, next Invoker) (*esapi.Response, error) {
+		res, entry, err := invokeWithLog(ctx, req, next, redactFields)
+		if entry.Duration >= threshold {
+			report(ctx, entry)
+		}
+		return res, err
+	}
+}
+
+func invokeWithLog(ctx context.Context, req Request, next Invoker, redactFields []string) (*esapi.Response, *RequestLog, error) {
+	entry := &RequestLog{Operation: OperationName(req)}
+	logged := WrapTransport(req, func(transport esapi.Transport) esapi.Transport {
+		return TransportFunc(func(r *http.Request) (*http.Response, error) {
+			entry.Method = r.Method
+			entry.Path = r.URL.RequestURI()
+			if r.Body != nil {
+				b, err := ioutil.ReadAll(r.Body)
+				r.Body.Close()
+				if err != nil {
+					return nil, err
+				}
+				r.Body = ioutil.NopCloser(bytes.NewReader(b))
+				entry.Body = string(redactBody(b, redactFields))
+			}
+			return transport.Perform(r)
+		})
+	})
+
+	start := time.Now()
+	res, err := next(ctx, logged)
+	entry.Duration = time.Since(start)
+	entry.Err = err
+	if res != nil {
+		entry.Status = res.StatusCode
+	}
+	return res, entry, err
+}
+
+// redactBody replaces the values of the fields in the JSON or NDJSON body.
+func redactBody(body []byte, fields []string) []byte {
+	if len(fields) == 0 {
+		return bytes.TrimSpace(body)
+	}
+
+	redact := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		redact[f] = true
+	}
+
+	var lines [][]byte
+	for _, line := range bytes.Split(bytes.TrimSpace(body), []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(line, &v); err != nil {
+			return []byte(RedactedValue)
+		}
+		b, err := json.Marshal(redactValue(v, redact))
+		if err != nil {
+			return []byte(RedactedValue)
+		}
+		lines = append(lines, b)
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+func redactValue(v interface{}, redact map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if redact[k] {
+				v[k] = RedactedValue
+			} else {
+				v[k] = redactValue(child, redact)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactValue(child, redact)
+		}
+	}
+	return v
+}
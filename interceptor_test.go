@@ -0,0 +1,223 @@
+package elsearm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+func TestIndexer_WithInterceptors(t *testing.T) {
+	transport, indexer := newStubIndexer(t, indexed)
+
+	var calls []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, req Request, next Invoker) (*esapi.Response, error) {
+			calls = append(calls, name+":"+OperationName(req))
+			res, err := next(ctx, req)
+			calls = append(calls, name+":done")
+			return res, err
+		}
+	}
+	base := indexer.WithInterceptors(record("a"))
+	if err := base.WithInterceptors(record("b")).Update(&User{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, ",") != "a:Index,b:Index,b:done,a:done" {
+		t.Errorf("invalid calls: got %v", calls)
+	}
+
+	calls = nil
+	if err := base.Update(&User{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, ",") != "a:Index,a:done" {
+		t.Errorf("invalid calls: got %v", calls)
+	}
+	if transport.attempts() != 2 {
+		t.Errorf("invalid attempts: got %d", transport.attempts())
+	}
+}
+
+func TestIndexer_WithInterceptors_faultInjection(t *testing.T) {
+	transport, indexer := newStubIndexer(t, indexed)
+
+	errInjected := errors.New("injected")
+	indexer = indexer.WithInterceptors(func(ctx context.Context, req Request, next Invoker) (*esapi.Response, error) {
+		return nil, errInjected
+	})
+	if err := indexer.Update(&User{ID: 1}); !errors.Is(err, errInjected) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if transport.attempts() != 0 {
+		t.Errorf("invalid attempts: got %d", transport.attempts())
+	}
+
+	_, unavailable := newStubIndexer(t, indexed)
+	unavailable = unavailable.WithInterceptors(func(ctx context.Context, req Request, next Invoker) (*esapi.Response, error) {
+		return &esapi.Response{StatusCode: http.StatusServiceUnavailable}, nil
+	})
+	var errRes *ErrorResponse
+	if err := unavailable.Update(&User{ID: 1}); !errors.As(err, &errRes) || errRes.Status != http.StatusServiceUnavailable {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := unavailable.WithObserver(&recordingObserver{}).Get(&User{ID: 1}); !errors.As(err, &errRes) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	indexer = indexer.WithInterceptors(func(ctx context.Context, req Request, next Invoker) (*esapi.Response, error) {
+		return nil, nil
+	})
+	if err := indexer.Update(&User{ID: 1}); err == nil {
+		t.Errorf("Update should fail but succeeded")
+	}
+}
+
+func TestHeaderInterceptor(t *testing.T) {
+	transport, indexer := newStubIndexer(t, indexed)
+
+	header := http.Header{}
+	header.Set("Authorization", "ApiKey secret")
+	if err := indexer.WithInterceptors(HeaderInterceptor(header)).Update(&User{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := transport.headers[0].Get("Authorization"); got != "ApiKey secret" {
+		t.Errorf("invalid header: got %s", got)
+	}
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	_, indexer := newStubIndexer(t, indexed, unavailable)
+
+	var entries []*RequestLog
+	logf := func(ctx context.Context, entry *RequestLog) {
+		entries = append(entries, entry)
+	}
+	indexer = indexer.WithInterceptors(LoggingInterceptor(logf, "name"))
+	if err := indexer.Update(&User{ID: 1, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Delete(&User{ID: 1}); err == nil {
+		t.Fatal("Delete should fail but succeeded")
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("invalid entries: got %#v", entries)
+	}
+	entry := entries[0]
+	if entry.Operation != "Index" || entry.Method != http.MethodPut || entry.Path != "/user/_doc/1" ||
+		entry.Body != `{"id":1,"name":"[REDACTED]"}` || entry.Status != 200 || entry.Err != nil {
+		t.Errorf("invalid entry: got %#v", entry)
+	}
+	if strings.Contains(entry.String(), "Alice") {
+		t.Errorf("the body is not redacted: %s", entry)
+	}
+	entry = entries[1]
+	if entry.Operation != "Delete" || entry.Method != http.MethodDelete || entry.Status != 503 || entry.Body != "" {
+		t.Errorf("invalid entry: got %#v", entry)
+	}
+}
+
+func TestSlowRequestInterceptor(t *testing.T) {
+	_, indexer := newStubIndexer(t, indexed)
+
+	var reported []*RequestLog
+	report := func(ctx context.Context, entry *RequestLog) {
+		reported = append(reported, entry)
+	}
+	delay := func(ctx context.Context, req Request, next Invoker) (*esapi.Response, error) {
+		time.Sleep(10 * time.Millisecond)
+		return next(ctx, req)
+	}
+	if err := indexer.WithInterceptors(SlowRequestInterceptor(time.Hour, report), delay).Update(&User{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != 0 {
+		t.Errorf("invalid reports: got %#v", reported)
+	}
+	if err := indexer.WithInterceptors(SlowRequestInterceptor(10*time.Millisecond, report, "name"), delay).Update(&User{ID: 1, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != 1 || reported[0].Duration < 10*time.Millisecond || reported[0].Body != `{"id":1,"name":"[REDACTED]"}` {
+		t.Errorf("invalid reports: got %#v", reported)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	_, indexer := newStubIndexer(t, indexed)
+
+	histogram := NewLatencyHistogram()
+	indexer = indexer.WithInterceptors(histogram.Interceptor())
+	for i := 0; i < 2; i++ {
+		if err := indexer.Update(&User{ID: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := histogram.Snapshot()["Index"]; stats.Count != 2 || len(stats.Buckets) != len(DefaultLatencyBuckets) {
+		t.Errorf("invalid stats: got %#v", stats)
+	}
+
+	histogram = NewLatencyHistogram(time.Second, 10*time.Millisecond)
+	var wg sync.WaitGroup
+	for _, d := range []time.Duration{time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, time.Minute} {
+		wg.Add(1)
+		go func(d time.Duration) {
+			defer wg.Done()
+			histogram.Observe("Search", d)
+		}(d)
+	}
+	wg.Wait()
+
+	stats := histogram.Snapshot()["Search"]
+	if stats.Count != 4 || stats.Sum != time.Minute+31*time.Millisecond {
+		t.Errorf("invalid stats: got %#v", stats)
+	}
+	wants := []LatencyBucket{{10 * time.Millisecond, 2}, {time.Second, 3}}
+	if len(stats.Buckets) != len(wants) || stats.Buckets[0] != wants[0] || stats.Buckets[1] != wants[1] {
+		t.Errorf("invalid buckets: got %#v", stats.Buckets)
+	}
+}
+
+func TestOperationName(t *testing.T) {
+	tests := []struct {
+		req   Request
+		wants string
+	}{
+		{&esapi.IndexRequest{}, "Index"},
+		{esapi.IndicesCreateRequest{}, "IndicesCreate"},
+		{&rawRequest{Name: "OpenPointInTime"}, "OpenPointInTime"},
+		{WrapTransport(&esapi.SearchRequest{}, nil), "Search"},
+		{&nonIdempotentRequest{Request: &esapi.UpdateRequest{}}, "Update"},
+	}
+	for _, tt := range tests {
+		if got := OperationName(tt.req); got != tt.wants {
+			t.Errorf("invalid name: got %s, wants %s", got, tt.wants)
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		fields []string
+		wants  string
+	}{
+		{"no fields", "{\"name\":\"Alice\"}\n", nil, `{"name":"Alice"}`},
+		{"nested", `{"doc":{"name":"Alice","tags":[{"name":"a","id":1}]}}`, []string{"name"}, `{"doc":{"name":"[REDACTED]","tags":[{"id":1,"name":"[REDACTED]"}]}}`},
+		{"ndjson", "{\"index\":{\"_id\":\"1\"}}\n{\"password\":\"secret\"}\n", []string{"password"}, "{\"index\":{\"_id\":\"1\"}}\n{\"password\":\"[REDACTED]\"}"},
+		{"not json", "password=secret", []string{"password"}, RedactedValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(redactBody([]byte(tt.body), tt.fields)); got != tt.wants {
+				t.Errorf("invalid body: got %s, wants %s", got, tt.wants)
+			}
+		})
+	}
+}
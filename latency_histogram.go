@@ -0,0 +1,103 @@
+package elsearm
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// DefaultLatencyBuckets is the upper bounds of the buckets when NewLatencyHistogram is called without buckets.
+var DefaultLatencyBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// LatencyHistogram records the latencies of the requests per operation. (see OperationName)
+// It is safe for concurrent use.
+type LatencyHistogram struct {
+	mu      sync.Mutex
+	bounds  []time.Duration
+	latency map[string]*LatencyStats
+}
+
+// LatencyStats is the latencies of an operation.
+type LatencyStats struct {
+	// A number of the requests.
+	Count int64
+	// A sum of the latencies.
+	Sum time.Duration
+	// The buckets in ascending order of UpperBound. The counts are cumulative, so the count of +Inf is Count.
+	Buckets []LatencyBucket
+}
+
+// LatencyBucket is a bucket of LatencyStats.
+type LatencyBucket struct {
+	UpperBound time.Duration
+	// A number of the requests that took UpperBound or less.
+	Count int64
+}
+
+// NewLatencyHistogram creates a LatencyHistogram. If buckets are not specified, DefaultLatencyBuckets is used.
+func NewLatencyHistogram(buckets ...time.Duration) *LatencyHistogram {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	bounds := append([]time.Duration(nil), buckets...)
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	return &LatencyHistogram{
+		bounds:  bounds,
+		latency: map[string]*LatencyStats{},
+	}
+}
+
+// Interceptor returns an Interceptor that records the latencies to the histogram.
+func (h *LatencyHistogram) Interceptor() Interceptor {
+	return func(ctx context.Context, req Request, next Invoker) (*esapi.Response, error) {
+		start := time.Now()
+		res, err := next(ctx, req)
+		h.Observe(OperationName(req), time.Since(start))
+		return res, err
+	}
+}
+
+// Observe records the latency of the operation.
+func (h *LatencyHistogram) Observe(operation string, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats, ok := h.latency[operation]
+	if !ok {
+		stats = &LatencyStats{Buckets: make([]LatencyBucket, len(h.bounds))}
+		for i, bound := range h.bounds {
+			stats.Buckets[i].UpperBound = bound
+		}
+		h.latency[operation] = stats
+	}
+	stats.Count++
+	stats.Sum += d
+	for i := range stats.Buckets {
+		if d <= stats.Buckets[i].UpperBound {
+			stats.Buckets[i].Count++
+		}
+	}
+}
+
+// Snapshot returns a copy of the latencies per operation.
+func (h *LatencyHistogram) Snapshot() map[string]LatencyStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := make(map[string]LatencyStats, len(h.latency))
+	for op, stats := range h.latency {
+		result[op] = LatencyStats{
+			Count:   stats.Count,
+			Sum:     stats.Sum,
+			Buckets: append([]LatencyBucket(nil), stats.Buckets...),
+		}
+	}
+	return result
+}
@@ -0,0 +1,310 @@
+package elsearm
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	tagName = "elsearm"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	marshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// fieldTag is the parsed elsearm tag.
+type fieldTag struct {
+	ignore   bool
+	typ      string
+	analyzer string
+	noIndex  bool
+	keyword  bool
+	fields   [][2]string
+	nested   bool
+	copyTo   []string
+	format   string
+	version  bool
+}
+
+// Mappings returns a mappings of the model, which is generated from the json tags, elsearm tags and Go types.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/mapping.html
+//
+// By default, the field types are decided as follows.
+//
+//	string               text (with keyword subfield if no options are specified, same as the dynamic mapping)
+//	bool                 boolean
+//	int, uint, ...       long
+//	float32              float
+//	float64              double
+//	time.Time            date
+//	[]byte               binary
+//	struct               object
+//	slice, array         the type of element
+//
+// The other types (e.g. interface{}, map and json.Marshaler) are not included, so they are mapped dynamically.
+//
+// The mappings can be customized with the elsearm tag, which is comma separated options.
+//
+//	type:<type>          the field data type. (e.g. `type:keyword`)
+//	analyzer:<analyzer>  the analyzer of text field.
+//	index:false          the field is not indexed.
+//	keyword              add a keyword subfield named `keyword`.
+//	field:<name>=<type>  add a subfield. (multi-fields)
+//	nested               the struct field is mapped as nested type.
+//	copy_to:<field>      copy the value to the field.
+//	format:<format>      the date format of date field.
+//	version              the field is the external version. (see DefaultExternalVersion)
+//	-                    the field is not included in mappings.
+//
+// For example, `elsearm:"type:text,analyzer:kuromoji,keyword"`.
+func Mappings(model interface{}) (map[string]interface{}, error) {
+	if model == nil {
+		return nil, invalidModelError(model)
+	}
+
+	t := reflectValue(model).Type()
+	if t.Kind() != reflect.Struct {
+		return nil, invalidModelError(model)
+	}
+
+	properties, err := structProperties(t, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"properties": properties}, nil
+}
+
+func structProperties(t reflect.Type, visited map[reflect.Type]bool) (map[string]interface{}, error) {
+	if visited[t] {
+		return map[string]interface{}{}, nil
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name, ok := jsonFieldName(f)
+		if !ok {
+			continue
+		}
+
+		tag, err := parseFieldTag(f.Tag.Get(tagName))
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", t.Name(), f.Name, err)
+		}
+		if tag.ignore {
+			continue
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		// Embedded structs are flattened the same as encoding/json.
+		if f.Anonymous && ft.Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			embedded, err := structProperties(ft, visited)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range embedded {
+				if _, ok := properties[k]; !ok {
+					properties[k] = v
+				}
+			}
+			continue
+		}
+
+		property, err := fieldProperty(ft, tag, visited)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", t.Name(), f.Name, err)
+		}
+		if property != nil {
+			properties[name] = property
+		}
+	}
+	return properties, nil
+}
+
+func fieldProperty(t reflect.Type, tag *fieldTag, visited map[reflect.Type]bool) (map[string]interface{}, error) {
+	typ, properties, err := fieldType(t, visited)
+	if err != nil {
+		return nil, err
+	}
+	if typ == "text" && tag.isEmpty() {
+		tag.keyword = true
+	}
+	if properties != nil && tag.nested {
+		typ = "nested"
+	}
+	if tag.typ != "" {
+		typ = tag.typ
+	}
+	if typ == "" && properties == nil {
+		if tag.isEmpty() {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot decide the type of %s", t)
+	}
+
+	property := map[string]interface{}{}
+	if typ != "" {
+		property["type"] = typ
+	}
+	if properties != nil {
+		property["properties"] = properties
+	}
+
+	if tag.nested && property["type"] != "nested" {
+		return nil, fmt.Errorf("nested is available only for struct fields")
+	}
+	if tag.analyzer != "" {
+		property["analyzer"] = tag.analyzer
+	}
+	if tag.noIndex {
+		property["index"] = false
+	}
+	if tag.format != "" {
+		property["format"] = tag.format
+	}
+	if len(tag.copyTo) > 0 {
+		property["copy_to"] = tag.copyTo
+	}
+
+	fields := map[string]interface{}{}
+	if tag.keyword {
+		fields["keyword"] = map[string]interface{}{"type": "keyword", "ignore_above": 256}
+	}
+	for _, f := range tag.fields {
+		fields[f[0]] = map[string]interface{}{"type": f[1]}
+	}
+	if len(fields) > 0 {
+		property["fields"] = fields
+	}
+	return property, nil
+}
+
+// fieldType returns the field data type or the properties of object.
+// It returns an empty string and nil, if it cannot decide the type.
+func fieldType(t reflect.Type, visited map[reflect.Type]bool) (string, map[string]interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return "date", nil, nil
+	case t == rawMessageType:
+		return "", nil, nil
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType):
+		return "", nil, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "text", nil, nil
+	case reflect.Bool:
+		return "boolean", nil, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "long", nil, nil
+	case reflect.Float32:
+		return "float", nil, nil
+	case reflect.Float64:
+		return "double", nil, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "binary", nil, nil
+		}
+		return fieldType(t.Elem(), visited)
+	case reflect.Struct:
+		properties, err := structProperties(t, visited)
+		return "", properties, err
+	default:
+		return "", nil, nil
+	}
+}
+
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" && !f.Anonymous {
+		return "", false
+	}
+
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		name = f.Name
+	}
+	return name, true
+}
+
+func parseFieldTag(tag string) (*fieldTag, error) {
+	ft := &fieldTag{}
+	if tag == "" {
+		return ft, nil
+	}
+	if tag == "-" {
+		ft.ignore = true
+		return ft, nil
+	}
+
+	for _, opt := range strings.Split(tag, ",") {
+		kv := strings.SplitN(opt, ":", 2)
+		key := strings.TrimSpace(kv[0])
+		var value string
+		if len(kv) == 2 {
+			value = strings.TrimSpace(kv[1])
+		}
+
+		switch key {
+		case "type":
+			ft.typ = value
+		case "analyzer":
+			ft.analyzer = value
+		case "index":
+			if value != "false" {
+				return nil, fmt.Errorf("invalid %s tag: %s", tagName, opt)
+			}
+			ft.noIndex = true
+		case "keyword":
+			ft.keyword = true
+		case "field":
+			nameAndType := strings.SplitN(value, "=", 2)
+			if len(nameAndType) != 2 || nameAndType[0] == "" || nameAndType[1] == "" {
+				return nil, fmt.Errorf("invalid %s tag: %s", tagName, opt)
+			}
+			ft.fields = append(ft.fields, [2]string{nameAndType[0], nameAndType[1]})
+		case "nested":
+			ft.nested = true
+		case "copy_to":
+			ft.copyTo = append(ft.copyTo, value)
+		case "format":
+			ft.format = value
+		case "version":
+			ft.version = true
+		default:
+			return nil, fmt.Errorf("invalid %s tag: %s", tagName, opt)
+		}
+
+		if value == "" && key != "keyword" && key != "nested" && key != "version" {
+			return nil, fmt.Errorf("invalid %s tag: %s", tagName, opt)
+		}
+	}
+	return ft, nil
+}
+
+func (ft *fieldTag) isEmpty() bool {
+	return ft.typ == "" && ft.analyzer == "" && !ft.noIndex && !ft.keyword &&
+		len(ft.fields) == 0 && !ft.nested && len(ft.copyTo) == 0 && ft.format == ""
+}
@@ -0,0 +1,203 @@
+package elsearm
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Timestamps struct {
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" elsearm:"format:strict_date_optional_time||epoch_millis"`
+}
+
+type Member struct {
+	Name string `json:"name" elsearm:"type:keyword"`
+	Age  int8   `json:"age"`
+}
+
+type Article struct {
+	Timestamps
+	ID       uint64                 `json:"id"`
+	Title    string                 `json:"title" elsearm:"analyzer:kuromoji,keyword,copy_to:all"`
+	Body     string                 `json:"body" elsearm:"index:false"`
+	Slug     string                 `json:"slug" elsearm:"type:keyword,field:text=text"`
+	Tags     []string               `json:"tags" elsearm:"type:keyword"`
+	Score    float64                `json:"score"`
+	Rate     float32                `json:"rate"`
+	Public   bool                   `json:"public"`
+	Members  []Member               `json:"members" elsearm:"nested"`
+	Author   *Member                `json:"author"`
+	Image    []byte                 `json:"image"`
+	Extra    map[string]interface{} `json:"extra"`
+	Raw      json.RawMessage        `json:"raw"`
+	All      string                 `json:"all" elsearm:"type:text"`
+	Internal string                 `json:"-"`
+	Ignored  string                 `json:"ignored" elsearm:"-"`
+	private  string
+}
+
+func TestMappings(t *testing.T) {
+	mappings, err := Mappings(&Article{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wants := `{
+		"properties": {
+			"created_at": { "type": "date" },
+			"deleted_at": { "type": "date", "format": "strict_date_optional_time||epoch_millis" },
+			"id": { "type": "long" },
+			"title": {
+				"type": "text",
+				"analyzer": "kuromoji",
+				"copy_to": ["all"],
+				"fields": { "keyword": { "type": "keyword", "ignore_above": 256 } }
+			},
+			"body": { "type": "text", "index": false },
+			"slug": { "type": "keyword", "fields": { "text": { "type": "text" } } },
+			"tags": { "type": "keyword" },
+			"score": { "type": "double" },
+			"rate": { "type": "float" },
+			"public": { "type": "boolean" },
+			"members": {
+				"type": "nested",
+				"properties": {
+					"name": { "type": "keyword" },
+					"age": { "type": "long" }
+				}
+			},
+			"author": {
+				"properties": {
+					"name": { "type": "keyword" },
+					"age": { "type": "long" }
+				}
+			},
+			"image": { "type": "binary" },
+			"all": { "type": "text" }
+		}
+	}`
+	assertJSONEqual(t, mappings, wants)
+}
+
+func TestMappings_default(t *testing.T) {
+	mappings, err := Mappings(&User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wants := `{
+		"properties": {
+			"id": { "type": "long" },
+			"name": {
+				"type": "text",
+				"fields": { "keyword": { "type": "keyword", "ignore_above": 256 } }
+			}
+		}
+	}`
+	assertJSONEqual(t, mappings, wants)
+}
+
+func TestMappings_version(t *testing.T) {
+	type Revisioned struct {
+		ID        uint64    `json:"id"`
+		Revision  int64     `json:"revision" elsearm:"version"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+
+	mappings, err := Mappings(&Revisioned{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wants := `{
+		"properties": {
+			"id": { "type": "long" },
+			"revision": { "type": "long" },
+			"updated_at": { "type": "date" }
+		}
+	}`
+	assertJSONEqual(t, mappings, wants)
+}
+
+func TestMappings_invalidTag(t *testing.T) {
+	type InvalidType struct {
+		Name string `json:"name" elsearm:"unknown"`
+	}
+	if _, err := Mappings(&InvalidType{}); err == nil {
+		t.Errorf("Mappings should fail but succeeded")
+	}
+
+	type InvalidNested struct {
+		Name string `json:"name" elsearm:"nested"`
+	}
+	if _, err := Mappings(&InvalidNested{}); err == nil {
+		t.Errorf("Mappings should fail but succeeded")
+	}
+}
+
+func TestIndexSettings(t *testing.T) {
+	reader, err := IndexSettings(&User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var settings map[string]interface{}
+	if err := json.Unmarshal(b, &settings); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := settings["mappings"]; !ok {
+		t.Errorf("invalid settings: got = %s", b)
+	}
+}
+
+func TestIndexSettings_customDocumentBody(t *testing.T) {
+	if _, err := IndexSettings(&Team{}); !errors.Is(err, ErrIndexSettingsRequired) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.CreateIndex(&Team{}); !errors.Is(err, ErrIndexSettingsRequired) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	reader, err := IndexSettings(&User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal(b, &settings); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := settings["mappings"]; !ok {
+		t.Errorf("the mappings should be generated: got = %s", b)
+	}
+}
+
+func assertJSONEqual(t *testing.T, v interface{}, wants string) {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gots, wantsValue interface{}
+	if err := json.Unmarshal(b, &gots); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(wants), &wantsValue); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gots, wantsValue) {
+		t.Errorf("invalid json: gots %s, wants %s", b, wants)
+	}
+}
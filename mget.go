@@ -0,0 +1,123 @@
+package elsearm
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// MGetItem is a result of each model of MGet.
+type MGetItem struct {
+	// It is true if the document is found and set to the model.
+	Found bool
+	// An error of the item. (e.g. the index does not exist) It is nil if the document is just not found.
+	Err error
+}
+
+// mgetDoc is a document to get with the multi get API.
+type mgetDoc struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+// MGet gets the documents of the models with one multi get API request, and sets them to the models.
+// models must be a slice or an array of the models whose DocumentID is set. The models can have different indices.
+// It returns the results in the same order as the models. The models of not found documents are not changed.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-multi-get.html
+func (indexer *Indexer) MGet(models interface{}, reqFuncs ...func(*esapi.MgetRequest)) ([]MGetItem, error) {
+	v := reflect.Indirect(reflect.ValueOf(models))
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, indexer.config().fail(invalidModelError(models))
+	}
+
+	targets := make([]interface{}, v.Len())
+	docs := make([]mgetDoc, v.Len())
+	for i := range targets {
+		model := modelAt(v, i)
+		if model == nil {
+			return nil, indexer.config().fail(invalidModelError(models))
+		}
+		documentId, err := DocumentID(model)
+		if err != nil {
+			return nil, err
+		}
+		targets[i] = model
+		docs[i] = mgetDoc{Index: indexer.IndexName(model), ID: documentId}
+	}
+	return indexer.mget(targets, docs, reqFuncs...)
+}
+
+func (indexer *Indexer) mget(models []interface{}, docs []mgetDoc, reqFuncs ...func(*esapi.MgetRequest)) ([]MGetItem, error) {
+	items := make([]MGetItem, len(models))
+	if len(models) == 0 {
+		return items, nil
+	}
+
+	b, err := json.Marshal(map[string]interface{}{"docs": docs})
+	if err != nil {
+		return nil, err
+	}
+
+	mgetReq := &esapi.MgetRequest{Body: bytes.NewReader(b)}
+	for _, f := range reqFuncs {
+		f(mgetReq)
+	}
+
+	var res struct {
+		Docs []struct {
+			ID     string          `json:"_id"`
+			Found  bool            `json:"found"`
+			Source json.RawMessage `json:"_source"`
+			Error  json.RawMessage `json:"error"`
+			documentMeta
+		} `json:"docs"`
+	}
+	if err := indexer.Do(mgetReq, &res); err != nil {
+		return nil, err
+	}
+
+	for i, doc := range res.Docs {
+		if i >= len(models) {
+			break
+		}
+		if len(doc.Error) > 0 {
+			b, err := json.Marshal(map[string]json.RawMessage{"error": doc.Error})
+			if err != nil {
+				return nil, err
+			}
+			items[i].Err = newErrorResponse(0, b)
+			continue
+		}
+		if !doc.Found {
+			continue
+		}
+
+		model := models[i]
+		if err := ParseDocument(model, bytes.NewReader(doc.Source)); err != nil {
+			return nil, err
+		}
+		if err := SetDocumentID(model, doc.ID); err != nil {
+			return nil, err
+		}
+		doc.setTo(model)
+		items[i].Found = true
+	}
+	return items, nil
+}
+
+// modelAt returns the model of the element, which is a pointer to struct. If it is not a model, it returns nil.
+func modelAt(v reflect.Value, i int) interface{} {
+	vv := v.Index(i)
+	if vv.Kind() == reflect.Interface && !vv.IsNil() {
+		vv = vv.Elem()
+	}
+	switch {
+	case vv.Kind() == reflect.Ptr && !vv.IsNil() && vv.Elem().Kind() == reflect.Struct:
+		return vv.Interface()
+	case vv.Kind() == reflect.Struct && vv.CanAddr():
+		return vv.Addr().Interface()
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package elsearm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIndexerMGet(t *testing.T) {
+	_ = indexer.DeleteIndex(&User{})
+	_ = indexer.DeleteIndex(&Wallet{})
+	_ = indexer.DeleteIndex(&Team{})
+	if err := indexer.CreateIndex(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.CreateIndex(&Wallet{}); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"Alice", "Bob"} {
+		if err := indexer.Update(&User{ID: uint(i + 1), Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := indexer.Update(&Wallet{ID: 1, Balance: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	users := []User{{ID: 2}, {ID: 3, Name: "unchanged"}, {ID: 1}}
+	items, err := indexer.MGet(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || !items[0].Found || items[1].Found || items[1].Err != nil || !items[2].Found {
+		t.Errorf("invalid items: got %#v", items)
+	}
+	if users[0].Name != "Bob" || users[1].Name != "unchanged" || users[2].Name != "Alice" {
+		t.Errorf("invalid result: got %#v", users)
+	}
+
+	wallet := &Wallet{ID: 1}
+	models := []interface{}{&User{ID: 1}, wallet, &Team{ID: 1}}
+	items, err = indexer.MGet(models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !items[0].Found || !items[1].Found || items[2].Found {
+		t.Errorf("invalid items: got %#v", items)
+	}
+	if wallet.Balance != 100 || wallet.IsZero() {
+		t.Errorf("invalid result: got %#v", wallet)
+	}
+	if !errors.Is(items[2].Err, ErrIndexNotFound) {
+		t.Errorf("invalid error: got %#v", items[2].Err)
+	}
+
+	if items, err := indexer.MGet([]*User{}); err != nil || len(items) != 0 {
+		t.Errorf("invalid result: got (%#v, %v)", items, err)
+	}
+	if _, err := indexer.MGet(&User{}); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
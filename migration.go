@@ -0,0 +1,394 @@
+package elsearm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// DocumentSource is an iterator of models that are indexed to the new index by Indexer.Migrate.
+type DocumentSource interface {
+	// Next returns the next model. It returns io.EOF when there are no more models.
+	Next() (interface{}, error)
+}
+
+// MigrationOptions is the options of Indexer.Migrate.
+type MigrationOptions struct {
+	// A source of documents to index.
+	// If it is nil, the documents are copied from the current index with the reindex API.
+	Source DocumentSource
+	// The number of old versions to keep after the migration.
+	// If it is zero, the old versions are not deleted.
+	Retention int
+	// The number of documents of each bulk request when copying from Source.
+	// If it is zero, DefaultMigrationBatchSize is used.
+	BatchSize int
+}
+
+// DefaultMigrationBatchSize is the number of documents of each bulk request when BatchSize is not set.
+const DefaultMigrationBatchSize = 500
+
+type indexVersions struct {
+	alias    string
+	versions []int
+	current  int
+	// true, if a concrete index which has the same name as the alias exists.
+	legacy bool
+}
+
+// VersionedIndexName returns a name of the concrete index of the version.
+// For example, `user_v3`.
+func VersionedIndexName(model interface{}, version int) string {
+	return versionedIndexName(IndexName(model), version)
+}
+
+// VersionedIndexName returns a name of the concrete index of the version, which is resolved by the config of the Indexer.
+func (indexer *Indexer) VersionedIndexName(model interface{}, version int) string {
+	return versionedIndexName(indexer.IndexName(model), version)
+}
+
+func versionedIndexName(alias string, version int) string {
+	return alias + "_v" + strconv.Itoa(version)
+}
+
+// IndexVersions returns the versions of the concrete indices, and the version that the index name points to.
+// The current version is zero if the index name is not an alias of the versioned indices.
+func (indexer *Indexer) IndexVersions(model interface{}) ([]int, int, error) {
+	if err := indexer.config().assertModel(model); err != nil {
+		return nil, 0, err
+	}
+
+	v, err := indexer.indexVersions(indexer.IndexName(model))
+	if err != nil {
+		return nil, 0, err
+	}
+	return v.versions, v.current, nil
+}
+
+// Migrate creates a new version of the index that to save the model, copies the documents to it,
+// and moves the alias which is the index name to the new index atomically.
+// It returns the new version.
+//
+// The documents that are written to the old index during the migration are not copied to the new index.
+// If an index which has the same name as the alias exists, it is deleted when the alias moves.
+// If the migration fails, the new index is deleted.
+func (indexer *Indexer) Migrate(model interface{}, opts MigrationOptions, reqFuncs ...func(*esapi.IndicesCreateRequest)) (int, error) {
+	if err := indexer.config().assertModel(model); err != nil {
+		return 0, err
+	}
+
+	alias := indexer.IndexName(model)
+	v, err := indexer.indexVersions(alias)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 1
+	if len(v.versions) > 0 {
+		version = v.versions[len(v.versions)-1] + 1
+	}
+	newIndex := versionedIndexName(alias, version)
+
+	reqFuncs = append(reqFuncs, func(req *esapi.IndicesCreateRequest) {
+		req.Index = url.QueryEscape(newIndex)
+	})
+	if err := indexer.CreateIndex(model, reqFuncs...); err != nil {
+		return 0, err
+	}
+
+	if opts.Source != nil {
+		err = indexer.copyFromSource(newIndex, opts.Source, opts.BatchSize)
+	} else if v.current > 0 {
+		err = indexer.reindex(versionedIndexName(alias, v.current), newIndex)
+	} else if v.legacy {
+		err = indexer.reindex(alias, newIndex)
+	}
+	if err == nil {
+		err = indexer.switchAlias(v, newIndex)
+	}
+	if err != nil {
+		// NOTE: the new index is not used by anyone, so it is deleted to retry the migration with the same version.
+		_ = indexer.Do(&esapi.IndicesDeleteRequest{Index: []string{url.QueryEscape(newIndex)}})
+		return 0, err
+	}
+
+	if opts.Retention > 0 {
+		if err := indexer.DeleteOldVersions(model, opts.Retention); err != nil {
+			return version, err
+		}
+	}
+	return version, nil
+}
+
+// Rollback moves the alias which is the index name to the previous version of the index.
+// It returns the version after rollback, or ErrNoPreviousVersion if the index has no previous version.
+func (indexer *Indexer) Rollback(model interface{}) (int, error) {
+	if err := indexer.config().assertModel(model); err != nil {
+		return 0, err
+	}
+
+	alias := indexer.IndexName(model)
+	v, err := indexer.indexVersions(alias)
+	if err != nil {
+		return 0, err
+	}
+
+	prev := 0
+	for _, version := range v.versions {
+		if version < v.current {
+			prev = version
+		}
+	}
+	if prev == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrNoPreviousVersion, alias)
+	}
+
+	if err := indexer.switchAlias(v, versionedIndexName(alias, prev)); err != nil {
+		return 0, err
+	}
+	return prev, nil
+}
+
+// DeleteOldVersions deletes the versions of the index older than the current version,
+// except the newest retention versions of them.
+func (indexer *Indexer) DeleteOldVersions(model interface{}, retention int) error {
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
+
+	alias := indexer.IndexName(model)
+	v, err := indexer.indexVersions(alias)
+	if err != nil {
+		return err
+	}
+
+	var olds []int
+	for _, version := range v.versions {
+		if version < v.current {
+			olds = append(olds, version)
+		}
+	}
+	if len(olds) <= retention {
+		return nil
+	}
+
+	indices := make([]string, 0, len(olds)-retention)
+	for _, version := range olds[:len(olds)-retention] {
+		indices = append(indices, url.QueryEscape(versionedIndexName(alias, version)))
+	}
+	return indexer.Do(&esapi.IndicesDeleteRequest{Index: indices})
+}
+
+func (indexer *Indexer) indexVersions(alias string) (*indexVersions, error) {
+	getReq := &esapi.IndicesGetAliasRequest{
+		Index:             []string{url.QueryEscape(alias), url.QueryEscape(alias + "_v*")},
+		IgnoreUnavailable: boolPtr(true),
+	}
+
+	var res map[string]struct {
+		Aliases map[string]json.RawMessage `json:"aliases"`
+	}
+	if err := indexer.Do(getReq, &res); err != nil {
+		return nil, err
+	}
+
+	v := &indexVersions{alias: alias}
+	for index, aliases := range res {
+		if index == alias {
+			v.legacy = true
+			continue
+		}
+		version, err := strconv.Atoi(strings.TrimPrefix(index, alias+"_v"))
+		if err != nil || version <= 0 {
+			continue
+		}
+		v.versions = append(v.versions, version)
+		if _, ok := aliases.Aliases[alias]; ok {
+			v.current = version
+		}
+	}
+	sort.Ints(v.versions)
+	return v, nil
+}
+
+func (indexer *Indexer) switchAlias(v *indexVersions, index string) error {
+	var actions []interface{}
+	if v.current > 0 {
+		actions = append(actions, map[string]interface{}{
+			"remove": map[string]interface{}{"index": versionedIndexName(v.alias, v.current), "alias": v.alias},
+		})
+	}
+	if v.legacy {
+		actions = append(actions, map[string]interface{}{
+			"remove_index": map[string]interface{}{"index": v.alias},
+		})
+	}
+	actions = append(actions, map[string]interface{}{
+		"add": map[string]interface{}{"index": index, "alias": v.alias, "is_write_index": true},
+	})
+
+	b, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return err
+	}
+	return indexer.Do(&esapi.IndicesUpdateAliasesRequest{Body: bytes.NewReader(b)})
+}
+
+// ReindexAsync starts to copy the documents from the src index to the dest index with the reindex API, and returns the task.
+// src and dest are the index names.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-reindex.html
+func (indexer *Indexer) ReindexAsync(src string, dest string, reqFuncs ...func(*esapi.ReindexRequest)) (*Task, error) {
+	b, err := json.Marshal(map[string]interface{}{
+		"source": map[string]interface{}{"index": src},
+		"dest":   map[string]interface{}{"index": dest},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reindexReq := &esapi.ReindexRequest{Body: bytes.NewReader(b)}
+	for _, f := range reqFuncs {
+		f(reindexReq)
+	}
+	reindexReq.WaitForCompletion = boolPtr(false)
+	return indexer.startTask(reindexReq, "_reindex")
+}
+
+func (indexer *Indexer) reindex(src string, dest string) error {
+	// NOTE: the reindex runs in the background, so that the request does not time out for large indices.
+	task, err := indexer.ReindexAsync(src, dest, func(req *esapi.ReindexRequest) {
+		req.Refresh = boolPtr(true)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = task.Wait(indexer.ctx, DefaultTaskPollInterval)
+	return err
+}
+
+func (indexer *Indexer) copyFromSource(index string, source DocumentSource, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = DefaultMigrationBatchSize
+	}
+
+	var (
+		buf       bytes.Buffer
+		versioned []bool
+	)
+	for {
+		model, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		hasVersion, err := indexer.writeBulkIndex(&buf, index, model)
+		if err != nil {
+			return err
+		}
+		versioned = append(versioned, hasVersion)
+
+		if len(versioned) >= batchSize {
+			if err := indexer.bulkIndex(&buf, versioned); err != nil {
+				return err
+			}
+			buf.Reset()
+			versioned = versioned[:0]
+		}
+	}
+	if len(versioned) > 0 {
+		if err := indexer.bulkIndex(&buf, versioned); err != nil {
+			return err
+		}
+	}
+	return indexer.Do(&esapi.IndicesRefreshRequest{Index: []string{url.QueryEscape(index)}})
+}
+
+// writeBulkIndex writes the index action of the model to the buffer, and reports whether the model has an external version.
+func (indexer *Indexer) writeBulkIndex(buf *bytes.Buffer, index string, model interface{}) (bool, error) {
+	if err := indexer.config().assertModel(model); err != nil {
+		return false, err
+	}
+
+	reader, err := DocumentBody(model)
+	if err != nil {
+		return false, err
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return false, err
+	}
+
+	documentId, err := DocumentID(model)
+	if err != nil {
+		return false, err
+	}
+	version, hasVersion, err := ExternalVersion(model)
+	if err != nil {
+		return false, err
+	}
+
+	meta := map[string]interface{}{"_index": index, "_id": documentId}
+	if hasVersion {
+		meta["version"] = version
+		meta["version_type"] = "external"
+	}
+	if err := json.NewEncoder(buf).Encode(map[string]interface{}{"index": meta}); err != nil {
+		return false, err
+	}
+	buf.Write(bytes.TrimSpace(body))
+	buf.WriteByte('\n')
+	return hasVersion, nil
+}
+
+// bulkIndex sends the bulk request, and returns an error if any of the items failed.
+func (indexer *Indexer) bulkIndex(body io.Reader, versioned []bool) error {
+	var res struct {
+		Items []map[string]ErrorResponse `json:"items"`
+	}
+	if err := indexer.Do(&esapi.BulkRequest{Body: body}, &res); err != nil {
+		return err
+	}
+	if len(res.Items) != len(versioned) {
+		return fmt.Errorf("the bulk response has %d items, but %d items are sent", len(res.Items), len(versioned))
+	}
+
+	var (
+		failed   int
+		firstErr error
+	)
+	for i, item := range res.Items {
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+			errRes := result
+			if errRes.Err.Reason == "" {
+				errRes.Err.Reason = http.StatusText(int(errRes.Status))
+			}
+			if versioned[i] && indexer.config().IgnoreStaleVersions && errRes.Is(ErrVersionConflict) {
+				continue
+			}
+			if firstErr == nil {
+				firstErr = &errRes
+			}
+			failed++
+		}
+	}
+	if firstErr != nil {
+		return fmt.Errorf("failed to copy %d documents: %w", failed, firstErr)
+	}
+	return nil
+}
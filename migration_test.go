@@ -0,0 +1,188 @@
+package elsearm
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+type sliceSource struct {
+	models []interface{}
+	// An error which is returned after the models, instead of io.EOF.
+	err error
+}
+
+func (s *sliceSource) Next() (interface{}, error) {
+	if len(s.models) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	model := s.models[0]
+	s.models = s.models[1:]
+	return model, nil
+}
+
+func deleteVersionedIndices(req *esapi.IndicesDeleteRequest) {
+	req.Index = []string{"user_v*"}
+}
+
+func TestVersionedIndexName(t *testing.T) {
+	if name := VersionedIndexName(&User{}, 3); name != "user_v3" {
+		t.Errorf("invalid index name: gots %s, wants %s", name, "user_v3")
+	}
+
+	scoped := indexer.WithConfig(Config{IndexNamePrefix: "test_"})
+	if name := scoped.VersionedIndexName(&User{}, 3); name != "test_user_v3" {
+		t.Errorf("invalid index name: gots %s, wants %s", name, "test_user_v3")
+	}
+}
+
+func TestIndexerMigrate(t *testing.T) {
+	_ = indexer.DeleteIndex(&User{}, deleteVersionedIndices)
+	_ = indexer.DeleteIndex(&User{})
+	if err := indexer.CreateIndex(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Update(&User{ID: 1, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// from the index which is not versioned.
+	version, err := indexer.Migrate(&User{}, MigrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("invalid version: gots %d, wants %d", version, 1)
+	}
+	user := &User{ID: 1}
+	if err := indexer.Get(user); err != nil {
+		t.Error(err)
+	}
+	if user.Name != "Alice" {
+		t.Errorf("invalid result: got %#v", user)
+	}
+
+	// from the source.
+	version, err = indexer.Migrate(&User{}, MigrationOptions{
+		Source: &sliceSource{models: []interface{}{&User{ID: 2, Name: "Bob"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 {
+		t.Errorf("invalid version: gots %d, wants %d", version, 2)
+	}
+	if err := indexer.Get(&User{ID: 1}); err == nil {
+		t.Errorf("Get should fail but succeeded")
+	}
+
+	// from the current version.
+	version, err = indexer.Migrate(&User{}, MigrationOptions{Retention: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 3 {
+		t.Errorf("invalid version: gots %d, wants %d", version, 3)
+	}
+	user = &User{ID: 2}
+	if err := indexer.Get(user); err != nil {
+		t.Error(err)
+	}
+	if user.Name != "Bob" {
+		t.Errorf("invalid result: got %#v", user)
+	}
+
+	versions, current, err := indexer.IndexVersions(&User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0] != 2 || versions[1] != 3 || current != 3 {
+		t.Errorf("invalid versions: gots %v, %d", versions, current)
+	}
+
+	version, err = indexer.Rollback(&User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 {
+		t.Errorf("invalid version: gots %d, wants %d", version, 2)
+	}
+	if _, err := indexer.Rollback(&User{}); !errors.Is(err, ErrNoPreviousVersion) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	if err := indexer.DeleteIndex(&User{}, deleteVersionedIndices); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIndexerMigrate_batch(t *testing.T) {
+	_ = indexer.DeleteIndex(&User{}, deleteVersionedIndices)
+	_ = indexer.DeleteIndex(&User{})
+
+	version, err := indexer.Migrate(&User{}, MigrationOptions{
+		Source: &sliceSource{models: []interface{}{
+			&User{ID: 1, Name: "Alice"},
+			&User{ID: 2, Name: "Bob"},
+			&User{ID: 3, Name: "Carol"},
+		}},
+		BatchSize: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("invalid version: gots %d, wants %d", version, 1)
+	}
+	count, err := indexer.Count(&User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("invalid count: gots %d, wants %d", count, 3)
+	}
+
+	if err := indexer.DeleteIndex(&User{}, deleteVersionedIndices); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIndexerMigrate_failed(t *testing.T) {
+	_ = indexer.DeleteIndex(&User{}, deleteVersionedIndices)
+	_ = indexer.DeleteIndex(&User{})
+
+	errSource := errors.New("source error")
+	_, err := indexer.Migrate(&User{}, MigrationOptions{
+		Source:    &sliceSource{models: []interface{}{&User{ID: 1, Name: "Alice"}}, err: errSource},
+		BatchSize: 1,
+	})
+	if !errors.Is(err, errSource) {
+		t.Fatalf("invalid error: got %#v", err)
+	}
+
+	versions, current, err := indexer.IndexVersions(&User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 || current != 0 {
+		t.Errorf("the new index should be deleted: gots %v, %d", versions, current)
+	}
+
+	// the failed version can be used again.
+	version, err := indexer.Migrate(&User{}, MigrationOptions{Source: &sliceSource{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("invalid version: gots %d, wants %d", version, 1)
+	}
+
+	if err := indexer.DeleteIndex(&User{}, deleteVersionedIndices); err != nil {
+		t.Error(err)
+	}
+}
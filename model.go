@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"reflect"
 	"strconv"
+	"time"
 )
 
 // CustomIndexNameModel is an interface to implement when customizing IndexName of model.
@@ -34,13 +37,37 @@ type CustomDocumentBodyModel interface {
 	ParseDocument(io.Reader) error
 }
 
-//  AutomaticIDModel is an interface to implement when Elasticsearch automatically creates id of the model.
+// CustomIndexSettingsModel is an interface to implement when customizing the settings and mappings of the index.
+type CustomIndexSettingsModel interface {
+	// GetIndexSettings returns a body of the create index API, which includes settings, mappings and aliases.
+	GetIndexSettings() (io.Reader, error)
+}
+
+// AutomaticIDModel is an interface to implement when Elasticsearch automatically creates id of the model.
 type AutomaticIDModel interface {
 	CustomDocumentIdModel
 	// SetDocumentID set the DocumentID. If it failed, it returns an error.
 	SetDocumentID(id string) error
 }
 
+// VersionedModel is an interface to implement when using the optimistic concurrency control.
+// Get and Search set the version of the document to the model, and Update and Delete fail with ErrVersionConflict
+// if the document has been changed since the model was read. It can be implemented by embedding DocumentVersion.
+type VersionedModel interface {
+	// GetDocumentVersion returns the version of the document which the model was read from.
+	GetDocumentVersion() DocumentVersion
+	// SetDocumentVersion sets the version of the document.
+	SetDocumentVersion(version DocumentVersion)
+}
+
+// ExternalVersionModel is an interface to implement when customizing the external version of model.
+// Indexer.Update sends the external version with version_type=external, so the older model can not overwrite the newer one.
+type ExternalVersionModel interface {
+	// GetExternalVersion returns a version which is managed outside of Elasticsearch. (e.g. a revision counter)
+	// If the model has no version, it returns false.
+	GetExternalVersion() (int64, bool, error)
+}
+
 // DefaultIndexName returns a default IndexName.
 func DefaultIndexName(model interface{}) string {
 	if model == nil {
@@ -81,6 +108,69 @@ func DefaultDocumentID(model interface{}) string {
 	}
 }
 
+// DefaultExternalVersion returns a default external version, which is the value of the field with `elsearm:"version"` tag.
+// The field must be an integer or time.Time, and time.Time is converted to nanoseconds since the Unix epoch.
+// If there is no such field, or the field is nil or zero time, it returns false.
+func DefaultExternalVersion(model interface{}) (int64, bool, error) {
+	if model == nil {
+		return 0, false, nil
+	}
+
+	value := reflectValue(model)
+	if value.Kind() != reflect.Struct {
+		return 0, false, nil
+	}
+	field, ok := versionField(value)
+	if !ok {
+		return 0, false, nil
+	}
+
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return 0, false, nil
+		}
+		field = field.Elem()
+	}
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if field.Int() < 0 {
+			return 0, false, fmt.Errorf("negative version: %d", field.Int())
+		}
+		return field.Int(), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if field.Uint() > math.MaxInt64 {
+			return 0, false, fmt.Errorf("too large version: %d", field.Uint())
+		}
+		return int64(field.Uint()), true, nil
+	}
+	if field.Type() == timeType {
+		t := field.Interface().(time.Time)
+		if t.IsZero() {
+			return 0, false, nil
+		}
+		return t.UnixNano(), true, nil
+	}
+	return 0, false, fmt.Errorf("unsupported version type: %s", field.Type())
+}
+
+// versionField returns the field with `elsearm:"version"` tag. The embedded structs are also searched.
+func versionField(value reflect.Value) (reflect.Value, bool) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if tag, err := parseFieldTag(f.Tag.Get(tagName)); err == nil && tag.version {
+			return value.Field(i), true
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if field, ok := versionField(value.Field(i)); ok {
+				return field, true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
 // DefaultDocumentBody returns a default DocumentBody.
 func DefaultDocumentBody(model interface{}) (io.Reader, error) {
 	if model == nil {
@@ -107,6 +197,22 @@ func DefaultParseDocument(model interface{}, reader io.Reader) error {
 	return nil
 }
 
+// DefaultIndexSettings returns a default body of the create index API, which includes the mappings generated by Mappings.
+// The mappings are generated from the fields of the model, so a model which implements CustomDocumentBodyModel
+// should use it only if its document is a JSON object of the fields.
+func DefaultIndexSettings(model interface{}) (io.Reader, error) {
+	mappings, err := Mappings(model)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(map[string]interface{}{"mappings": mappings})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
 func reflectValue(model interface{}) reflect.Value {
 	value := reflect.ValueOf(model)
 	for value.Kind() == reflect.Ptr {
@@ -32,10 +32,15 @@ func (u *User) ParseDocument(reader io.Reader) error {
 	return DefaultParseDocument(u, reader)
 }
 
+func (u *User) GetIndexSettings() (io.Reader, error) {
+	return DefaultIndexSettings(u)
+}
+
 func TestUserInterface(t *testing.T) {
 	var _ CustomDocumentBodyModel = &User{}
 	var _ CustomDocumentIdModel = &User{}
 	var _ CustomIndexNameModel = &User{}
+	var _ CustomIndexSettingsModel = &User{}
 }
 
 func TestDefaultValues(t *testing.T) {
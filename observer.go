@@ -0,0 +1,181 @@
+package elsearm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+)
+
+// Observer is an interface to observe the operations of Indexer and BulkIndexer. (e.g. tracing and metrics)
+// It should be safe for concurrent use.
+type Observer interface {
+	// OnRequestStart is called before the operation. The returned context is used for the operation and OnRequestEnd.
+	OnRequestStart(ctx context.Context, event *RequestEvent) context.Context
+	// OnRequestEnd is called after the operation with the same event, which has the result.
+	OnRequestEnd(ctx context.Context, event *RequestEvent)
+}
+
+// RequestEvent is an operation observed by Observer.
+type RequestEvent struct {
+	// A name of the operation. (see OperationName)
+	// The items of BulkIndexer have the names which are the action with the prefix (e.g. BulkIndex, BulkDelete).
+	Operation string
+	// Comma separated index names. It is empty if the operation does not target indices.
+	Index      string
+	DocumentID string
+
+	// The fields below are set before OnRequestEnd.
+
+	// A status code of the response. It is zero if no response is received.
+	Status int
+	// A duration of the operation. For the items of BulkIndexer, it is the time until the item is flushed.
+	Duration time.Duration
+	// A number of bytes of the request body.
+	RequestBytes int64
+	// A number of bytes of the response body. It is zero for the items of BulkIndexer.
+	ResponseBytes int64
+	Err           error
+}
+
+// WithObserver specifies an observer of the requests and returns a new Indexer.
+// The retries of RetryPolicy are observed as an operation.
+func (indexer *Indexer) WithObserver(observer Observer) *Indexer {
+	newIndexer := *indexer
+	newIndexer.observer = observer
+	return &newIndexer
+}
+
+// WithObserver specifies an observer of the items and returns a new BulkIndexer.
+// An item is observed as one operation including its retries.
+// If the bulk request itself fails, the BulkIndexer created by NewBulkIndexerFromConfig calls OnRequestEnd with the error for each of its items,
+// but the one created by NewBulkIndexer can not, since esutil.BulkIndexer reports it only to OnError of esutil.BulkIndexerConfig.
+func (indexer *BulkIndexer) WithObserver(observer Observer) *BulkIndexer {
+	newIndexer := *indexer
+	newIndexer.observer = observer
+	return &newIndexer
+}
+
+func newRequestEvent(req Request) *RequestEvent {
+	event := &RequestEvent{Operation: OperationName(req)}
+
+	req = unwrapRequest(req)
+	if raw, ok := req.(*rawRequest); ok {
+		if index := strings.Split(strings.TrimPrefix(raw.Path, "/"), "/")[0]; !strings.HasPrefix(index, "_") {
+			event.Index = unescapeIndexName(index)
+		}
+		return event
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(req))
+	if v.Kind() != reflect.Struct {
+		return event
+	}
+	switch f := v.FieldByName("Index"); f.Kind() {
+	case reflect.String:
+		event.Index = unescapeIndexName(f.String())
+	case reflect.Slice:
+		if indices, ok := f.Interface().([]string); ok {
+			event.Index = unescapeIndexName(strings.Join(indices, ","))
+		}
+	}
+	if f := v.FieldByName("DocumentID"); f.Kind() == reflect.String {
+		event.DocumentID = f.String()
+	}
+	return event
+}
+
+// unescapeIndexName returns the index name which is escaped by url.QueryEscape.
+func unescapeIndexName(index string) string {
+	if unescaped, err := url.QueryUnescape(index); err == nil {
+		return unescaped
+	}
+	return index
+}
+
+// countRequestBytes returns a request that counts the bytes of the request body to the event.
+// The body is counted once per request, even if it is performed again. (e.g. by an interceptor)
+func countRequestBytes(req Request, event *RequestEvent) Request {
+	var counted bool
+	return WrapTransport(req, func(transport esapi.Transport) esapi.Transport {
+		return TransportFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Body != nil && !counted {
+				counted = true
+				r.Body = &countingReadCloser{ReadCloser: r.Body, n: &event.RequestBytes}
+			}
+			return transport.Perform(r)
+		})
+	})
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	n *int64
+}
+
+// Read reads the data and counts the bytes.
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
+
+// observeBulkItem wraps the callbacks of the item to notify the observer of the result.
+// It returns a function to call when the item can not be added.
+func observeBulkItem(ctx context.Context, observer Observer, item esutil.BulkIndexerItem) (esutil.BulkIndexerItem, func(err error), error) {
+	event := &RequestEvent{
+		Operation:  bulkOperationName(item.Action),
+		Index:      item.Index,
+		DocumentID: item.DocumentID,
+	}
+	if item.Body != nil {
+		b, err := ioutil.ReadAll(item.Body)
+		if err != nil {
+			return item, nil, err
+		}
+		item.Body = bytes.NewReader(b)
+		event.RequestBytes = int64(len(b))
+	}
+
+	ctx = observer.OnRequestStart(ctx, event)
+	start := time.Now()
+	end := func(status int, err error) {
+		event.Duration = time.Since(start)
+		event.Status = status
+		event.Err = err
+		observer.OnRequestEnd(ctx, event)
+	}
+
+	onSuccess, onFailure := item.OnSuccess, item.OnFailure
+	item.OnSuccess = func(c context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
+		if onSuccess != nil {
+			onSuccess(c, item, res)
+		}
+		end(res.Status, nil)
+	}
+	item.OnFailure = func(c context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+		if onFailure != nil {
+			onFailure(c, item, res, err)
+		}
+		if err == nil {
+			err = bulkResponseError(res)
+		}
+		end(res.Status, err)
+	}
+	return item, func(err error) { end(0, err) }, nil
+}
+
+func bulkOperationName(action string) string {
+	if action == "" {
+		return "Bulk"
+	}
+	return "Bulk" + strings.ToUpper(action[:1]) + action[1:]
+}
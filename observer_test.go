@@ -0,0 +1,225 @@
+package elsearm
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+)
+
+type observerKey struct{}
+
+type recordingObserver struct {
+	mu      sync.Mutex
+	started int
+	events  []*RequestEvent
+}
+
+func (o *recordingObserver) OnRequestStart(ctx context.Context, event *RequestEvent) context.Context {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started++
+	return context.WithValue(ctx, observerKey{}, event.Operation)
+}
+
+func (o *recordingObserver) OnRequestEnd(ctx context.Context, event *RequestEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if ctx.Value(observerKey{}) != event.Operation {
+		panic("the context of OnRequestStart is not used")
+	}
+	o.events = append(o.events, event)
+}
+
+func TestIndexer_WithObserver(t *testing.T) {
+	_, indexer := newStubIndexer(t, unavailable, indexed, unavailable)
+
+	observer := &recordingObserver{}
+	var operations []interface{}
+	indexer = indexer.
+		WithObserver(observer).
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}).
+		WithInterceptors(func(ctx context.Context, req Request, next Invoker) (*esapi.Response, error) {
+			operations = append(operations, ctx.Value(observerKey{}))
+			return next(ctx, req)
+		})
+
+	if err := indexer.Update(&User{ID: 1, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.WithRetryPolicy(RetryPolicy{MaxAttempts: 1}).Delete(&User{ID: 1}); err == nil {
+		t.Fatal("Delete should fail but succeeded")
+	}
+
+	if observer.started != 2 || len(observer.events) != 2 {
+		t.Fatalf("invalid events: got %#v", observer.events)
+	}
+	if len(operations) != 2 || operations[0] != "Index" || operations[1] != "Delete" {
+		t.Errorf("invalid context: got %v", operations)
+	}
+
+	event := observer.events[0]
+	if event.Operation != "Index" || event.Index != "user" || event.DocumentID != "1" || event.Status != 200 || event.Err != nil ||
+		event.RequestBytes != int64(len(`{"id":1,"name":"Alice"}`)) || event.ResponseBytes != int64(len(indexed.body)) || event.Duration <= 0 {
+		t.Errorf("invalid event: got %#v", event)
+	}
+	event = observer.events[1]
+	if event.Operation != "Delete" || event.DocumentID != "1" || event.Status != 503 || event.Err == nil ||
+		event.RequestBytes != 0 || event.ResponseBytes != int64(len(unavailable.body)) {
+		t.Errorf("invalid event: got %#v", event)
+	}
+}
+
+// resendingRequest is a Request that performs the request with the same body twice.
+type resendingRequest struct {
+	body string
+}
+
+func (r *resendingRequest) Do(ctx context.Context, transport esapi.Transport) (*esapi.Response, error) {
+	var res *http.Response
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/user/_doc", strings.NewReader(r.body))
+		if err != nil {
+			return nil, err
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+		if res, err = transport.Perform(req); err != nil {
+			return nil, err
+		}
+	}
+	return &esapi.Response{StatusCode: res.StatusCode, Header: res.Header, Body: res.Body}, nil
+}
+
+func TestIndexer_WithObserver_requestBytes(t *testing.T) {
+	_, indexer := newStubIndexer(t, indexed)
+
+	observer := &recordingObserver{}
+	body := `{"id":1,"name":"Alice"}`
+	if err := indexer.WithObserver(observer).Do(&resendingRequest{body: body}); err != nil {
+		t.Fatal(err)
+	}
+	if len(observer.events) != 1 || observer.events[0].RequestBytes != int64(len(body)) {
+		t.Errorf("the body should be counted once: got %#v", observer.events)
+	}
+}
+
+func TestNewRequestEvent(t *testing.T) {
+	tests := []struct {
+		req                          Request
+		operation, index, documentID string
+	}{
+		{&esapi.GetRequest{Index: "user", DocumentID: "1"}, "Get", "user", "1"},
+		{&esapi.SearchRequest{Index: []string{"user", "%3Clogs-%7Bnow%2Fd%7D%3E"}}, "Search", "user,<logs-{now/d}>", ""},
+		{&rawRequest{Name: "OpenPointInTime", Path: "/user/_pit"}, "OpenPointInTime", "user", ""},
+		{&rawRequest{Name: "ClosePointInTime", Path: "/_pit"}, "ClosePointInTime", "", ""},
+	}
+	for _, tt := range tests {
+		event := newRequestEvent(tt.req)
+		if event.Operation != tt.operation || event.Index != tt.index || event.DocumentID != tt.documentID {
+			t.Errorf("invalid event: got %#v", event)
+		}
+	}
+}
+
+func TestBulkIndexer_WithObserver(t *testing.T) {
+	if err := indexer.CreateIndexIfNotExist(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	_ = indexer.Delete(&User{ID: 100})
+	bulk, closeBulk := newClosableBulkIndexer(t)
+
+	observer := &recordingObserver{}
+	sink := NewMemoryDeadLetterSink()
+	bulkIndexer := bulk.WithObserver(observer).WithDeadLetterSink(sink)
+	if err := bulkIndexer.Update(&User{ID: 101, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bulkIndexer.PartialUpdate(&User{ID: 100, Name: "Bob"}, []string{"name"}); err != nil {
+		t.Fatal(err)
+	}
+	closeBulk()
+
+	if observer.started != 2 || len(observer.events) != 2 {
+		t.Fatalf("invalid events: got %#v", observer.events)
+	}
+	event := observer.events[0]
+	if event.Operation != "BulkIndex" || event.Index != IndexName(&User{}) || event.DocumentID != "101" ||
+		event.Status >= 300 || event.Err != nil || event.RequestBytes != int64(len(`{"id":101,"name":"Alice"}`)) {
+		t.Errorf("invalid event: got %#v", event)
+	}
+	event = observer.events[1]
+	if event.Operation != "BulkUpdate" || event.DocumentID != "100" || event.Status != 404 || !errors.Is(event.Err, ErrDocumentNotFound) {
+		t.Errorf("invalid event: got %#v", event)
+	}
+	if len(sink.Letters()) != 1 {
+		t.Errorf("invalid dead letters: got %#v", sink.Letters())
+	}
+}
+
+func TestBulkIndexer_WithObserver_requestFailure(t *testing.T) {
+	_, client := newStubClient(t, stubResponse{err: errors.New("connection refused")})
+	bulk, err := NewBulkIndexerFromConfig(esutil.BulkIndexerConfig{NumWorkers: 1, Client: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := new(expvar.Map).Init()
+	bulkIndexer := bulk.WithRetryPolicy(RetryPolicy{MaxAttempts: 1}).WithObserver(NewExpvarObserver(m))
+	for i := 1; i <= 2; i++ {
+		if err := bulkIndexer.Update(&User{ID: uint(i), Name: "Alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bulkIndexer.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, ok := m.Get("BulkIndex").(*expvar.Map)
+	if !ok {
+		t.Fatalf("BulkIndex is not recorded: %s", m)
+	}
+	if metrics.Get("in_flight").String() != "0" || metrics.Get("errors").String() != "2" {
+		t.Errorf("invalid metrics: got %s", m)
+	}
+}
+
+func TestExpvarObserver(t *testing.T) {
+	_, indexer := newStubIndexer(t, indexed, indexed, unavailable)
+
+	m := new(expvar.Map).Init()
+	indexer = indexer.WithObserver(NewExpvarObserver(m))
+	for i := 0; i < 2; i++ {
+		if err := indexer.Update(&User{ID: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := indexer.Delete(&User{ID: 1}); err == nil {
+		t.Fatal("Delete should fail but succeeded")
+	}
+
+	get := func(operation, key string) string {
+		metrics, ok := m.Get(operation).(*expvar.Map)
+		if !ok {
+			t.Fatalf("%s is not recorded: %s", operation, m)
+		}
+		if v := metrics.Get(key); v != nil {
+			return v.String()
+		}
+		return ""
+	}
+	if get("Index", "requests") != "2" || get("Index", "in_flight") != "0" || get("Index", "errors") != "" || get("Index", "duration_ns") == "0" {
+		t.Errorf("invalid metrics: got %s", m)
+	}
+	if get("Delete", "requests") != "1" || get("Delete", "errors") != "1" {
+		t.Errorf("invalid metrics: got %s", m)
+	}
+}
@@ -0,0 +1,163 @@
+// Package outbox provides a transactional outbox of the document changes.
+//
+// The intents to index or delete the documents are written to the outbox table in the same transaction as the models,
+// and Relay moves them to Elasticsearch after the transaction is committed.
+// So the documents are not changed when the transaction is rolled back, and the changes are not lost when Elasticsearch is down.
+//
+// The outbox table should be created as follows. (e.g. MySQL)
+//
+//	CREATE TABLE elsearm_outbox (
+//		id          BIGINT AUTO_INCREMENT PRIMARY KEY, -- BIGSERIAL in PostgreSQL
+//		index_name  VARCHAR(255) NOT NULL,
+//		document_id VARCHAR(255) NOT NULL,
+//		action      VARCHAR(16)  NOT NULL,
+//		body        TEXT,
+//		attempts    INT          NOT NULL DEFAULT 0,
+//		last_error  TEXT,
+//		created_at  TIMESTAMP    NOT NULL
+//	);
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soranoba/elsearm"
+)
+
+const (
+	// DefaultTable is a name of the outbox table when it is not set.
+	DefaultTable = "elsearm_outbox"
+)
+
+// The actions of Message.
+const (
+	ActionIndex  = "index"
+	ActionDelete = "delete"
+)
+
+// Config is a config of Outbox.
+type Config struct {
+	// A name of the outbox table. If it is empty, DefaultTable is used.
+	Table string
+	// If it is true, the placeholders are $1, $2, ... (e.g. PostgreSQL). Otherwise, they are ?.
+	DollarPlaceholder bool
+}
+
+// Outbox writes the intents to change the documents to the outbox table.
+type Outbox struct {
+	indexer *elsearm.Indexer
+	cfg     Config
+}
+
+// Message is an intent to change the document, which is a row of the outbox table.
+type Message struct {
+	ID         int64
+	Index      string
+	DocumentID string
+	Action     string
+	// A document body. It is nil when the action is delete.
+	Body []byte
+	// A number of the failed deliveries.
+	Attempts int
+}
+
+// Execer is an interface to execute the statements. *sql.Tx, *sql.DB and *sql.Conn implement it.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// New creates an Outbox. The index names are resolved by the config of the indexer.
+func New(indexer *elsearm.Indexer, cfg Config) *Outbox {
+	if cfg.Table == "" {
+		cfg.Table = DefaultTable
+	}
+	return &Outbox{indexer: indexer, cfg: cfg}
+}
+
+// Update writes the intent to index the model. tx should be the transaction which saves the model.
+func (o *Outbox) Update(ctx context.Context, tx Execer, model interface{}) error {
+	id, err := elsearm.DocumentID(model)
+	if err != nil {
+		return err
+	}
+	reader, err := elsearm.DocumentBody(model)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return o.Write(ctx, tx, &Message{
+		Index:      o.indexer.IndexName(model),
+		DocumentID: id,
+		Action:     ActionIndex,
+		Body:       body,
+	})
+}
+
+// Delete writes the intent to delete the document of the model. tx should be the transaction which deletes the model.
+func (o *Outbox) Delete(ctx context.Context, tx Execer, model interface{}) error {
+	id, err := elsearm.DocumentID(model)
+	if err != nil {
+		return err
+	}
+	return o.Write(ctx, tx, &Message{
+		Index:      o.indexer.IndexName(model),
+		DocumentID: id,
+		Action:     ActionDelete,
+	})
+}
+
+// Write writes the message. The ID and Attempts of the message are ignored.
+// The body of the index action is compacted to a line, since the messages are sent as a newline delimited JSON.
+// If it is not a JSON, it returns an error.
+func (o *Outbox) Write(ctx context.Context, tx Execer, msg *Message) error {
+	if msg.Action != ActionIndex && msg.Action != ActionDelete {
+		return fmt.Errorf("outbox: unsupported action: %s", msg.Action)
+	}
+	if msg.DocumentID == "" {
+		return fmt.Errorf("outbox: the document id is empty")
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO %s (index_name, document_id, action, body, attempts, created_at) VALUES (%s)",
+		o.cfg.Table, o.placeholders(1, 6),
+	)
+	var body interface{}
+	if msg.Action == ActionIndex {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, msg.Body); err != nil {
+			return fmt.Errorf("outbox: the body is not a JSON: %w", err)
+		}
+		body = buf.Bytes()
+	} else if msg.Body != nil {
+		body = msg.Body
+	}
+	_, err := tx.ExecContext(ctx, query, msg.Index, msg.DocumentID, msg.Action, body, 0, time.Now().UTC())
+	return err
+}
+
+// placeholders returns n placeholders from the start-th.
+func (o *Outbox) placeholders(start, n int) string {
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		placeholders[i] = o.placeholder(start + i)
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+func (o *Outbox) placeholder(i int) string {
+	if o.cfg.DollarPlaceholder {
+		return "$" + strconv.Itoa(i)
+	}
+	return "?"
+}
@@ -0,0 +1,358 @@
+package outbox_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/soranoba/elsearm"
+	"github.com/soranoba/elsearm/elsearmtest"
+	"github.com/soranoba/elsearm/outbox"
+	"github.com/soranoba/elsearm/outbox/outboxtest"
+)
+
+type User struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (u *User) GetDocumentID() string {
+	return strconv.Itoa(u.ID)
+}
+
+func setup(t *testing.T, cfg outbox.Config) (*sql.DB, *elsearm.Indexer, *outbox.Outbox) {
+	t.Helper()
+	cluster := elsearmtest.NewCluster()
+	t.Cleanup(cluster.Close)
+	client, err := cluster.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer := elsearm.NewIndexer(client)
+
+	db, err := outboxtest.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	table := cfg.Table
+	if table == "" {
+		table = outbox.DefaultTable
+	}
+	if _, err := db.Exec("CREATE TABLE " + table + " (id BIGINT PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	return db, indexer, outbox.New(indexer, cfg)
+}
+
+func transaction(t *testing.T, db *sql.DB, f func(tx *sql.Tx) error) error {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f(tx); err != nil {
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+func countMessages(t *testing.T, db *sql.DB, table string) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestOutbox_rollback(t *testing.T) {
+	db, indexer, ob := setup(t, outbox.Config{})
+
+	errRollback := errors.New("rollback")
+	err := transaction(t, db, func(tx *sql.Tx) error {
+		if err := ob.Update(context.Background(), tx, &User{ID: 1, Name: "Alice"}); err != nil {
+			t.Fatal(err)
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("invalid error: got %#v", err)
+	}
+
+	n, err := ob.Relay(db, outbox.RelayOptions{}).RelayOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("invalid delivered: got %d", n)
+	}
+	if err := indexer.Get(&User{ID: 1}); !errors.Is(err, elsearm.ErrDocumentNotFound) && !errors.Is(err, elsearm.ErrIndexNotFound) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
+
+func TestRelay_RelayOnce(t *testing.T) {
+	db, indexer, ob := setup(t, outbox.Config{Table: "user_outbox", DollarPlaceholder: true})
+	ctx := context.Background()
+
+	err := transaction(t, db, func(tx *sql.Tx) error {
+		for _, f := range []func() error{
+			func() error { return ob.Update(ctx, tx, &User{ID: 1, Name: "Alice"}) },
+			func() error { return ob.Update(ctx, tx, &User{ID: 2, Name: "Bob"}) },
+			func() error { return ob.Update(ctx, tx, &User{ID: 3, Name: "Carol"}) },
+			func() error { return ob.Update(ctx, tx, &User{ID: 1, Name: "Alice Liddell"}) },
+			func() error { return ob.Delete(ctx, tx, &User{ID: 2}) },
+		} {
+			if err := f(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relay := ob.Relay(db, outbox.RelayOptions{BatchSize: 4})
+	n, err := relay.RelayOnce(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: the delete of the user 2 is in the next batch.
+	if n != 4 || countMessages(t, db, "user_outbox") != 1 {
+		t.Errorf("invalid delivered: got %d", n)
+	}
+	user := &User{ID: 2}
+	if err := indexer.Get(user); err != nil || user.Name != "Bob" {
+		t.Errorf("invalid result: got %#v, %v", user, err)
+	}
+
+	if n, err = relay.RelayOnce(ctx); err != nil || n != 1 {
+		t.Errorf("invalid delivered: got %d, %v", n, err)
+	}
+	if n, err = relay.RelayOnce(ctx); err != nil || n != 0 {
+		t.Errorf("invalid delivered: got %d, %v", n, err)
+	}
+
+	var users []User
+	if _, err := indexer.Search(&users); err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	if len(users) != 2 || users[0].Name != "Alice Liddell" || users[1].Name != "Carol" {
+		t.Errorf("invalid result: got %#v", users)
+	}
+	if countMessages(t, db, "user_outbox") != 0 {
+		t.Errorf("the delivered messages are not deleted")
+	}
+}
+
+func TestRelay_failures(t *testing.T) {
+	db, indexer, _ := setup(t, outbox.Config{})
+	ctx := context.Background()
+
+	var (
+		mu   sync.Mutex
+		down = true
+	)
+	rejectUser1 := func(ctx context.Context, req elsearm.Request, next elsearm.Invoker) (*esapi.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			return nil, errors.New("connection refused")
+		}
+		res, err := next(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		var body struct {
+			Errors bool                                `json:"errors"`
+			Items  []map[string]map[string]interface{} `json:"items"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		for _, item := range body.Items {
+			for _, result := range item {
+				if result["_id"] == "1" {
+					result["status"] = http.StatusTooManyRequests
+					result["error"] = map[string]interface{}{"type": "es_rejected_execution_exception", "reason": "rejected"}
+					body.Errors = true
+				}
+			}
+		}
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		res.Body = ioutil.NopCloser(bytes.NewReader(b))
+		return res, nil
+	}
+	ob := outbox.New(indexer.WithInterceptors(rejectUser1), outbox.Config{})
+
+	var errs []error
+	relay := ob.Relay(db, outbox.RelayOptions{
+		// NOTE: the failure of the whole batch is also counted.
+		MaxAttempts: 3,
+		OnError: func(ctx context.Context, err error) {
+			errs = append(errs, err)
+		},
+	})
+	for _, user := range []*User{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}} {
+		if err := ob.Update(ctx, db, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := relay.RelayOnce(ctx); err == nil {
+		t.Fatal("RelayOnce should fail but succeeded")
+	}
+	if countMessages(t, db, outbox.DefaultTable) != 2 {
+		t.Errorf("the messages should remain")
+	}
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	for i := 0; i < 2; i++ {
+		n, err := relay.RelayOnce(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (i == 0 && n != 1) || (i == 1 && n != 0) {
+			t.Errorf("invalid delivered: got %d", n)
+		}
+	}
+	if len(errs) != 2 {
+		t.Fatalf("invalid errors: got %#v", errs)
+	}
+	var msgErr *outbox.MessageError
+	if !errors.As(errs[0], &msgErr) || msgErr.Message.DocumentID != "1" || !errors.Is(msgErr, elsearm.ErrTooManyRequests) {
+		t.Errorf("invalid error: got %#v", errs[0])
+	}
+
+	// NOTE: the message that reached MaxAttempts is left, but not relayed.
+	if n, err := relay.RelayOnce(ctx); err != nil || n != 0 || len(errs) != 2 {
+		t.Errorf("invalid delivered: got %d, %v", n, err)
+	}
+	if countMessages(t, db, outbox.DefaultTable) != 1 {
+		t.Errorf("the failed message should remain")
+	}
+}
+
+func TestRelay_requestFailures(t *testing.T) {
+	db, indexer, _ := setup(t, outbox.Config{})
+	ctx := context.Background()
+
+	refuse := func(ctx context.Context, req elsearm.Request, next elsearm.Invoker) (*esapi.Response, error) {
+		return nil, errors.New("connection refused")
+	}
+	ob := outbox.New(indexer.WithInterceptors(refuse), outbox.Config{})
+	relay := ob.Relay(db, outbox.RelayOptions{MaxAttempts: 2})
+	if err := ob.Update(ctx, db, &User{ID: 1, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := relay.RelayOnce(ctx); err == nil {
+			t.Fatal("RelayOnce should fail but succeeded")
+		}
+	}
+	// NOTE: the message that reached MaxAttempts by the failures of the whole batch is no longer relayed.
+	if n, err := relay.RelayOnce(ctx); err != nil || n != 0 {
+		t.Errorf("invalid delivered: got %d, %v", n, err)
+	}
+	if countMessages(t, db, outbox.DefaultTable) != 1 {
+		t.Errorf("the failed message should remain")
+	}
+}
+
+func TestRelay_Run(t *testing.T) {
+	db, indexer, ob := setup(t, outbox.Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ob.Relay(db, outbox.RelayOptions{BatchSize: 2, PollInterval: 10 * time.Millisecond}).Run(ctx)
+	}()
+
+	err := transaction(t, db, func(tx *sql.Tx) error {
+		for i := 1; i <= 5; i++ {
+			if err := ob.Update(ctx, tx, &User{ID: i, Name: "user" + strconv.Itoa(i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for countMessages(t, db, outbox.DefaultTable) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the messages are not relayed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	count, err := indexer.Count(&User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("invalid count: got %d", count)
+	}
+}
+
+func TestOutbox_Write(t *testing.T) {
+	db, indexer, ob := setup(t, outbox.Config{})
+	ctx := context.Background()
+
+	if err := ob.Write(ctx, db, &outbox.Message{Index: "user", DocumentID: "1", Action: "update"}); err == nil {
+		t.Errorf("Write should fail but succeeded")
+	}
+	if err := ob.Write(ctx, db, &outbox.Message{Index: "user", Action: outbox.ActionDelete}); err == nil {
+		t.Errorf("Write should fail but succeeded")
+	}
+	if err := ob.Write(ctx, db, &outbox.Message{Index: "user", DocumentID: "1", Action: outbox.ActionIndex, Body: []byte(`{"id":`)}); err == nil {
+		t.Errorf("Write should fail but succeeded")
+	}
+	if countMessages(t, db, outbox.DefaultTable) != 0 {
+		t.Errorf("invalid messages")
+	}
+
+	// NOTE: the body of multiple lines would break the bulk request, if it is not compacted.
+	body := []byte("{\n  \"id\": 1,\n  \"name\": \"Alice\"\n}\n")
+	if err := ob.Write(ctx, db, &outbox.Message{Index: indexer.IndexName(&User{}), DocumentID: "1", Action: outbox.ActionIndex, Body: body}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := ob.Relay(db, outbox.RelayOptions{}).RelayOnce(ctx); err != nil || n != 1 {
+		t.Errorf("invalid delivered: got %d, %v", n, err)
+	}
+	user := &User{ID: 1}
+	if err := indexer.Get(user); err != nil || user.Name != "Alice" {
+		t.Errorf("invalid result: got %#v, %v", user, err)
+	}
+}
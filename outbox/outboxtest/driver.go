@@ -0,0 +1,563 @@
+// Package outboxtest provides an in-memory database/sql driver for the tests of the outbox.
+//
+// It supports a small subset of SQL, which is enough for the statements of the outbox.
+//
+//	CREATE TABLE <table> (...)
+//	INSERT INTO <table> (<columns>) VALUES (<placeholders>)
+//	SELECT <columns> | COUNT(*) FROM <table> [WHERE <column> <op> ? [AND ...]] [ORDER BY <column>] [LIMIT ?]
+//	UPDATE <table> SET <column> = ? | <column> = <column> + <n>, ... [WHERE <column> <op> ? [AND ...]]
+//	DELETE FROM <table> [WHERE <column> <op> ? [AND ...]]
+//
+// The operators are =, <>, <, <=, > and >=. The placeholders are ? or $n.
+// The tables are created on the first insertion, and each row has the auto increment `id` column.
+// The transactions are serialized, so a transaction blocks the other statements until it finishes.
+package outboxtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DriverName is a name of the driver registered to database/sql.
+const DriverName = "elsearm-outboxtest"
+
+var (
+	databasesMu sync.Mutex
+	databases   = map[string]*database{}
+	dsnSeq      int64
+)
+
+func init() {
+	sql.Register(DriverName, &memDriver{})
+}
+
+// Open opens a new empty database.
+func Open() (*sql.DB, error) {
+	databasesMu.Lock()
+	dsnSeq++
+	dsn := "db" + strconv.FormatInt(dsnSeq, 10)
+	databasesMu.Unlock()
+	return sql.Open(DriverName, dsn)
+}
+
+type memDriver struct{}
+
+// Open returns a connection to the database of the name. The database is created if it does not exist.
+func (d *memDriver) Open(name string) (driver.Conn, error) {
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	db, ok := databases[name]
+	if !ok {
+		db = &database{tables: map[string]*table{}}
+		databases[name] = db
+	}
+	return &conn{db: db}, nil
+}
+
+type database struct {
+	mu     sync.Mutex
+	tables map[string]*table
+}
+
+type table struct {
+	seq  int64
+	rows []map[string]driver.Value
+}
+
+func (t *table) clone() *table {
+	rows := make([]map[string]driver.Value, len(t.rows))
+	for i, row := range t.rows {
+		rows[i] = make(map[string]driver.Value, len(row))
+		for k, v := range row {
+			rows[i][k] = v
+		}
+	}
+	return &table{seq: t.seq, rows: rows}
+}
+
+type conn struct {
+	db *database
+	// The tables of the running transaction. They are written back on commit.
+	tx map[string]*table
+}
+
+// Prepare returns a prepared statement.
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+// Close closes the connection.
+func (c *conn) Close() error {
+	if c.tx != nil {
+		return c.Rollback()
+	}
+	return nil
+}
+
+// Begin starts a transaction. It blocks until the other transactions finish.
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx starts a transaction. It blocks until the other transactions finish.
+func (c *conn) BeginTx(_ context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	if c.tx != nil {
+		return nil, errors.New("outboxtest: the transaction has already started")
+	}
+	c.db.mu.Lock()
+	c.tx = make(map[string]*table, len(c.db.tables))
+	for name, t := range c.db.tables {
+		c.tx[name] = t.clone()
+	}
+	return c, nil
+}
+
+// Commit commits the transaction.
+func (c *conn) Commit() error {
+	if c.tx == nil {
+		return errors.New("outboxtest: no transaction")
+	}
+	c.db.tables = c.tx
+	c.tx = nil
+	c.db.mu.Unlock()
+	return nil
+}
+
+// Rollback aborts the transaction.
+func (c *conn) Rollback() error {
+	if c.tx == nil {
+		return errors.New("outboxtest: no transaction")
+	}
+	c.tx = nil
+	c.db.mu.Unlock()
+	return nil
+}
+
+// tables calls f with the tables of the transaction, or the tables of the database with lock.
+func (c *conn) tables(f func(tables map[string]*table) error) error {
+	if c.tx != nil {
+		return f(c.tx)
+	}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	return f(c.db.tables)
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+// Close closes the statement.
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput returns -1 because the number of the placeholders is not checked.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+// Exec executes the statement.
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	var result driver.Result
+	err := s.conn.tables(func(tables map[string]*table) error {
+		var err error
+		result, err = exec(tables, s.query, args)
+		return err
+	})
+	return result, err
+}
+
+// Query executes the query.
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	var rows driver.Rows
+	err := s.conn.tables(func(tables map[string]*table) error {
+		var err error
+		rows, err = query(tables, s.query, args)
+		return err
+	})
+	return rows, err
+}
+
+type result struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+// LastInsertId returns the id of the inserted row.
+func (r *result) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+// RowsAffected returns the number of the changed rows.
+func (r *result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+// Columns returns the names of the columns.
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+// Close closes the rows.
+func (r *rows) Close() error {
+	return nil
+}
+
+// Next sets the values of the next row to dest.
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var (
+	placeholderRegexp = regexp.MustCompile(`\$\d+`)
+	spaceRegexp       = regexp.MustCompile(`\s+`)
+	createRegexp      = regexp.MustCompile(`(?i)^CREATE TABLE (?:IF NOT EXISTS )?(\w+)`)
+	insertRegexp      = regexp.MustCompile(`(?i)^INSERT INTO (\w+) ?\(([^)]*)\) VALUES ?\(([^)]*)\)$`)
+	selectRegexp      = regexp.MustCompile(`(?i)^SELECT (.+?) FROM (\w+)(?: WHERE (.+?))?(?: ORDER BY (\w+)(?: (ASC|DESC))?)?(?: LIMIT \?)?$`)
+	updateRegexp      = regexp.MustCompile(`(?i)^UPDATE (\w+) SET (.+?)(?: WHERE (.+))?$`)
+	deleteRegexp      = regexp.MustCompile(`(?i)^DELETE FROM (\w+)(?: WHERE (.+))?$`)
+	conditionRegexp   = regexp.MustCompile(`^(\w+) ?(=|<>|<=|>=|<|>) ?\?$`)
+	incrementRegexp   = regexp.MustCompile(`^(\w+) ?= ?(\w+) ?\+ ?(\d+)$`)
+	assignRegexp      = regexp.MustCompile(`^(\w+) ?= ?\?$`)
+	andRegexp         = regexp.MustCompile(`(?i) AND `)
+)
+
+func normalize(q string) string {
+	q = placeholderRegexp.ReplaceAllString(q, "?")
+	q = spaceRegexp.ReplaceAllString(strings.TrimSpace(q), " ")
+	return strings.TrimSuffix(q, ";")
+}
+
+// args pops the arguments of the placeholders.
+type args []driver.Value
+
+func (a *args) next() (driver.Value, error) {
+	if len(*a) == 0 {
+		return nil, errors.New("outboxtest: not enough arguments")
+	}
+	v := (*a)[0]
+	*a = (*a)[1:]
+	return v, nil
+}
+
+func exec(tables map[string]*table, q string, values []driver.Value) (driver.Result, error) {
+	q = normalize(q)
+	a := args(values)
+
+	if m := createRegexp.FindStringSubmatch(q); m != nil {
+		if _, ok := tables[m[1]]; !ok {
+			tables[m[1]] = &table{}
+		}
+		return &result{}, nil
+	}
+
+	if m := insertRegexp.FindStringSubmatch(q); m != nil {
+		t, ok := tables[m[1]]
+		if !ok {
+			t = &table{}
+			tables[m[1]] = t
+		}
+		columns := splitList(m[2])
+		if len(columns) != len(splitList(m[3])) {
+			return nil, fmt.Errorf("outboxtest: the number of columns and values are different: %s", q)
+		}
+		t.seq++
+		row := map[string]driver.Value{"id": t.seq}
+		for _, column := range columns {
+			v, err := a.next()
+			if err != nil {
+				return nil, err
+			}
+			row[column] = copyValue(v)
+		}
+		t.rows = append(t.rows, row)
+		return &result{lastInsertID: t.seq, rowsAffected: 1}, nil
+	}
+
+	if m := updateRegexp.FindStringSubmatch(q); m != nil {
+		t, err := findTable(tables, m[1])
+		if err != nil {
+			return nil, err
+		}
+		type assignment struct {
+			column    string
+			value     driver.Value
+			increment int64
+			source    string
+		}
+		var assignments []assignment
+		for _, set := range splitList(m[2]) {
+			if sm := assignRegexp.FindStringSubmatch(set); sm != nil {
+				v, err := a.next()
+				if err != nil {
+					return nil, err
+				}
+				assignments = append(assignments, assignment{column: sm[1], value: copyValue(v)})
+			} else if sm := incrementRegexp.FindStringSubmatch(set); sm != nil {
+				n, _ := strconv.ParseInt(sm[3], 10, 64)
+				assignments = append(assignments, assignment{column: sm[1], source: sm[2], increment: n})
+			} else {
+				return nil, fmt.Errorf("outboxtest: unsupported assignment: %s", set)
+			}
+		}
+		match, err := where(m[3], &a)
+		if err != nil {
+			return nil, err
+		}
+
+		var affected int64
+		for _, row := range t.rows {
+			if !match(row) {
+				continue
+			}
+			for _, as := range assignments {
+				if as.source == "" {
+					row[as.column] = as.value
+				} else {
+					n, _ := toInt64(row[as.source])
+					row[as.column] = n + as.increment
+				}
+			}
+			affected++
+		}
+		return &result{rowsAffected: affected}, nil
+	}
+
+	if m := deleteRegexp.FindStringSubmatch(q); m != nil {
+		t, err := findTable(tables, m[1])
+		if err != nil {
+			return nil, err
+		}
+		match, err := where(m[2], &a)
+		if err != nil {
+			return nil, err
+		}
+		rows := t.rows[:0]
+		for _, row := range t.rows {
+			if !match(row) {
+				rows = append(rows, row)
+			}
+		}
+		affected := int64(len(t.rows) - len(rows))
+		t.rows = rows
+		return &result{rowsAffected: affected}, nil
+	}
+
+	return nil, fmt.Errorf("outboxtest: unsupported statement: %s", q)
+}
+
+func query(tables map[string]*table, q string, values []driver.Value) (driver.Rows, error) {
+	q = normalize(q)
+	a := args(values)
+
+	m := selectRegexp.FindStringSubmatch(q)
+	if m == nil {
+		return nil, fmt.Errorf("outboxtest: unsupported query: %s", q)
+	}
+	t, err := findTable(tables, m[2])
+	if err != nil {
+		return nil, err
+	}
+	match, err := where(m[3], &a)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []map[string]driver.Value
+	for _, row := range t.rows {
+		if match(row) {
+			matched = append(matched, row)
+		}
+	}
+	if orderBy := m[4]; orderBy != "" {
+		desc := strings.EqualFold(m[5], "DESC")
+		sort.SliceStable(matched, func(i, j int) bool {
+			if desc {
+				return compare(matched[j][orderBy], matched[i][orderBy]) < 0
+			}
+			return compare(matched[i][orderBy], matched[j][orderBy]) < 0
+		})
+	}
+	if strings.HasSuffix(strings.ToUpper(q), "LIMIT ?") {
+		v, err := a.next()
+		if err != nil {
+			return nil, err
+		}
+		if limit, ok := toInt64(v); ok && int(limit) < len(matched) {
+			matched = matched[:limit]
+		}
+	}
+
+	if strings.EqualFold(m[1], "COUNT(*)") {
+		return &rows{columns: []string{"count"}, values: [][]driver.Value{{int64(len(matched))}}}, nil
+	}
+	columns := splitList(m[1])
+	if len(columns) == 1 && columns[0] == "*" {
+		return nil, errors.New("outboxtest: SELECT * is not supported")
+	}
+	result := &rows{columns: columns}
+	for _, row := range matched {
+		values := make([]driver.Value, len(columns))
+		for i, column := range columns {
+			values[i] = row[column]
+		}
+		result.values = append(result.values, values)
+	}
+	return result, nil
+}
+
+func findTable(tables map[string]*table, name string) (*table, error) {
+	t, ok := tables[name]
+	if !ok {
+		return nil, fmt.Errorf("outboxtest: table %s does not exist", name)
+	}
+	return t, nil
+}
+
+// where returns a function that reports whether the row matches the conditions.
+func where(conditions string, a *args) (func(row map[string]driver.Value) bool, error) {
+	if conditions == "" {
+		return func(map[string]driver.Value) bool { return true }, nil
+	}
+
+	type condition struct {
+		column string
+		op     string
+		value  driver.Value
+	}
+	var conds []condition
+	for _, c := range andRegexp.Split(conditions, -1) {
+		m := conditionRegexp.FindStringSubmatch(strings.TrimSpace(c))
+		if m == nil {
+			return nil, fmt.Errorf("outboxtest: unsupported condition: %s", c)
+		}
+		v, err := a.next()
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, condition{column: m[1], op: m[2], value: v})
+	}
+
+	return func(row map[string]driver.Value) bool {
+		for _, c := range conds {
+			cmp := compare(row[c.column], c.value)
+			var ok bool
+			switch c.op {
+			case "=":
+				ok = cmp == 0
+			case "<>":
+				ok = cmp != 0
+			case "<":
+				ok = cmp < 0
+			case "<=":
+				ok = cmp <= 0
+			case ">":
+				ok = cmp > 0
+			case ">=":
+				ok = cmp >= 0
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// compare compares the values. nil is less than any other value.
+func compare(a, b driver.Value) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if x, ok := toInt64(a); ok {
+		if y, ok := toInt64(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := a.(time.Time); ok {
+		if y, ok := b.(time.Time); ok {
+			switch {
+			case x.Before(y):
+				return -1
+			case x.After(y):
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(toString(a), toString(b))
+}
+
+func toInt64(v driver.Value) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func toString(v driver.Value) string {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// copyValue copies []byte, because it is valid only during the call.
+func copyValue(v driver.Value) driver.Value {
+	if b, ok := v.([]byte); ok {
+		return append([]byte(nil), b...)
+	}
+	return v
+}
+
+func splitList(s string) []string {
+	items := strings.Split(s, ",")
+	for i, item := range items {
+		items[i] = strings.TrimSpace(item)
+	}
+	return items
+}
@@ -0,0 +1,74 @@
+package outboxtest_test
+
+import (
+	"testing"
+
+	"github.com/soranoba/elsearm/outbox/outboxtest"
+)
+
+func TestDriver(t *testing.T) {
+	db, err := outboxtest.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := db.Exec("INSERT INTO items (name, count) VALUES ($1, $2)", name, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("DELETE FROM items WHERE name = ?", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tx.Exec("UPDATE items SET count = count + 1, name = ? WHERE id >= ? AND name <> ?", "x", 2, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("invalid rows affected: got %d", n)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT id, name, count FROM items WHERE count < ? ORDER BY id DESC LIMIT ?", 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	type item struct {
+		id    int64
+		name  string
+		count int
+	}
+	var items []item
+	for rows.Next() {
+		var i item
+		if err := rows.Scan(&i.id, &i.name, &i.count); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, i)
+	}
+	if len(items) != 2 || items[0] != (item{3, "c", 0}) || items[1] != (item{2, "x", 1}) {
+		t.Errorf("invalid items: got %#v", items)
+	}
+
+	if _, err := db.Exec("DROP TABLE items"); err == nil {
+		t.Errorf("unsupported statement should fail")
+	}
+}
@@ -0,0 +1,273 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/soranoba/elsearm"
+)
+
+const (
+	// DefaultBatchSize is a maximum number of messages per batch when it is not set.
+	DefaultBatchSize = 100
+	// DefaultPollInterval is an interval to poll the outbox table when it is not set.
+	DefaultPollInterval = time.Second
+	// DefaultMaxAttempts is a maximum number of deliveries of each message when it is not set.
+	DefaultMaxAttempts = 10
+)
+
+// RelayOptions is options of Relay.
+type RelayOptions struct {
+	// A maximum number of messages per batch. If it is zero, DefaultBatchSize is used.
+	BatchSize int
+	// An interval to poll the outbox table when no messages remain. If it is zero, DefaultPollInterval is used.
+	PollInterval time.Duration
+	// A maximum number of deliveries of each message. If it is zero, DefaultMaxAttempts is used.
+	// The messages that reach it are left in the outbox table and no longer relayed.
+	// When the whole bulk request fails (e.g. Elasticsearch is unavailable), the deliveries of all messages of the batch are counted.
+	MaxAttempts int
+	// A function which is called with the errors of Run and the failed messages. (see MessageError)
+	OnError func(ctx context.Context, err error)
+}
+
+// Relay moves the messages in the outbox table to Elasticsearch.
+//
+// Each batch is sent as a bulk request through the Indexer, and the delivered messages are deleted from the outbox table.
+// The messages of the same document are coalesced to the latest one in the batch, so the order of the changes of each document is kept.
+// It is at-least-once delivery, so a message may be delivered again if the deletion fails.
+// Only one Relay should run for each outbox table.
+type Relay struct {
+	outbox *Outbox
+	db     *sql.DB
+	opts   RelayOptions
+}
+
+// MessageError is an error of the message that failed to be delivered.
+type MessageError struct {
+	Message *Message
+	Err     error
+}
+
+// Error returns the error message.
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("outbox: failed to %s %s/%s: %s", e.Message.Action, e.Message.Index, e.Message.DocumentID, e.Err)
+}
+
+// Unwrap returns the error of Elasticsearch.
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+// Relay creates a Relay which reads the outbox table from the db.
+func (o *Outbox) Relay(db *sql.DB, opts RelayOptions) *Relay {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	return &Relay{outbox: o, db: db, opts: opts}
+}
+
+// Run relays the messages until the context is done. It returns the error of the context.
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		delivered, fetched, err := r.relay(ctx)
+		if err != nil {
+			r.onError(ctx, err)
+		}
+		// NOTE: it continues without waiting while the messages remain and are delivered.
+		if err == nil && fetched == r.opts.BatchSize && delivered == fetched {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		timer := time.NewTimer(r.opts.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// RelayOnce relays a batch of messages, and returns the number of the delivered messages.
+// The failed messages are passed to OnError, and they are relayed again next time.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	delivered, _, err := r.relay(ctx)
+	return delivered, err
+}
+
+func (r *Relay) relay(ctx context.Context) (delivered int, fetched int, err error) {
+	messages, err := r.fetch(ctx)
+	if err != nil || len(messages) == 0 {
+		return 0, 0, err
+	}
+
+	// NOTE: the earlier messages of the same document are superseded by the latest one.
+	groups := map[[2]string][]*Message{}
+	for _, msg := range messages {
+		key := [2]string{msg.Index, msg.DocumentID}
+		groups[key] = append(groups[key], msg)
+	}
+	var latest []*Message
+	for _, msg := range messages {
+		if group := groups[[2]string{msg.Index, msg.DocumentID}]; group[len(group)-1] == msg {
+			latest = append(latest, msg)
+		}
+	}
+
+	errs, err := r.deliver(ctx, latest)
+	if err != nil {
+		// NOTE: the whole batch is counted as failed, so that a message which breaks the bulk request does not block the table forever.
+		if failErr := r.failAll(ctx, messages, err); failErr != nil {
+			r.onError(ctx, failErr)
+		}
+		return 0, len(messages), err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, len(messages), err
+	}
+	defer tx.Rollback()
+
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE id = %s", r.outbox.cfg.Table, r.outbox.placeholder(1))
+	failQuery := r.failQuery()
+	var failed []error
+	for i, msg := range latest {
+		// NOTE: all messages of the document are failed together, so that the older ones are not relayed after the latest one reaches MaxAttempts.
+		for _, m := range groups[[2]string{msg.Index, msg.DocumentID}] {
+			if errs[i] == nil {
+				_, err = tx.ExecContext(ctx, deleteQuery, m.ID)
+				delivered++
+			} else {
+				_, err = tx.ExecContext(ctx, failQuery, errs[i].Error(), m.ID)
+			}
+			if err != nil {
+				return 0, len(messages), err
+			}
+		}
+		if errs[i] != nil {
+			failed = append(failed, &MessageError{Message: msg, Err: errs[i]})
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, len(messages), err
+	}
+
+	for _, err := range failed {
+		r.onError(ctx, err)
+	}
+	return delivered, len(messages), nil
+}
+
+// failAll increases the attempts of all messages with the error of the batch.
+func (r *Relay) failAll(ctx context.Context, messages []*Message, cause error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	failQuery := r.failQuery()
+	for _, msg := range messages {
+		if _, err := tx.ExecContext(ctx, failQuery, cause.Error(), msg.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *Relay) failQuery() string {
+	return fmt.Sprintf(
+		"UPDATE %s SET attempts = attempts + 1, last_error = %s WHERE id = %s",
+		r.outbox.cfg.Table, r.outbox.placeholder(1), r.outbox.placeholder(2),
+	)
+}
+
+func (r *Relay) fetch(ctx context.Context) ([]*Message, error) {
+	query := fmt.Sprintf(
+		"SELECT id, index_name, document_id, action, body, attempts FROM %s WHERE attempts < %s ORDER BY id LIMIT %s",
+		r.outbox.cfg.Table, r.outbox.placeholder(1), r.outbox.placeholder(2),
+	)
+	rows, err := r.db.QueryContext(ctx, query, r.opts.MaxAttempts, r.opts.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.Index, &msg.DocumentID, &msg.Action, &msg.Body, &msg.Attempts); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &msg)
+	}
+	return messages, rows.Err()
+}
+
+// deliver sends the messages as a bulk request, and returns the error of each message.
+func (r *Relay) deliver(ctx context.Context, messages []*Message) ([]error, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, msg := range messages {
+		meta := map[string]interface{}{
+			msg.Action: map[string]interface{}{"_index": msg.Index, "_id": msg.DocumentID},
+		}
+		if err := enc.Encode(meta); err != nil {
+			return nil, err
+		}
+		if msg.Action == ActionIndex {
+			buf.Write(bytes.TrimSpace(msg.Body))
+			buf.WriteByte('\n')
+		}
+	}
+
+	indexer := r.outbox.indexer.WithContext(ctx)
+	var res struct {
+		Items []map[string]elsearm.ErrorResponse `json:"items"`
+	}
+	if err := indexer.Do(&esapi.BulkRequest{Body: &buf, Refresh: indexer.Config().Refresh}, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Items) != len(messages) {
+		return nil, fmt.Errorf("outbox: the bulk response has %d items, but %d items are sent", len(res.Items), len(messages))
+	}
+
+	errs := make([]error, len(messages))
+	for i, item := range res.Items {
+		for _, result := range item {
+			status := int(result.Status)
+			// NOTE: the document has already been deleted, if the delete returns 404.
+			if status < 300 || (messages[i].Action == ActionDelete && status == http.StatusNotFound) {
+				continue
+			}
+			errRes := result
+			if errRes.Err.Reason == "" {
+				errRes.Err.Reason = http.StatusText(status)
+			}
+			errs[i] = &errRes
+		}
+	}
+	return errs, nil
+}
+
+func (r *Relay) onError(ctx context.Context, err error) {
+	if r.opts.OnError != nil {
+		r.opts.OnError(ctx, err)
+	}
+}
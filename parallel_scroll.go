@@ -0,0 +1,162 @@
+package elsearm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/soranoba/elsearm/query"
+)
+
+// ParallelScrollOptions is options of ParallelScroll.
+type ParallelScrollOptions struct {
+	// A number of slices. It is recommended to be less than or equal to the number of shards.
+	// If it is less than 2, the documents are scrolled without slicing.
+	Slices int
+	// A search source that has the query. If it is nil, all documents are scrolled.
+	// The size of the source is used as the page size of each slice.
+	Source *query.SearchSource
+	// A keep alive of the scroll contexts. If it is zero, DefaultIteratorKeepAlive is used.
+	KeepAlive time.Duration
+}
+
+// ParallelScrollError is an error of ParallelScroll that has the errors of the slices.
+type ParallelScrollError struct {
+	// The key is an id of the slice.
+	Errors map[int]error
+}
+
+func (err *ParallelScrollError) Error() string {
+	ids := make([]int, 0, len(err.Errors))
+	for id := range err.Errors {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = fmt.Sprintf("slice %d: %s", id, err.Errors[id])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any error of the slices matches the target.
+func (err *ParallelScrollError) Is(target error) bool {
+	for _, e := range err.Errors {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParallelScroll scrolls the documents of the search index of the model with sliced scrolls.
+// Each slice runs on its own goroutine, and f is called with the decoded model on the caller's goroutine.
+// The slices wait until f returns, so the documents are not fetched faster than f processes them.
+// If f or any slice returns an error, the other slices are canceled.
+// The errors of the slices are returned as a ParallelScrollError.
+func (indexer *Indexer) ParallelScroll(model interface{}, opts ParallelScrollOptions, f func(model interface{}) error) error {
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
+	t := reflect.TypeOf(model).Elem()
+
+	slices := opts.Slices
+	if slices < 2 {
+		slices = 1
+	}
+
+	ctx, cancel := context.WithCancel(indexer.ctx)
+	defer cancel()
+	scoped := indexer.WithContext(ctx)
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = make(map[int]error)
+		ch   = make(chan interface{})
+	)
+	for id := 0; id < slices; id++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			err := scoped.scrollSlice(t, id, slices, opts, ch)
+			if err == nil || (ctx.Err() != nil && errors.Is(err, context.Canceled)) {
+				return
+			}
+			mu.Lock()
+			errs[id] = err
+			mu.Unlock()
+			cancel()
+		}(id)
+	}
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	var fErr error
+	for m := range ch {
+		if fErr != nil {
+			continue
+		}
+		if err := f(m); err != nil {
+			fErr = err
+			cancel()
+		}
+	}
+
+	if fErr != nil {
+		return fErr
+	}
+	if len(errs) > 0 {
+		return &ParallelScrollError{Errors: errs}
+	}
+	return indexer.ctx.Err()
+}
+
+func (indexer *Indexer) scrollSlice(t reflect.Type, id int, max int, opts ParallelScrollOptions, ch chan<- interface{}) error {
+	source := opts.Source
+	if source == nil {
+		source = query.NewSearchSource()
+	}
+	body := source.Source()
+	delete(body, "from")
+	delete(body, "aggs")
+	if max > 1 {
+		body["slice"] = map[string]interface{}{"id": id, "max": max}
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	models := reflect.New(reflect.SliceOf(reflect.PtrTo(t)))
+	it, err := indexer.ScrollIterator(models.Interface(), opts.KeepAlive, func(req *esapi.SearchRequest) {
+		req.Body = bytes.NewReader(b)
+	})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for it.Next() {
+		page := models.Elem()
+		for i := 0; i < page.Len(); i++ {
+			select {
+			case ch <- page.Index(i).Interface():
+			case <-indexer.ctx.Done():
+				return indexer.ctx.Err()
+			}
+		}
+	}
+	return it.Err()
+}
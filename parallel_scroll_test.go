@@ -0,0 +1,66 @@
+package elsearm
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/soranoba/elsearm/query"
+)
+
+func TestIndexerParallelScroll(t *testing.T) {
+	_ = indexer.DeleteIndex(&User{})
+	if err := indexer.CreateIndex(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 10; i++ {
+		if err := indexer.Update(&User{ID: uint(i), Name: "user"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// NOTE: default refresh interval.
+	time.Sleep(1 * time.Second)
+
+	var ids []int
+	err := indexer.ParallelScroll(&User{}, ParallelScrollOptions{
+		Slices: 3,
+		Source: query.NewSearchSource().Size(2),
+	}, func(model interface{}) error {
+		ids = append(ids, int(model.(*User).ID))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(ids)
+	if len(ids) != 10 || ids[0] != 1 || ids[9] != 10 {
+		t.Errorf("invalid result: got %v", ids)
+	}
+
+	errStop := errors.New("stop")
+	count := 0
+	err = indexer.ParallelScroll(&User{}, ParallelScrollOptions{
+		Slices: 2,
+		Source: query.NewSearchSource().Size(1),
+	}, func(model interface{}) error {
+		count++
+		return errStop
+	})
+	if err != errStop || count != 1 {
+		t.Errorf("invalid result: got %v, %d", err, count)
+	}
+}
+
+func TestIndexerParallelScroll_error(t *testing.T) {
+	_ = indexer.DeleteIndex(&Team{})
+
+	err := indexer.ParallelScroll(&Team{}, ParallelScrollOptions{Slices: 2}, func(model interface{}) error {
+		return nil
+	})
+	var scrollErr *ParallelScrollError
+	if !errors.As(err, &scrollErr) || !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
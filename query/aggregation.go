@@ -0,0 +1,399 @@
+package query
+
+// Aggregation is an interface of the aggregations.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations.html
+type Aggregation interface {
+	// Source returns a data structure that is serialized as the aggregation.
+	Source() map[string]interface{}
+}
+
+// TermsAggregation is a bucket aggregation that a bucket is dynamically built for each unique value.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-terms-aggregation.html
+type TermsAggregation struct {
+	params  map[string]interface{}
+	subAggs map[string]Aggregation
+}
+
+// DateHistogramAggregation is a bucket aggregation that buckets are built for each date interval.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-datehistogram-aggregation.html
+type DateHistogramAggregation struct {
+	params  map[string]interface{}
+	subAggs map[string]Aggregation
+}
+
+// HistogramAggregation is a bucket aggregation that buckets are built for each numeric interval.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-histogram-aggregation.html
+type HistogramAggregation struct {
+	params  map[string]interface{}
+	subAggs map[string]Aggregation
+}
+
+// RangeAggregation is a bucket aggregation that buckets are built for each specified range.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-range-aggregation.html
+type RangeAggregation struct {
+	params  map[string]interface{}
+	ranges  []interface{}
+	subAggs map[string]Aggregation
+}
+
+// FiltersAggregation is a bucket aggregation that buckets are built for each specified filter.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-filters-aggregation.html
+type FiltersAggregation struct {
+	params  map[string]interface{}
+	filters map[string]interface{}
+	subAggs map[string]Aggregation
+}
+
+// NestedAggregation is a bucket aggregation that aggregates nested documents.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-nested-aggregation.html
+type NestedAggregation struct {
+	path    string
+	subAggs map[string]Aggregation
+}
+
+// MetricAggregation is a metrics aggregation that computes a single value.
+// For example, avg, sum, min, max and cardinality.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-metrics.html
+type MetricAggregation struct {
+	typ    string
+	params map[string]interface{}
+}
+
+// PercentilesAggregation is a metrics aggregation that computes percentiles.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-metrics-percentile-aggregation.html
+type PercentilesAggregation struct {
+	params map[string]interface{}
+}
+
+// TopHitsAggregation is a metrics aggregation that returns the most relevant documents.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-metrics-top-hits-aggregation.html
+type TopHitsAggregation struct {
+	params map[string]interface{}
+	sort   []interface{}
+}
+
+// TermsAgg creates a TermsAggregation.
+func TermsAgg(field string) *TermsAggregation {
+	return &TermsAggregation{params: map[string]interface{}{"field": field}}
+}
+
+// Size sets the number of buckets to return.
+func (agg *TermsAggregation) Size(size int) *TermsAggregation {
+	agg.params["size"] = size
+	return agg
+}
+
+// MinDocCount sets the minimum number of documents that a bucket contains.
+func (agg *TermsAggregation) MinDocCount(count int) *TermsAggregation {
+	agg.params["min_doc_count"] = count
+	return agg
+}
+
+// Order sets the order of buckets. The key is `_count`, `_key` or a name of sub-aggregation.
+func (agg *TermsAggregation) Order(key string, order string) *TermsAggregation {
+	agg.params["order"] = map[string]interface{}{key: order}
+	return agg
+}
+
+// Missing sets the value to use for documents that do not have the field.
+func (agg *TermsAggregation) Missing(value interface{}) *TermsAggregation {
+	agg.params["missing"] = value
+	return agg
+}
+
+// SubAggregation adds an aggregation that is computed for each bucket.
+func (agg *TermsAggregation) SubAggregation(name string, subAgg Aggregation) *TermsAggregation {
+	agg.subAggs = addAggregation(agg.subAggs, name, subAgg)
+	return agg
+}
+
+// Source returns a data structure that is serialized as the aggregation.
+func (agg *TermsAggregation) Source() map[string]interface{} {
+	return aggregationSource("terms", copyParams(agg.params), agg.subAggs)
+}
+
+// DateHistogramAgg creates a DateHistogramAggregation.
+func DateHistogramAgg(field string) *DateHistogramAggregation {
+	return &DateHistogramAggregation{params: map[string]interface{}{"field": field}}
+}
+
+// CalendarInterval sets a calendar-aware interval. For example, `1d`, `1M` and `1y`.
+func (agg *DateHistogramAggregation) CalendarInterval(interval string) *DateHistogramAggregation {
+	agg.params["calendar_interval"] = interval
+	return agg
+}
+
+// FixedInterval sets a fixed interval. For example, `30m` and `10d`.
+func (agg *DateHistogramAggregation) FixedInterval(interval string) *DateHistogramAggregation {
+	agg.params["fixed_interval"] = interval
+	return agg
+}
+
+// Format sets the date format of key_as_string.
+func (agg *DateHistogramAggregation) Format(format string) *DateHistogramAggregation {
+	agg.params["format"] = format
+	return agg
+}
+
+// TimeZone sets the time zone used to bucket.
+func (agg *DateHistogramAggregation) TimeZone(tz string) *DateHistogramAggregation {
+	agg.params["time_zone"] = tz
+	return agg
+}
+
+// MinDocCount sets the minimum number of documents that a bucket contains.
+func (agg *DateHistogramAggregation) MinDocCount(count int) *DateHistogramAggregation {
+	agg.params["min_doc_count"] = count
+	return agg
+}
+
+// SubAggregation adds an aggregation that is computed for each bucket.
+func (agg *DateHistogramAggregation) SubAggregation(name string, subAgg Aggregation) *DateHistogramAggregation {
+	agg.subAggs = addAggregation(agg.subAggs, name, subAgg)
+	return agg
+}
+
+// Source returns a data structure that is serialized as the aggregation.
+func (agg *DateHistogramAggregation) Source() map[string]interface{} {
+	return aggregationSource("date_histogram", copyParams(agg.params), agg.subAggs)
+}
+
+// HistogramAgg creates a HistogramAggregation.
+func HistogramAgg(field string, interval float64) *HistogramAggregation {
+	return &HistogramAggregation{params: map[string]interface{}{"field": field, "interval": interval}}
+}
+
+// Offset sets the offset of the bucket keys.
+func (agg *HistogramAggregation) Offset(offset float64) *HistogramAggregation {
+	agg.params["offset"] = offset
+	return agg
+}
+
+// MinDocCount sets the minimum number of documents that a bucket contains.
+func (agg *HistogramAggregation) MinDocCount(count int) *HistogramAggregation {
+	agg.params["min_doc_count"] = count
+	return agg
+}
+
+// SubAggregation adds an aggregation that is computed for each bucket.
+func (agg *HistogramAggregation) SubAggregation(name string, subAgg Aggregation) *HistogramAggregation {
+	agg.subAggs = addAggregation(agg.subAggs, name, subAgg)
+	return agg
+}
+
+// Source returns a data structure that is serialized as the aggregation.
+func (agg *HistogramAggregation) Source() map[string]interface{} {
+	return aggregationSource("histogram", copyParams(agg.params), agg.subAggs)
+}
+
+// RangeAgg creates a RangeAggregation.
+func RangeAgg(field string) *RangeAggregation {
+	return &RangeAggregation{params: map[string]interface{}{"field": field}}
+}
+
+// AddRange adds a range that includes from and excludes to.
+// If from or to is nil, the range is unbounded on the side.
+func (agg *RangeAggregation) AddRange(from interface{}, to interface{}) *RangeAggregation {
+	return agg.AddRangeWithKey("", from, to)
+}
+
+// AddRangeWithKey adds a range with the key of the bucket.
+func (agg *RangeAggregation) AddRangeWithKey(key string, from interface{}, to interface{}) *RangeAggregation {
+	r := map[string]interface{}{}
+	if key != "" {
+		r["key"] = key
+	}
+	if from != nil {
+		r["from"] = from
+	}
+	if to != nil {
+		r["to"] = to
+	}
+	agg.ranges = append(agg.ranges, r)
+	return agg
+}
+
+// SubAggregation adds an aggregation that is computed for each bucket.
+func (agg *RangeAggregation) SubAggregation(name string, subAgg Aggregation) *RangeAggregation {
+	agg.subAggs = addAggregation(agg.subAggs, name, subAgg)
+	return agg
+}
+
+// Source returns a data structure that is serialized as the aggregation.
+func (agg *RangeAggregation) Source() map[string]interface{} {
+	body := copyParams(agg.params)
+	ranges := agg.ranges
+	if ranges == nil {
+		ranges = []interface{}{}
+	}
+	body["ranges"] = ranges
+	return aggregationSource("range", body, agg.subAggs)
+}
+
+// FiltersAgg creates a FiltersAggregation.
+func FiltersAgg() *FiltersAggregation {
+	return &FiltersAggregation{params: map[string]interface{}{}, filters: map[string]interface{}{}}
+}
+
+// Filter adds a filter that builds the bucket of the name.
+func (agg *FiltersAggregation) Filter(name string, q Query) *FiltersAggregation {
+	agg.filters[name] = q.Source()
+	return agg
+}
+
+// OtherBucket sets whether to add a bucket for documents that do not match any filters.
+func (agg *FiltersAggregation) OtherBucket(enabled bool) *FiltersAggregation {
+	agg.params["other_bucket"] = enabled
+	return agg
+}
+
+// SubAggregation adds an aggregation that is computed for each bucket.
+func (agg *FiltersAggregation) SubAggregation(name string, subAgg Aggregation) *FiltersAggregation {
+	agg.subAggs = addAggregation(agg.subAggs, name, subAgg)
+	return agg
+}
+
+// Source returns a data structure that is serialized as the aggregation.
+func (agg *FiltersAggregation) Source() map[string]interface{} {
+	body := copyParams(agg.params)
+	body["filters"] = agg.filters
+	return aggregationSource("filters", body, agg.subAggs)
+}
+
+// NestedAgg creates a NestedAggregation.
+func NestedAgg(path string) *NestedAggregation {
+	return &NestedAggregation{path: path}
+}
+
+// SubAggregation adds an aggregation that is computed for the nested documents.
+func (agg *NestedAggregation) SubAggregation(name string, subAgg Aggregation) *NestedAggregation {
+	agg.subAggs = addAggregation(agg.subAggs, name, subAgg)
+	return agg
+}
+
+// Source returns a data structure that is serialized as the aggregation.
+func (agg *NestedAggregation) Source() map[string]interface{} {
+	return aggregationSource("nested", map[string]interface{}{"path": agg.path}, agg.subAggs)
+}
+
+// AvgAgg creates a MetricAggregation that computes the average.
+func AvgAgg(field string) *MetricAggregation {
+	return newMetricAggregation("avg", field)
+}
+
+// SumAgg creates a MetricAggregation that computes the sum.
+func SumAgg(field string) *MetricAggregation {
+	return newMetricAggregation("sum", field)
+}
+
+// MinAgg creates a MetricAggregation that computes the minimum value.
+func MinAgg(field string) *MetricAggregation {
+	return newMetricAggregation("min", field)
+}
+
+// MaxAgg creates a MetricAggregation that computes the maximum value.
+func MaxAgg(field string) *MetricAggregation {
+	return newMetricAggregation("max", field)
+}
+
+// CardinalityAgg creates a MetricAggregation that computes an approximate count of distinct values.
+func CardinalityAgg(field string) *MetricAggregation {
+	return newMetricAggregation("cardinality", field)
+}
+
+func newMetricAggregation(typ string, field string) *MetricAggregation {
+	return &MetricAggregation{typ: typ, params: map[string]interface{}{"field": field}}
+}
+
+// Missing sets the value to use for documents that do not have the field.
+func (agg *MetricAggregation) Missing(value interface{}) *MetricAggregation {
+	agg.params["missing"] = value
+	return agg
+}
+
+// PrecisionThreshold sets the count below which counts are expected to be close to accurate.
+// It is available only for the cardinality aggregation.
+func (agg *MetricAggregation) PrecisionThreshold(threshold int) *MetricAggregation {
+	agg.params["precision_threshold"] = threshold
+	return agg
+}
+
+// Source returns a data structure that is serialized as the aggregation.
+func (agg *MetricAggregation) Source() map[string]interface{} {
+	return aggregationSource(agg.typ, copyParams(agg.params), nil)
+}
+
+// PercentilesAgg creates a PercentilesAggregation.
+func PercentilesAgg(field string) *PercentilesAggregation {
+	return &PercentilesAggregation{params: map[string]interface{}{"field": field}}
+}
+
+// Percents sets the percentiles to compute.
+func (agg *PercentilesAggregation) Percents(percents ...float64) *PercentilesAggregation {
+	agg.params["percents"] = percents
+	return agg
+}
+
+// Source returns a data structure that is serialized as the aggregation.
+func (agg *PercentilesAggregation) Source() map[string]interface{} {
+	return aggregationSource("percentiles", copyParams(agg.params), nil)
+}
+
+// TopHitsAgg creates a TopHitsAggregation.
+func TopHitsAgg() *TopHitsAggregation {
+	return &TopHitsAggregation{params: map[string]interface{}{}}
+}
+
+// Size sets the number of hits to return per bucket.
+func (agg *TopHitsAggregation) Size(size int) *TopHitsAggregation {
+	agg.params["size"] = size
+	return agg
+}
+
+// Sort adds a field to sort the hits. The order is `asc` or `desc`.
+func (agg *TopHitsAggregation) Sort(field string, order string) *TopHitsAggregation {
+	agg.sort = append(agg.sort, map[string]interface{}{field: map[string]interface{}{"order": order}})
+	return agg
+}
+
+// FetchSource sets the fields of the source to return.
+func (agg *TopHitsAggregation) FetchSource(includes ...string) *TopHitsAggregation {
+	if includes == nil {
+		includes = []string{}
+	}
+	agg.params["_source"] = includes
+	return agg
+}
+
+// Source returns a data structure that is serialized as the aggregation.
+func (agg *TopHitsAggregation) Source() map[string]interface{} {
+	body := copyParams(agg.params)
+	if len(agg.sort) > 0 {
+		body["sort"] = agg.sort
+	}
+	return aggregationSource("top_hits", body, nil)
+}
+
+func addAggregation(aggs map[string]Aggregation, name string, agg Aggregation) map[string]Aggregation {
+	if aggs == nil {
+		aggs = map[string]Aggregation{}
+	}
+	aggs[name] = agg
+	return aggs
+}
+
+func aggregationsSource(aggs map[string]Aggregation) map[string]interface{} {
+	srcs := make(map[string]interface{}, len(aggs))
+	for name, agg := range aggs {
+		srcs[name] = agg.Source()
+	}
+	return srcs
+}
+
+func aggregationSource(typ string, body map[string]interface{}, subAggs map[string]Aggregation) map[string]interface{} {
+	src := map[string]interface{}{typ: body}
+	if len(subAggs) > 0 {
+		src["aggs"] = aggregationsSource(subAggs)
+	}
+	return src
+}
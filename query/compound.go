@@ -0,0 +1,133 @@
+package query
+
+// BoolQuery is a query that matches documents matching boolean combinations of other queries.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-bool-query.html
+type BoolQuery struct {
+	must    []Query
+	should  []Query
+	filter  []Query
+	mustNot []Query
+	params  map[string]interface{}
+}
+
+// NestedQuery is a query that searches nested field objects.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-nested-query.html
+type NestedQuery struct {
+	path   string
+	query  Query
+	params map[string]interface{}
+}
+
+// MatchAllQuery is a query that matches all documents.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-match-all-query.html
+type MatchAllQuery struct {
+	params map[string]interface{}
+}
+
+// Bool creates a BoolQuery.
+func Bool() *BoolQuery {
+	return &BoolQuery{params: map[string]interface{}{}}
+}
+
+// Must adds queries that must appear in matching documents.
+func (q *BoolQuery) Must(queries ...Query) *BoolQuery {
+	q.must = append(q.must, queries...)
+	return q
+}
+
+// Should adds queries that should appear in matching documents.
+func (q *BoolQuery) Should(queries ...Query) *BoolQuery {
+	q.should = append(q.should, queries...)
+	return q
+}
+
+// Filter adds queries that must appear in matching documents. The score of them is ignored.
+func (q *BoolQuery) Filter(queries ...Query) *BoolQuery {
+	q.filter = append(q.filter, queries...)
+	return q
+}
+
+// MustNot adds queries that must not appear in matching documents.
+func (q *BoolQuery) MustNot(queries ...Query) *BoolQuery {
+	q.mustNot = append(q.mustNot, queries...)
+	return q
+}
+
+// MinimumShouldMatch sets the number or percentage of should clauses returned documents must match.
+func (q *BoolQuery) MinimumShouldMatch(value interface{}) *BoolQuery {
+	q.params["minimum_should_match"] = value
+	return q
+}
+
+// Boost sets the relevance scores of the query.
+func (q *BoolQuery) Boost(boost float64) *BoolQuery {
+	q.params["boost"] = boost
+	return q
+}
+
+// Source returns a data structure that is serialized as the query DSL.
+func (q *BoolQuery) Source() map[string]interface{} {
+	body := copyParams(q.params)
+	if len(q.must) > 0 {
+		body["must"] = sources(q.must)
+	}
+	if len(q.should) > 0 {
+		body["should"] = sources(q.should)
+	}
+	if len(q.filter) > 0 {
+		body["filter"] = sources(q.filter)
+	}
+	if len(q.mustNot) > 0 {
+		body["must_not"] = sources(q.mustNot)
+	}
+	return map[string]interface{}{"bool": body}
+}
+
+// Nested creates a NestedQuery.
+func Nested(path string, query Query) *NestedQuery {
+	return &NestedQuery{path: path, query: query, params: map[string]interface{}{}}
+}
+
+// ScoreMode sets how scores for matching child objects affect the root parent document's relevance score.
+func (q *NestedQuery) ScoreMode(mode string) *NestedQuery {
+	q.params["score_mode"] = mode
+	return q
+}
+
+// IgnoreUnmapped sets whether to ignore an unmapped path.
+func (q *NestedQuery) IgnoreUnmapped(ignore bool) *NestedQuery {
+	q.params["ignore_unmapped"] = ignore
+	return q
+}
+
+// Source returns a data structure that is serialized as the query DSL.
+func (q *NestedQuery) Source() map[string]interface{} {
+	body := copyParams(q.params)
+	body["path"] = q.path
+	body["query"] = q.query.Source()
+	return map[string]interface{}{"nested": body}
+}
+
+// MatchAll creates a MatchAllQuery.
+func MatchAll() *MatchAllQuery {
+	return &MatchAllQuery{params: map[string]interface{}{}}
+}
+
+// Boost sets the relevance scores of the query.
+func (q *MatchAllQuery) Boost(boost float64) *MatchAllQuery {
+	q.params["boost"] = boost
+	return q
+}
+
+// Source returns a data structure that is serialized as the query DSL.
+func (q *MatchAllQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"match_all": copyParams(q.params)}
+}
+
+func copyParams(params map[string]interface{}) map[string]interface{} {
+	body := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		body[k] = v
+	}
+	return body
+}
@@ -0,0 +1,110 @@
+package query
+
+// MatchQuery is a query that matches documents containing a text, number, date or boolean value.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-match-query.html
+type MatchQuery struct {
+	field  string
+	params map[string]interface{}
+}
+
+// MultiMatchQuery is a MatchQuery that targets multiple fields.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-multi-match-query.html
+type MultiMatchQuery struct {
+	params map[string]interface{}
+}
+
+// Match creates a MatchQuery.
+func Match(field string, query interface{}) *MatchQuery {
+	return &MatchQuery{field: field, params: map[string]interface{}{"query": query}}
+}
+
+// Operator sets the boolean logic used to interpret text in the query. The value is `OR` or `AND`.
+func (q *MatchQuery) Operator(operator string) *MatchQuery {
+	q.params["operator"] = operator
+	return q
+}
+
+// Analyzer sets the analyzer used to convert text in the query.
+func (q *MatchQuery) Analyzer(analyzer string) *MatchQuery {
+	q.params["analyzer"] = analyzer
+	return q
+}
+
+// Fuzziness sets the maximum edit distance allowed for matching.
+func (q *MatchQuery) Fuzziness(fuzziness string) *MatchQuery {
+	q.params["fuzziness"] = fuzziness
+	return q
+}
+
+// MinimumShouldMatch sets the number or percentage of clauses returned documents must match.
+func (q *MatchQuery) MinimumShouldMatch(value interface{}) *MatchQuery {
+	q.params["minimum_should_match"] = value
+	return q
+}
+
+// Boost sets the relevance scores of the query.
+func (q *MatchQuery) Boost(boost float64) *MatchQuery {
+	q.params["boost"] = boost
+	return q
+}
+
+// Source returns a data structure that is serialized as the query DSL.
+func (q *MatchQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"match": map[string]interface{}{q.field: copyParams(q.params)}}
+}
+
+// MultiMatch creates a MultiMatchQuery.
+func MultiMatch(query interface{}, fields ...string) *MultiMatchQuery {
+	if fields == nil {
+		fields = []string{}
+	}
+	return &MultiMatchQuery{params: map[string]interface{}{"query": query, "fields": fields}}
+}
+
+// Type sets how the query is executed internally.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-multi-match-query.html#multi-match-types
+func (q *MultiMatchQuery) Type(typ string) *MultiMatchQuery {
+	q.params["type"] = typ
+	return q
+}
+
+// Operator sets the boolean logic used to interpret text in the query. The value is `OR` or `AND`.
+func (q *MultiMatchQuery) Operator(operator string) *MultiMatchQuery {
+	q.params["operator"] = operator
+	return q
+}
+
+// Analyzer sets the analyzer used to convert text in the query.
+func (q *MultiMatchQuery) Analyzer(analyzer string) *MultiMatchQuery {
+	q.params["analyzer"] = analyzer
+	return q
+}
+
+// Fuzziness sets the maximum edit distance allowed for matching.
+func (q *MultiMatchQuery) Fuzziness(fuzziness string) *MultiMatchQuery {
+	q.params["fuzziness"] = fuzziness
+	return q
+}
+
+// TieBreaker sets the factor that increases the relevance scores of documents matching multiple fields.
+func (q *MultiMatchQuery) TieBreaker(tieBreaker float64) *MultiMatchQuery {
+	q.params["tie_breaker"] = tieBreaker
+	return q
+}
+
+// MinimumShouldMatch sets the number or percentage of clauses returned documents must match.
+func (q *MultiMatchQuery) MinimumShouldMatch(value interface{}) *MultiMatchQuery {
+	q.params["minimum_should_match"] = value
+	return q
+}
+
+// Boost sets the relevance scores of the query.
+func (q *MultiMatchQuery) Boost(boost float64) *MultiMatchQuery {
+	q.params["boost"] = boost
+	return q
+}
+
+// Source returns a data structure that is serialized as the query DSL.
+func (q *MultiMatchQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"multi_match": copyParams(q.params)}
+}
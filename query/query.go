@@ -0,0 +1,65 @@
+// Package query provides builders of the Elasticsearch query DSL.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl.html
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// Query is an interface of the query DSL.
+type Query interface {
+	// Source returns a data structure that is serialized as the query DSL.
+	Source() map[string]interface{}
+}
+
+// Search returns a function that sets the query to the body of esapi.SearchRequest.
+// It can be passed to elsearm.Indexer.Search.
+func Search(q Query) func(*esapi.SearchRequest) {
+	return NewSearchSource().Query(q).SearchRequest()
+}
+
+// Count returns a function that sets the query to the body of esapi.CountRequest.
+// It can be passed to elsearm.Indexer.Count.
+func Count(q Query) func(*esapi.CountRequest) {
+	return NewSearchSource().Query(q).CountRequest()
+}
+
+// DeleteByQuery returns a function that sets the query to the body of esapi.DeleteByQueryRequest.
+func DeleteByQuery(q Query) func(*esapi.DeleteByQueryRequest) {
+	return NewSearchSource().Query(q).DeleteByQueryRequest()
+}
+
+// MarshalJSON returns the query DSL of q.
+func MarshalJSON(q Query) ([]byte, error) {
+	return json.Marshal(q.Source())
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// bodyReader returns a reader of the JSON encoded v.
+// If it failed to encode, the reader returns the error when reading.
+func bodyReader(v interface{}) io.Reader {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return &errorReader{err: err}
+	}
+	return bytes.NewReader(b)
+}
+
+func sources(queries []Query) []interface{} {
+	srcs := make([]interface{}, len(queries))
+	for i, q := range queries {
+		srcs[i] = q.Source()
+	}
+	return srcs
+}
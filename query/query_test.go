@@ -0,0 +1,167 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func assertGolden(t *testing.T, name string, v interface{}) {
+	t.Helper()
+
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = append(b, '\n')
+
+	path := filepath.Join("testdata", name+".golden.json")
+	if *update {
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wants, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, wants) {
+		t.Errorf("invalid json: gots %s, wants %s", b, wants)
+	}
+}
+
+func TestQuerySource(t *testing.T) {
+	cases := []struct {
+		name  string
+		query Query
+	}{
+		{"match_all", MatchAll()},
+		{"term", Term("name", "Alice")},
+		{"term_with_boost", Term("name", "Alice").Boost(2)},
+		{"terms", Terms("id", 1, 2, 3)},
+		{"match", Match("name", "Alice Bob").Operator("AND").Fuzziness("AUTO")},
+		{"multi_match", MultiMatch("Alice", "name", "nickname").Type("best_fields").TieBreaker(0.3)},
+		{"range", Range("created_at").Gte("2020-01-01").Lt("2021-01-01").Format("yyyy-MM-dd")},
+		{"exists", Exists("name")},
+		{"nested", Nested("members", Term("members.name", "Alice")).ScoreMode("avg")},
+		{"ids", IDs("1", "2")},
+		{"prefix", Prefix("name", "Al")},
+		{"wildcard", Wildcard("name", "A*e").Boost(1.5)},
+		{
+			"bool",
+			Bool().
+				Must(Match("name", "Alice")).
+				Should(Term("team", "a"), Term("team", "b")).
+				Filter(Range("age").Gte(20)).
+				MustNot(Exists("deleted_at")).
+				MinimumShouldMatch(1),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assertGolden(t, c.name, c.query.Source())
+		})
+	}
+}
+
+func TestSearchSource(t *testing.T) {
+	source := NewSearchSource().
+		Query(Term("name", "Alice")).
+		From(10).
+		Size(20).
+		Sort("created_at", "desc").
+		Sort("id", "asc").
+		FetchSource("id", "name").
+		TrackTotalHits(true)
+	assertGolden(t, "search_source", source.Source())
+}
+
+func TestAggregationSource(t *testing.T) {
+	cases := []struct {
+		name string
+		agg  Aggregation
+	}{
+		{"terms_agg", TermsAgg("team").Size(5).Order("_count", "desc").SubAggregation("avg_age", AvgAgg("age"))},
+		{"date_histogram_agg", DateHistogramAgg("created_at").CalendarInterval("1d").Format("yyyy-MM-dd").MinDocCount(0)},
+		{"histogram_agg", HistogramAgg("age", 10).Offset(5)},
+		{"range_agg", RangeAgg("age").AddRange(nil, 20).AddRange(20, 40).AddRangeWithKey("old", 40, nil)},
+		{"filters_agg", FiltersAgg().Filter("alice", Term("name", "Alice")).Filter("bob", Term("name", "Bob")).OtherBucket(true)},
+		{"nested_agg", NestedAgg("members").SubAggregation("names", TermsAgg("members.name"))},
+		{"sum_agg", SumAgg("age").Missing(0)},
+		{"cardinality_agg", CardinalityAgg("name").PrecisionThreshold(100)},
+		{"percentiles_agg", PercentilesAgg("age").Percents(50, 99)},
+		{"top_hits_agg", TopHitsAgg().Size(1).Sort("created_at", "desc").FetchSource("name")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assertGolden(t, c.name, c.agg.Source())
+		})
+	}
+}
+
+func TestSearchSource_aggregation(t *testing.T) {
+	source := NewSearchSource().
+		Query(MatchAll()).
+		Size(0).
+		Aggregation("teams", TermsAgg("team")).
+		Aggregation("max_age", MaxAgg("age"))
+	assertGolden(t, "search_source_aggregation", source.Source())
+}
+
+func TestSearch(t *testing.T) {
+	req := &esapi.SearchRequest{}
+	Search(Term("name", "Alice"))(req)
+
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"query":{"term":{"name":"Alice"}}}` {
+		t.Errorf("invalid body: got = %s", b)
+	}
+}
+
+func TestCount(t *testing.T) {
+	req := &esapi.CountRequest{}
+	NewSearchSource().Query(Term("name", "Alice")).Size(10).CountRequest()(req)
+
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"query":{"term":{"name":"Alice"}}}` {
+		t.Errorf("invalid body: got = %s", b)
+	}
+}
+
+func TestDeleteByQuery(t *testing.T) {
+	req := &esapi.DeleteByQueryRequest{}
+	DeleteByQuery(IDs("1"))(req)
+
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"query":{"ids":{"values":["1"]}}}` {
+		t.Errorf("invalid body: got = %s", b)
+	}
+}
+
+func TestSearch_invalidValue(t *testing.T) {
+	req := &esapi.SearchRequest{}
+	Search(Term("name", make(chan int)))(req)
+
+	if _, err := ioutil.ReadAll(req.Body); err == nil {
+		t.Errorf("reading the body should fail but succeeded")
+	}
+}
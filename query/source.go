@@ -0,0 +1,110 @@
+package query
+
+import (
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// SearchSource is a request body of the search API.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-search.html#search-search-api-request-body
+type SearchSource struct {
+	query  Query
+	sort   []interface{}
+	aggs   map[string]Aggregation
+	params map[string]interface{}
+}
+
+// NewSearchSource creates a SearchSource.
+func NewSearchSource() *SearchSource {
+	return &SearchSource{params: map[string]interface{}{}}
+}
+
+// Query sets the query to search.
+func (s *SearchSource) Query(q Query) *SearchSource {
+	s.query = q
+	return s
+}
+
+// From sets the starting document offset.
+func (s *SearchSource) From(from int) *SearchSource {
+	s.params["from"] = from
+	return s
+}
+
+// Size sets the number of hits to return.
+func (s *SearchSource) Size(size int) *SearchSource {
+	s.params["size"] = size
+	return s
+}
+
+// Sort adds a field to sort the hits. The order is `asc` or `desc`.
+func (s *SearchSource) Sort(field string, order string) *SearchSource {
+	s.sort = append(s.sort, map[string]interface{}{field: map[string]interface{}{"order": order}})
+	return s
+}
+
+// FetchSource sets the fields of the source to return.
+func (s *SearchSource) FetchSource(includes ...string) *SearchSource {
+	if includes == nil {
+		includes = []string{}
+	}
+	s.params["_source"] = includes
+	return s
+}
+
+// TrackTotalHits sets whether to count the hits accurately. The value is a bool or a number of hits.
+func (s *SearchSource) TrackTotalHits(value interface{}) *SearchSource {
+	s.params["track_total_hits"] = value
+	return s
+}
+
+// Aggregation adds an aggregation of the name.
+func (s *SearchSource) Aggregation(name string, agg Aggregation) *SearchSource {
+	s.aggs = addAggregation(s.aggs, name, agg)
+	return s
+}
+
+// Source returns a data structure that is serialized as the request body.
+func (s *SearchSource) Source() map[string]interface{} {
+	body := copyParams(s.params)
+	if s.query != nil {
+		body["query"] = s.query.Source()
+	}
+	if len(s.sort) > 0 {
+		body["sort"] = s.sort
+	}
+	if len(s.aggs) > 0 {
+		body["aggs"] = aggregationsSource(s.aggs)
+	}
+	return body
+}
+
+// SearchRequest returns a function that sets the request body to esapi.SearchRequest.
+func (s *SearchSource) SearchRequest() func(*esapi.SearchRequest) {
+	return func(req *esapi.SearchRequest) {
+		req.Body = bodyReader(s.Source())
+	}
+}
+
+// CountRequest returns a function that sets the query to esapi.CountRequest.
+// The count API accepts only the query, so the other parameters are ignored.
+func (s *SearchSource) CountRequest() func(*esapi.CountRequest) {
+	return func(req *esapi.CountRequest) {
+		req.Body = bodyReader(s.querySource())
+	}
+}
+
+// DeleteByQueryRequest returns a function that sets the query to esapi.DeleteByQueryRequest.
+// The delete by query API accepts only the query, so the other parameters are ignored.
+func (s *SearchSource) DeleteByQueryRequest() func(*esapi.DeleteByQueryRequest) {
+	return func(req *esapi.DeleteByQueryRequest) {
+		req.Body = bodyReader(s.querySource())
+	}
+}
+
+func (s *SearchSource) querySource() map[string]interface{} {
+	body := map[string]interface{}{}
+	if s.query != nil {
+		body["query"] = s.query.Source()
+	}
+	return body
+}
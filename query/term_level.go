@@ -0,0 +1,213 @@
+package query
+
+// TermQuery is a query that matches documents containing an exact term in a field.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-term-query.html
+type TermQuery struct {
+	field  string
+	value  interface{}
+	params map[string]interface{}
+}
+
+// TermsQuery is a query that matches documents containing one or more exact terms in a field.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-terms-query.html
+type TermsQuery struct {
+	field  string
+	values []interface{}
+	params map[string]interface{}
+}
+
+// RangeQuery is a query that matches documents containing terms within a range.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-range-query.html
+type RangeQuery struct {
+	field  string
+	params map[string]interface{}
+}
+
+// ExistsQuery is a query that matches documents containing an indexed value for a field.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-exists-query.html
+type ExistsQuery struct {
+	field string
+}
+
+// IDsQuery is a query that matches documents based on their DocumentIDs.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-ids-query.html
+type IDsQuery struct {
+	ids []string
+}
+
+// PrefixQuery is a query that matches documents containing a specific prefix in a field.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-prefix-query.html
+type PrefixQuery struct {
+	field  string
+	params map[string]interface{}
+}
+
+// WildcardQuery is a query that matches documents containing terms matching a wildcard pattern.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/query-dsl-wildcard-query.html
+type WildcardQuery struct {
+	field  string
+	params map[string]interface{}
+}
+
+// Term creates a TermQuery.
+func Term(field string, value interface{}) *TermQuery {
+	return &TermQuery{field: field, value: value, params: map[string]interface{}{}}
+}
+
+// Boost sets the relevance scores of the query.
+func (q *TermQuery) Boost(boost float64) *TermQuery {
+	q.params["boost"] = boost
+	return q
+}
+
+// Source returns a data structure that is serialized as the query DSL.
+func (q *TermQuery) Source() map[string]interface{} {
+	if len(q.params) == 0 {
+		return map[string]interface{}{"term": map[string]interface{}{q.field: q.value}}
+	}
+	body := copyParams(q.params)
+	body["value"] = q.value
+	return map[string]interface{}{"term": map[string]interface{}{q.field: body}}
+}
+
+// Terms creates a TermsQuery.
+func Terms(field string, values ...interface{}) *TermsQuery {
+	return &TermsQuery{field: field, values: values, params: map[string]interface{}{}}
+}
+
+// Boost sets the relevance scores of the query.
+func (q *TermsQuery) Boost(boost float64) *TermsQuery {
+	q.params["boost"] = boost
+	return q
+}
+
+// Source returns a data structure that is serialized as the query DSL.
+func (q *TermsQuery) Source() map[string]interface{} {
+	body := copyParams(q.params)
+	values := q.values
+	if values == nil {
+		values = []interface{}{}
+	}
+	body[q.field] = values
+	return map[string]interface{}{"terms": body}
+}
+
+// Range creates a RangeQuery.
+func Range(field string) *RangeQuery {
+	return &RangeQuery{field: field, params: map[string]interface{}{}}
+}
+
+// Gt sets the lower bound that is excluded from the range.
+func (q *RangeQuery) Gt(value interface{}) *RangeQuery {
+	q.params["gt"] = value
+	return q
+}
+
+// Gte sets the lower bound that is included in the range.
+func (q *RangeQuery) Gte(value interface{}) *RangeQuery {
+	q.params["gte"] = value
+	return q
+}
+
+// Lt sets the upper bound that is excluded from the range.
+func (q *RangeQuery) Lt(value interface{}) *RangeQuery {
+	q.params["lt"] = value
+	return q
+}
+
+// Lte sets the upper bound that is included in the range.
+func (q *RangeQuery) Lte(value interface{}) *RangeQuery {
+	q.params["lte"] = value
+	return q
+}
+
+// Format sets the date format used to convert date values in the query.
+func (q *RangeQuery) Format(format string) *RangeQuery {
+	q.params["format"] = format
+	return q
+}
+
+// TimeZone sets the time zone used to convert date values in the query to UTC.
+func (q *RangeQuery) TimeZone(tz string) *RangeQuery {
+	q.params["time_zone"] = tz
+	return q
+}
+
+// Boost sets the relevance scores of the query.
+func (q *RangeQuery) Boost(boost float64) *RangeQuery {
+	q.params["boost"] = boost
+	return q
+}
+
+// Source returns a data structure that is serialized as the query DSL.
+func (q *RangeQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"range": map[string]interface{}{q.field: copyParams(q.params)}}
+}
+
+// Exists creates an ExistsQuery.
+func Exists(field string) *ExistsQuery {
+	return &ExistsQuery{field: field}
+}
+
+// Source returns a data structure that is serialized as the query DSL.
+func (q *ExistsQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"exists": map[string]interface{}{"field": q.field}}
+}
+
+// IDs creates an IDsQuery.
+func IDs(ids ...string) *IDsQuery {
+	return &IDsQuery{ids: ids}
+}
+
+// Source returns a data structure that is serialized as the query DSL.
+func (q *IDsQuery) Source() map[string]interface{} {
+	ids := q.ids
+	if ids == nil {
+		ids = []string{}
+	}
+	return map[string]interface{}{"ids": map[string]interface{}{"values": ids}}
+}
+
+// Prefix creates a PrefixQuery.
+func Prefix(field string, value string) *PrefixQuery {
+	return &PrefixQuery{field: field, params: map[string]interface{}{"value": value}}
+}
+
+// Rewrite sets the method used to rewrite the query.
+func (q *PrefixQuery) Rewrite(rewrite string) *PrefixQuery {
+	q.params["rewrite"] = rewrite
+	return q
+}
+
+// Boost sets the relevance scores of the query.
+func (q *PrefixQuery) Boost(boost float64) *PrefixQuery {
+	q.params["boost"] = boost
+	return q
+}
+
+// Source returns a data structure that is serialized as the query DSL.
+func (q *PrefixQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"prefix": map[string]interface{}{q.field: copyParams(q.params)}}
+}
+
+// Wildcard creates a WildcardQuery.
+func Wildcard(field string, value string) *WildcardQuery {
+	return &WildcardQuery{field: field, params: map[string]interface{}{"value": value}}
+}
+
+// Rewrite sets the method used to rewrite the query.
+func (q *WildcardQuery) Rewrite(rewrite string) *WildcardQuery {
+	q.params["rewrite"] = rewrite
+	return q
+}
+
+// Boost sets the relevance scores of the query.
+func (q *WildcardQuery) Boost(boost float64) *WildcardQuery {
+	q.params["boost"] = boost
+	return q
+}
+
+// Source returns a data structure that is serialized as the query DSL.
+func (q *WildcardQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"wildcard": map[string]interface{}{q.field: copyParams(q.params)}}
+}
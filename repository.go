@@ -0,0 +1,104 @@
+package elsearm
+
+import (
+	"context"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/soranoba/elsearm/query"
+)
+
+// Repository provides typed functions to save/load the model in Elasticsearch.
+// T is a struct type of the model, and *T is handled as the model by Indexer.
+// The model can implement the interfaces that customize the behavior as well as Indexer. (e.g. CustomIndexNameModel)
+type Repository[T any] struct {
+	indexer *Indexer
+}
+
+// NewRepository creates a Repository.
+func NewRepository[T any](indexer *Indexer) *Repository[T] {
+	return &Repository[T]{indexer: indexer}
+}
+
+// Indexer returns the Indexer that the Repository uses.
+func (r *Repository[T]) Indexer() *Indexer {
+	return r.indexer
+}
+
+// Get returns the model of the DocumentID.
+// If T is not a struct type, it returns ErrInvalidModel.
+func (r *Repository[T]) Get(ctx context.Context, id string, reqFuncs ...func(*esapi.GetRequest)) (*T, error) {
+	model := new(T)
+	if err := r.indexer.config().assertModel(model); err != nil {
+		return nil, err
+	}
+	if err := r.indexer.WithContext(ctx).get(model, id, reqFuncs...); err != nil {
+		return nil, err
+	}
+	if err := SetDocumentID(model, id); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// Save updates (or creates) the document of the model.
+func (r *Repository[T]) Save(ctx context.Context, model *T, reqFuncs ...func(*esapi.IndexRequest)) error {
+	return r.indexer.WithContext(ctx).Update(model, reqFuncs...)
+}
+
+// Delete deletes the document of the model.
+func (r *Repository[T]) Delete(ctx context.Context, model *T, reqFuncs ...func(*esapi.DeleteRequest)) error {
+	return r.indexer.WithContext(ctx).Delete(model, reqFuncs...)
+}
+
+// Search returns the models that match the query. If the query is nil, it returns all models.
+func (r *Repository[T]) Search(ctx context.Context, q query.Query, reqFuncs ...func(*esapi.SearchRequest)) ([]T, *SearchResult, error) {
+	if q != nil {
+		reqFuncs = append([]func(*esapi.SearchRequest){query.Search(q)}, reqFuncs...)
+	}
+
+	var models []T
+	result, err := r.indexer.WithContext(ctx).Search(&models, reqFuncs...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return models, result, nil
+}
+
+// Count returns the number of models that match the query. If the query is nil, it returns the number of all models.
+func (r *Repository[T]) Count(ctx context.Context, q query.Query, reqFuncs ...func(*esapi.CountRequest)) (int, error) {
+	if q != nil {
+		reqFuncs = append([]func(*esapi.CountRequest){query.Count(q)}, reqFuncs...)
+	}
+	return r.indexer.WithContext(ctx).Count(new(T), reqFuncs...)
+}
+
+// MGet returns the models of the DocumentIDs in the same order.
+// If the document of the DocumentID is not found, the model is nil. If T is not a struct type, it returns ErrInvalidModel.
+func (r *Repository[T]) MGet(ctx context.Context, ids []string, reqFuncs ...func(*esapi.MgetRequest)) ([]*T, error) {
+	if err := r.indexer.config().assertModel(new(T)); err != nil {
+		return nil, err
+	}
+
+	models := make([]*T, len(ids))
+	targets := make([]interface{}, len(ids))
+	docs := make([]mgetDoc, len(ids))
+	for i, id := range ids {
+		models[i] = new(T)
+		targets[i] = models[i]
+		docs[i] = mgetDoc{Index: r.indexer.IndexName(models[i]), ID: id}
+	}
+
+	items, err := r.indexer.WithContext(ctx).mget(targets, docs, reqFuncs...)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		if item.Err != nil {
+			return nil, item.Err
+		}
+		if !item.Found {
+			models[i] = nil
+		}
+	}
+	return models, nil
+}
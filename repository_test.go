@@ -0,0 +1,101 @@
+package elsearm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soranoba/elsearm/query"
+)
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository[User](indexer)
+
+	_ = indexer.DeleteIndex(&User{})
+	if err := indexer.CreateIndex(&User{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, name := range []string{"Alice", "Bob", "Carol"} {
+		if err := repo.Save(ctx, &User{ID: uint(i + 1), Name: name}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	user, err := repo.Get(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 1 || user.Name != "Alice" {
+		t.Errorf("invalid result: got %#v", user)
+	}
+
+	users, err := repo.MGet(ctx, []string{"3", "4", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 || users[0].Name != "Carol" || users[1] != nil || users[2].Name != "Bob" {
+		t.Errorf("invalid result: got %#v", users)
+	}
+
+	// NOTE: default refresh interval.
+	time.Sleep(1 * time.Second)
+
+	found, result, err := repo.Search(ctx, query.Term("id", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Name != "Bob" || result.Total != 1 {
+		t.Errorf("invalid result: got %#v", found)
+	}
+
+	count, err := repo.Count(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("invalid count: gots %d, wants %d", count, 3)
+	}
+
+	if err := repo.Delete(ctx, user); err != nil {
+		t.Error(err)
+	}
+	if _, err := repo.Get(ctx, "1"); err == nil {
+		t.Errorf("Get should fail but succeeded")
+	}
+}
+
+func TestRepository_automaticId(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository[Organization](indexer)
+
+	if err := indexer.CreateIndexIfNotExist(&Organization{}); err != nil {
+		t.Fatal(err)
+	}
+	org := &Organization{Name: "Doodle"}
+	if err := indexer.CreateWithoutID(org); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := repo.Get(ctx, *org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID == nil || *found.ID != *org.ID || found.Name != "Doodle" {
+		t.Errorf("invalid result: got %#v", found)
+	}
+}
+
+func TestRepository_invalidModel(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository[string](indexer)
+
+	if _, err := repo.Get(ctx, "1"); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if _, err := repo.MGet(ctx, []string{"1"}); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
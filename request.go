@@ -2,6 +2,10 @@ package elsearm
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/elastic/go-elasticsearch/v7/esapi"
 )
@@ -16,3 +20,51 @@ func Zero() *int {
 	var zero int = 0
 	return &zero
 }
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// rawRequest is a Request of the API which esapi does not support.
+type rawRequest struct {
+	// A name of the API. It is the same as the name of esapi (e.g. OpenPointInTime).
+	Name   string
+	Method string
+	Path   string
+	Params map[string]string
+	Body   io.Reader
+}
+
+// Do executes the request.
+func (r *rawRequest) Do(ctx context.Context, transport esapi.Transport) (*esapi.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, r.Method, r.Path, r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.Params) > 0 {
+		q := req.URL.Query()
+		for k, v := range r.Params {
+			q.Set(k, v)
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+	if r.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := transport.Perform(req)
+	if err != nil {
+		return nil, err
+	}
+	return &esapi.Response{
+		StatusCode: res.StatusCode,
+		Body:       res.Body,
+		Header:     res.Header,
+	}, nil
+}
+
+// timeUnit returns the duration in the format of time units of Elasticsearch.
+func timeUnit(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+}
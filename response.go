@@ -3,8 +3,9 @@ package elsearm
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"net/http"
 	"reflect"
+	"strings"
 )
 
 // ErrorResponse is an error response format of Elasticsearch.
@@ -22,12 +23,77 @@ type ErrorResponse struct {
 			Reason string `json:"reason"`
 		} `json:"caused_by"`
 	} `json:"error"`
+	// It is true if the response of the document API says that the document is not found. (e.g. {"found": false})
+	documentNotFound bool
+}
+
+func newErrorResponse(statusCode int, body []byte) *ErrorResponse {
+	var errRes ErrorResponse
+	if err := json.Unmarshal(body, &errRes); err != nil {
+		// Some errors have the reason as a string, and some responses are not JSON. (e.g. from a proxy)
+		var strErrRes struct {
+			Status uint   `json:"status"`
+			Err    string `json:"error"`
+		}
+		errRes = ErrorResponse{}
+		if err := json.Unmarshal(body, &strErrRes); err == nil {
+			errRes.Status = strErrRes.Status
+			errRes.Err.Reason = strErrRes.Err
+		} else {
+			errRes.Err.Reason = strings.TrimSpace(string(body))
+		}
+	}
+
+	// NOTE: the 404 responses of get and delete have no error, but they have the result of the document.
+	var docRes struct {
+		Found  *bool  `json:"found"`
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal(body, &docRes); err == nil {
+		errRes.documentNotFound = (docRes.Found != nil && !*docRes.Found) || docRes.Result == "not_found"
+	}
+
+	if errRes.Status == 0 {
+		errRes.Status = uint(statusCode)
+	}
+	if errRes.Err.Reason == "" {
+		errRes.Err.Reason = http.StatusText(int(errRes.Status))
+	}
+	return &errRes
 }
 
 func (err *ErrorResponse) Error() string {
 	return err.Err.Reason
 }
 
+// Is reports whether the error matches the target.
+// It can be used with ErrDocumentNotFound, ErrIndexNotFound, ErrIndexAlreadyExists, ErrVersionConflict,
+// ErrTooManyRequests and ErrMappingConflict.
+func (err *ErrorResponse) Is(target error) bool {
+	switch target {
+	case ErrDocumentNotFound:
+		return err.Status == http.StatusNotFound &&
+			(err.documentNotFound || err.Err.Type == "document_missing_exception")
+	case ErrIndexNotFound:
+		return err.Err.Type == "index_not_found_exception"
+	case ErrIndexAlreadyExists:
+		return err.Err.Type == "resource_already_exists_exception" ||
+			err.Err.Type == "index_already_exists_exception"
+	case ErrVersionConflict:
+		return err.Status == http.StatusConflict ||
+			err.Err.Type == "version_conflict_engine_exception"
+	case ErrTooManyRequests:
+		return err.Status == http.StatusTooManyRequests ||
+			err.Err.Type == "es_rejected_execution_exception"
+	case ErrMappingConflict:
+		return err.Err.Type == "mapper_parsing_exception" ||
+			err.Err.Type == "strict_dynamic_mapping_exception" ||
+			(err.Err.Type == "illegal_argument_exception" && strings.Contains(err.Err.Reason, "mapper"))
+	default:
+		return false
+	}
+}
+
 // SearchResponse is an response format of search API.
 // ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-search.html
 type SearchResponse struct {
@@ -38,14 +104,23 @@ type SearchResponse struct {
 			Relation string `json:"relation"`
 		} `json:"total"`
 		Hits []struct {
-			ID     string          `json:"_id"`
-			Source json.RawMessage `json:"_source"`
+			ID          string          `json:"_id"`
+			Source      json.RawMessage `json:"_source"`
+			SeqNo       *int64          `json:"_seq_no"`
+			PrimaryTerm *int64          `json:"_primary_term"`
+			Version     *int64          `json:"_version"`
 		} `json:"hits"`
 	} `json:"hits"`
+	Aggregations Aggregations `json:"aggregations"`
 }
 
-//  SetResult copies the hit result to models.
+// SetResult copies the hit result to models.
 func (res *SearchResponse) SetResult(models interface{}) error {
+	return res.setResult(models, getGlobalConfig())
+}
+
+// setResult copies the hit result to models. The errors of invalid models are handled with the config.
+func (res *SearchResponse) setResult(models interface{}, cfg *Config) error {
 	if res == nil {
 		return nil
 	}
@@ -57,7 +132,7 @@ func (res *SearchResponse) SetResult(models interface{}) error {
 
 	v = reflect.Indirect(v)
 	if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
-		panic(fmt.Sprintf("invalid model: %#v", models))
+		return cfg.fail(invalidModelError(models))
 	}
 
 	if v.Kind() == reflect.Slice {
@@ -69,6 +144,9 @@ func (res *SearchResponse) SetResult(models interface{}) error {
 			var aModel interface{}
 
 			vv := v.Index(i)
+			if vv.Kind() == reflect.Interface && !vv.IsNil() {
+				vv = vv.Elem()
+			}
 			if vv.Kind() == reflect.Ptr {
 				if vv.Type().Elem().Kind() == reflect.Struct {
 					if vv.IsNil() {
@@ -81,7 +159,7 @@ func (res *SearchResponse) SetResult(models interface{}) error {
 			}
 
 			if aModel == nil {
-				panic(fmt.Sprintf("invalid model: %#v", models))
+				return cfg.fail(invalidModelError(models))
 			}
 
 			if err := ParseDocument(aModel, bytes.NewReader(hit.Source)); err != nil {
@@ -90,6 +168,7 @@ func (res *SearchResponse) SetResult(models interface{}) error {
 			if err := SetDocumentID(aModel, hit.ID); err != nil {
 				return err
 			}
+			SetDocumentVersion(aModel, newDocumentVersion(hit.SeqNo, hit.PrimaryTerm, hit.Version))
 		} else {
 			break
 		}
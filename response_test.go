@@ -2,6 +2,7 @@ package elsearm
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
 )
 
@@ -32,3 +33,66 @@ func TestErrorResponse(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestErrorResponse_Is(t *testing.T) {
+	cases := []struct {
+		name       string
+		statusCode int
+		body       string
+		wants      error
+	}{
+		{"get not found", 404, `{"_index":"user","_type":"_doc","_id":"1","found":false}`, ErrDocumentNotFound},
+		{"delete not found", 404, `{"_index":"user","_id":"1","result":"not_found"}`, ErrDocumentNotFound},
+		{"head not found", 404, ``, nil},
+		{"not found (proxy)", 404, `<html>Not Found</html>`, nil},
+		{"update not found", 404, `{"error":{"type":"document_missing_exception","reason":"[_doc][1]: document missing"},"status":404}`, ErrDocumentNotFound},
+		{"index not found", 404, `{"error":{"type":"index_not_found_exception","reason":"no such index [user]"},"status":404}`, ErrIndexNotFound},
+		{"index already exists", 400, `{"error":{"type":"resource_already_exists_exception","reason":"index [user/xxx] already exists"},"status":400}`, ErrIndexAlreadyExists},
+		{"version conflict", 409, `{"error":{"type":"version_conflict_engine_exception","reason":"[1]: version conflict"},"status":409}`, ErrVersionConflict},
+		{"too many requests", 429, `{"error":{"type":"es_rejected_execution_exception","reason":"rejected execution"},"status":429}`, ErrTooManyRequests},
+		{"too many requests (proxy)", 429, `Too Many Requests`, ErrTooManyRequests},
+		{"mapping conflict", 400, `{"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [id]"},"status":400}`, ErrMappingConflict},
+		{"mapping conflict (update mappings)", 400, `{"error":{"type":"illegal_argument_exception","reason":"mapper [name] cannot be changed from type [text] to [long]"},"status":400}`, ErrMappingConflict},
+	}
+
+	allErrors := []error{
+		ErrDocumentNotFound, ErrIndexNotFound, ErrIndexAlreadyExists,
+		ErrVersionConflict, ErrTooManyRequests, ErrMappingConflict,
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := error(newErrorResponse(c.statusCode, []byte(c.body)))
+			for _, target := range allErrors {
+				if errors.Is(err, target) != (target == c.wants) {
+					t.Errorf("errors.Is(%v, %v) should be %v", err, target, target == c.wants)
+				}
+			}
+
+			var errRes *ErrorResponse
+			if !errors.As(err, &errRes) || errRes.Status != uint(c.statusCode) {
+				t.Errorf("invalid error: got %#v", err)
+			}
+			if err.Error() == "" {
+				t.Errorf("error message is empty")
+			}
+		})
+	}
+}
+
+func TestErrorResponse_nonJSON(t *testing.T) {
+	err := newErrorResponse(502, []byte("<html>Bad Gateway</html>\n"))
+	if err.Status != 502 || err.Error() != "<html>Bad Gateway</html>" {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	err = newErrorResponse(405, []byte(`{"error":"Incorrect HTTP method for uri [/user]","status":405}`))
+	if err.Status != 405 || err.Error() != "Incorrect HTTP method for uri [/user]" {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	err = newErrorResponse(404, nil)
+	if err.Status != 404 || err.Error() != "Not Found" {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package elsearm
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+)
+
+const (
+	// DefaultRetryMaxAttempts is a maximum number of attempts when it is not set.
+	DefaultRetryMaxAttempts = 3
+	// DefaultRetryInitialBackoff is a backoff before the first retry when it is not set.
+	DefaultRetryInitialBackoff = 100 * time.Millisecond
+	// DefaultRetryMaxBackoff is an upper limit of the backoff when it is not set.
+	DefaultRetryMaxBackoff = 5 * time.Second
+)
+
+// DefaultRetryableStatuses is the status codes to retry when RetryableStatuses is not set.
+var DefaultRetryableStatuses = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// RetryPolicy is a policy to retry the requests of Indexer and the items of BulkIndexer.
+// The requests are retried when the response has a retryable status or the transport returns an error (e.g. connection reset).
+//
+// The backoff doubles on each retry up to MaxBackoff, and the actual wait is randomized between half and all of it.
+// It does not retry when the context is done or its deadline is exceeded before the next attempt.
+//
+// The transport of elasticsearch.Client also retries 502, 503 and 504 by default.
+// Set DisableRetry of elasticsearch.Config to avoid retrying twice.
+type RetryPolicy struct {
+	// A maximum number of attempts including the first one. If it is zero, DefaultRetryMaxAttempts is used.
+	MaxAttempts int
+	// A backoff before the first retry. If it is zero, DefaultRetryInitialBackoff is used.
+	InitialBackoff time.Duration
+	// An upper limit of the backoff. If it is zero, DefaultRetryMaxBackoff is used.
+	MaxBackoff time.Duration
+	// The status codes to retry. If it is nil, DefaultRetryableStatuses is used.
+	RetryableStatuses []int
+	// A function to veto the retry. It is called before each retry, and the retry is canceled if it returns false.
+	// Either res or err is nil. attempt is the number of the attempts that have failed.
+	ShouldRetry func(req *http.Request, res *http.Response, err error, attempt int) bool
+	// If it is true, the requests which are not idempotent are also retried.
+	// (e.g. CreateWithoutID, UpdateWithScript, the index requests with op_type=create, by-query requests, reindex and the tasks such as ForceMergeAsync)
+	// The document may be created or changed twice if the first request reached Elasticsearch.
+	RetryNonIdempotent bool
+}
+
+// WithRetryPolicy specifies a policy to retry the requests and returns a new Indexer.
+func (indexer *Indexer) WithRetryPolicy(policy RetryPolicy) *Indexer {
+	newIndexer := *indexer
+	newIndexer.retry = &policy
+	return &newIndexer
+}
+
+func (policy *RetryPolicy) canRetry(req Request) bool {
+	return policy.RetryNonIdempotent || isIdempotent(req)
+}
+
+// nonIdempotentRequest is a Request that may change the document again when it is sent twice. (e.g. the script update)
+type nonIdempotentRequest struct {
+	Request
+}
+
+// isIdempotent returns true if the request has the same result when it is sent twice.
+func isIdempotent(req Request) bool {
+	switch r := req.(type) {
+	case *nonIdempotentRequest:
+		return false
+	case *wrappedRequest:
+		return isIdempotent(r.Request)
+	case *esapi.IndexRequest:
+		// NOTE: the index request without the document id creates a new document on each attempt,
+		// and the create request fails with the conflict when the document has been created by the previous attempt.
+		return r.DocumentID != "" && r.OpType != "create"
+	case *esapi.DeleteByQueryRequest, *esapi.UpdateByQueryRequest, *esapi.ReindexRequest:
+		// NOTE: the documents may be changed twice, or the task may be started twice.
+		return false
+	case *rawRequest:
+		// NOTE: the APIs which esapi does not support are not known to be idempotent. (e.g. a point in time is opened twice)
+		return false
+	}
+	return true
+}
+
+// isIdempotentItem returns true if the item of BulkIndexer has the same result when it is written twice.
+func isIdempotentItem(item esutil.BulkIndexerItem) bool {
+	switch item.Action {
+	case "index":
+		// NOTE: the item without the document id creates a new document on each attempt.
+		return item.DocumentID != ""
+	case "create":
+		// NOTE: the item fails with the conflict when the document has been created by the previous attempt.
+		return false
+	}
+	return true
+}
+
+// canRetryItem returns true if the item of BulkIndexer can be added again.
+// err is not nil if the whole bulk request failed, and status is zero if it has no response.
+func (policy *RetryPolicy) canRetryItem(idempotent bool, status int, err error) bool {
+	if status != 0 && !policy.isRetryableStatus(status) {
+		return false
+	}
+	// NOTE: the item rejected by Elasticsearch has not been written, but the bulk request that failed may have been executed.
+	return err == nil || status == http.StatusTooManyRequests || policy.RetryNonIdempotent || idempotent
+}
+
+func (policy *RetryPolicy) maxAttempts() int {
+	if policy.MaxAttempts > 0 {
+		return policy.MaxAttempts
+	}
+	return DefaultRetryMaxAttempts
+}
+
+func (policy *RetryPolicy) isRetryableStatus(status int) bool {
+	statuses := policy.RetryableStatuses
+	if statuses == nil {
+		statuses = DefaultRetryableStatuses
+	}
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns a wait before the retry after the attempt failed.
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	initial, max := policy.InitialBackoff, policy.MaxBackoff
+	if initial <= 0 {
+		initial = DefaultRetryInitialBackoff
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxBackoff
+	}
+
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryTransport is a esapi.Transport that retries the request with the policy.
+type retryTransport struct {
+	transport esapi.Transport
+	policy    *RetryPolicy
+}
+
+// Perform executes the request until it succeeds or the policy gives up.
+func (t *retryTransport) Perform(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		r := req.Clone(ctx)
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(body)), nil
+			}
+			r.ContentLength = int64(len(body))
+		}
+
+		res, err := t.transport.Perform(r)
+		if !t.shouldRetry(r, res, err, attempt) {
+			return res, err
+		}
+
+		wait := t.policy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return res, err
+		}
+		if res != nil {
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *retryTransport) shouldRetry(req *http.Request, res *http.Response, err error, attempt int) bool {
+	if attempt >= t.policy.maxAttempts() || req.Context().Err() != nil {
+		return false
+	}
+	if err == nil && !t.policy.isRetryableStatus(res.StatusCode) {
+		return false
+	}
+	if t.policy.ShouldRetry != nil {
+		return t.policy.ShouldRetry(req, res, err, attempt)
+	}
+	return true
+}
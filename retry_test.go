@@ -0,0 +1,531 @@
+package elsearm
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	elasticsearch "github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/soranoba/elsearm/query"
+)
+
+// stubTransport returns the responses in order, and repeats the last one.
+type stubTransport struct {
+	mu        sync.Mutex
+	responses []stubResponse
+	bodies    []string
+	headers   []http.Header
+}
+
+type stubResponse struct {
+	status int
+	body   string
+	err    error
+}
+
+func (t *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var body []byte
+	if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+	}
+	t.bodies = append(t.bodies, string(body))
+	t.headers = append(t.headers, req.Header.Clone())
+
+	res := t.responses[0]
+	if len(t.responses) > 1 {
+		t.responses = t.responses[1:]
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	return &http.Response{
+		StatusCode: res.status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}, "X-Elastic-Product": []string{"Elasticsearch"}},
+		Body:       ioutil.NopCloser(strings.NewReader(res.body)),
+	}, nil
+}
+
+func (t *stubTransport) attempts() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.bodies)
+}
+
+// newStubClient returns a client which sends the requests to a stubTransport.
+func newStubClient(t *testing.T, responses ...stubResponse) (*stubTransport, *elasticsearch.Client) {
+	t.Helper()
+	transport := &stubTransport{responses: responses}
+	client, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses:            []string{"http://elasticsearch.test"},
+		Transport:            transport,
+		DisableRetry:         true,
+		UseResponseCheckOnly: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transport, client
+}
+
+func newStubIndexer(t *testing.T, responses ...stubResponse) (*stubTransport, *Indexer) {
+	t.Helper()
+	transport, client := newStubClient(t, responses...)
+	return transport, NewIndexer(client)
+}
+
+var (
+	unavailable  = stubResponse{status: http.StatusServiceUnavailable, body: `{"error":{"type":"unavailable"},"status":503}`}
+	indexed      = stubResponse{status: http.StatusOK, body: `{"_id":"1","_seq_no":0,"_primary_term":1,"_version":1,"result":"created"}`}
+	bulkIndexed  = stubResponse{status: http.StatusOK, body: `{"errors":false,"items":[{"index":{"_id":"1","status":201,"_version":1}}]}`}
+	bulkRejected = stubResponse{status: http.StatusOK,
+		body: `{"errors":true,"items":[{"index":{"_id":"1","status":429,"error":{"type":"es_rejected_execution_exception","reason":"rejected"}}}]}`}
+	bulkMapperFailed = stubResponse{status: http.StatusOK,
+		body: `{"errors":true,"items":[{"index":{"_id":"1","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}]}`}
+)
+
+func TestIndexer_WithRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Millisecond}
+
+	t.Run("retryable status", func(t *testing.T) {
+		transport, indexer := newStubIndexer(t, unavailable, unavailable, indexed)
+		if err := indexer.WithRetryPolicy(policy).Update(&User{ID: 1, Name: "Alice"}); err != nil {
+			t.Fatal(err)
+		}
+		if transport.attempts() != 3 {
+			t.Errorf("invalid attempts: got %d", transport.attempts())
+		}
+		for _, body := range transport.bodies {
+			if body != `{"id":1,"name":"Alice"}` {
+				t.Errorf("invalid body: got %s", body)
+			}
+		}
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		transport, indexer := newStubIndexer(t, unavailable)
+		policy := policy
+		policy.MaxAttempts = 2
+		err := indexer.WithRetryPolicy(policy).Update(&User{ID: 1})
+		var errRes *ErrorResponse
+		if !errors.As(err, &errRes) || errRes.Status != http.StatusServiceUnavailable {
+			t.Errorf("invalid error: got %#v", err)
+		}
+		if transport.attempts() != 2 {
+			t.Errorf("invalid attempts: got %d", transport.attempts())
+		}
+	})
+
+	t.Run("not retryable status", func(t *testing.T) {
+		transport, indexer := newStubIndexer(t, stubResponse{status: http.StatusBadRequest, body: `{"error":{"type":"bad_request"},"status":400}`})
+		if err := indexer.WithRetryPolicy(policy).Update(&User{ID: 1}); err == nil {
+			t.Errorf("Update should fail but succeeded")
+		}
+		if transport.attempts() != 1 {
+			t.Errorf("invalid attempts: got %d", transport.attempts())
+		}
+	})
+
+	t.Run("retryable statuses", func(t *testing.T) {
+		transport, indexer := newStubIndexer(t, stubResponse{status: http.StatusConflict, body: `{"status":409}`}, indexed)
+		policy := policy
+		policy.RetryableStatuses = []int{http.StatusConflict}
+		if err := indexer.WithRetryPolicy(policy).Update(&User{ID: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if transport.attempts() != 2 {
+			t.Errorf("invalid attempts: got %d", transport.attempts())
+		}
+	})
+
+	t.Run("connection error", func(t *testing.T) {
+		transport, indexer := newStubIndexer(t, stubResponse{err: errors.New("connection reset by peer")}, indexed)
+		if err := indexer.WithRetryPolicy(policy).Update(&User{ID: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if transport.attempts() != 2 {
+			t.Errorf("invalid attempts: got %d", transport.attempts())
+		}
+	})
+
+	t.Run("veto", func(t *testing.T) {
+		transport, indexer := newStubIndexer(t, stubResponse{status: http.StatusTooManyRequests, body: `{"status":429}`}, indexed)
+		policy := policy
+		var vetoed []int
+		policy.ShouldRetry = func(req *http.Request, res *http.Response, err error, attempt int) bool {
+			vetoed = append(vetoed, res.StatusCode)
+			return false
+		}
+		if err := indexer.WithRetryPolicy(policy).Update(&User{ID: 1}); err == nil {
+			t.Errorf("Update should fail but succeeded")
+		}
+		if transport.attempts() != 1 || len(vetoed) != 1 || vetoed[0] != http.StatusTooManyRequests {
+			t.Errorf("invalid attempts: got %d, %v", transport.attempts(), vetoed)
+		}
+	})
+
+	t.Run("non idempotent", func(t *testing.T) {
+		transport, indexer := newStubIndexer(t, unavailable, indexed)
+		if err := indexer.WithRetryPolicy(policy).CreateWithoutID(&Organization{Name: "Doodle"}); err == nil {
+			t.Errorf("CreateWithoutID should fail but succeeded")
+		}
+		if transport.attempts() != 1 {
+			t.Errorf("invalid attempts: got %d", transport.attempts())
+		}
+
+		transport, indexer = newStubIndexer(t, unavailable, indexed)
+		policy := policy
+		policy.RetryNonIdempotent = true
+		org := &Organization{Name: "Doodle"}
+		if err := indexer.WithRetryPolicy(policy).CreateWithoutID(org); err != nil {
+			t.Fatal(err)
+		}
+		if transport.attempts() != 2 || org.ID == nil || *org.ID != "1" {
+			t.Errorf("invalid attempts: got %d, %#v", transport.attempts(), org)
+		}
+	})
+
+	t.Run("non idempotent requests", func(t *testing.T) {
+		script := Script{Source: "ctx._source.count++"}
+		requests := map[string]func(indexer *Indexer) error{
+			"UpdateWithScript": func(indexer *Indexer) error {
+				return indexer.UpdateWithScript(&User{ID: 1}, script)
+			},
+			"Update with op_type create": func(indexer *Indexer) error {
+				return indexer.Update(&User{ID: 1}, indexer.Q.Index.WithOpType("create"))
+			},
+			"DeleteByQueryAsync": func(indexer *Indexer) error {
+				_, err := indexer.DeleteByQueryAsync(&User{}, query.MatchAll())
+				return err
+			},
+			"UpdateByQueryAsync": func(indexer *Indexer) error {
+				_, err := indexer.UpdateByQueryAsync(&User{}, query.MatchAll(), &script)
+				return err
+			},
+			"ReindexAsync": func(indexer *Indexer) error {
+				_, err := indexer.ReindexAsync("src", "dest")
+				return err
+			},
+			"ForceMergeAsync": func(indexer *Indexer) error {
+				_, err := indexer.ForceMergeAsync(&User{}, 1)
+				return err
+			},
+		}
+		for name, request := range requests {
+			transport, indexer := newStubIndexer(t, unavailable)
+			if err := request(indexer.WithRetryPolicy(policy)); err == nil {
+				t.Errorf("%s should fail but succeeded", name)
+			}
+			if transport.attempts() != 1 {
+				t.Errorf("%s should not be retried: got %d attempts", name, transport.attempts())
+			}
+		}
+
+		transport, indexer := newStubIndexer(t, unavailable, stubResponse{status: http.StatusOK, body: `{"result":"updated"}`})
+		if err := indexer.WithRetryPolicy(policy).PartialUpdate(&User{ID: 1, Name: "Alice"}, []string{"name"}); err != nil {
+			t.Fatal(err)
+		}
+		if transport.attempts() != 2 {
+			t.Errorf("PartialUpdate should be retried: got %d attempts", transport.attempts())
+		}
+	})
+
+	t.Run("context deadline", func(t *testing.T) {
+		transport, indexer := newStubIndexer(t, unavailable)
+		policy := policy
+		policy.InitialBackoff = time.Minute
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		start := time.Now()
+		if err := indexer.WithContext(ctx).WithRetryPolicy(policy).Update(&User{ID: 1}); err == nil {
+			t.Errorf("Update should fail but succeeded")
+		}
+		if transport.attempts() != 1 || time.Since(start) > 500*time.Millisecond {
+			t.Errorf("invalid attempts: got %d in %s", transport.attempts(), time.Since(start))
+		}
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		transport, indexer := newStubIndexer(t, unavailable)
+		policy := policy
+		policy.InitialBackoff = time.Minute
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		if err := indexer.WithContext(ctx).WithRetryPolicy(policy).Update(&User{ID: 1}); !errors.Is(err, context.Canceled) {
+			t.Errorf("invalid error: got %#v", err)
+		}
+		if transport.attempts() != 1 {
+			t.Errorf("invalid attempts: got %d", transport.attempts())
+		}
+	})
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 10; i++ {
+			if d := policy.backoff(tt.attempt); d < tt.max/2 || d > tt.max {
+				t.Errorf("invalid backoff of attempt %d: got %s", tt.attempt, d)
+			}
+		}
+	}
+}
+
+// waitForAttempts waits until the transport receives n requests.
+func waitForAttempts(t *testing.T, transport *stubTransport, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); transport.attempts() < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("the transport received only %d requests", transport.attempts())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newRetryingBulkIndexers are the constructors of BulkIndexer which send the bulk requests to a stubTransport and flush them soon.
+var newRetryingBulkIndexers = map[string]func(client *elasticsearch.Client) (*BulkIndexer, error){
+	"NewBulkIndexer": func(client *elasticsearch.Client) (*BulkIndexer, error) {
+		bulk, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{NumWorkers: 1, Client: client, FlushInterval: 10 * time.Millisecond})
+		if err != nil {
+			return nil, err
+		}
+		return NewBulkIndexer(bulk), nil
+	},
+	"NewBulkIndexerFromConfig": func(client *elasticsearch.Client) (*BulkIndexer, error) {
+		return NewBulkIndexerFromConfig(esutil.BulkIndexerConfig{NumWorkers: 1, Client: client, FlushInterval: 10 * time.Millisecond})
+	},
+}
+
+// newRetryingBulkIndexer returns a BulkIndexer created by NewBulkIndexerFromConfig, which sends the bulk requests to a stubTransport and flushes them soon.
+func newRetryingBulkIndexer(t *testing.T, client *elasticsearch.Client) *BulkIndexer {
+	t.Helper()
+	bulk, err := newRetryingBulkIndexers["NewBulkIndexerFromConfig"](client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bulk
+}
+
+func TestBulkIndexer_WithRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+
+	cases := []struct {
+		name        string
+		responses   []stubResponse
+		wantsFailed int
+		wantsStatus int
+		// It is true if esutil.BulkIndexer can not pass the items to OnFailure.
+		requestFailure bool
+	}{
+		{"retried", []stubResponse{bulkRejected, bulkIndexed}, 0, 0, false},
+		{"exhausted", []stubResponse{bulkRejected}, 1, http.StatusTooManyRequests, false},
+		{"request retried", []stubResponse{unavailable, bulkIndexed}, 0, 0, true},
+		{"request exhausted", []stubResponse{unavailable}, 1, http.StatusServiceUnavailable, true},
+	}
+	for name, newBulkIndexer := range newRetryingBulkIndexers {
+		for _, c := range cases {
+			if c.requestFailure && name == "NewBulkIndexer" {
+				continue
+			}
+			t.Run(name+"/"+c.name, func(t *testing.T) {
+				transport, client := newStubClient(t, c.responses...)
+				bulk, err := newBulkIndexer(client)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var (
+					mu     sync.Mutex
+					failed []*BulkItemError
+				)
+				sink := NewMemoryDeadLetterSink()
+				bulk = bulk.WithRetryPolicy(policy).WithDeadLetterSink(sink).
+					WithFailureHandler(func(ctx context.Context, err *BulkItemError) {
+						mu.Lock()
+						defer mu.Unlock()
+						failed = append(failed, err)
+					})
+
+				wallet := &Wallet{ID: 1, Balance: 100}
+				if err := bulk.Update(wallet); err != nil {
+					t.Fatal(err)
+				}
+				waitForAttempts(t, transport, policy.MaxAttempts)
+				if err := bulk.Close(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+
+				if n := transport.attempts(); n != policy.MaxAttempts {
+					t.Errorf("invalid attempts: got %d", n)
+				}
+				if len(failed) != c.wantsFailed || len(sink.Letters()) != c.wantsFailed {
+					t.Fatalf("invalid failures: got %#v, %#v", failed, sink.Letters())
+				}
+				if c.wantsFailed > 0 {
+					var errRes *ErrorResponse
+					if !errors.As(failed[0], &errRes) || errRes.Status != uint(c.wantsStatus) || sink.Letters()[0].Status != c.wantsStatus {
+						t.Errorf("invalid failure: got %#v", failed[0].Err)
+					}
+				} else if wallet.Version != 1 {
+					t.Errorf("the result of the retry should be set: got %#v", wallet.DocumentVersion)
+				}
+			})
+		}
+	}
+}
+
+func TestBulkIndexer_WithRetryPolicy_nonIdempotent(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	requests := map[string]func(bulk *BulkIndexer) error{
+		"CreateWithoutID": func(bulk *BulkIndexer) error {
+			return bulk.CreateWithoutID(&User{Name: "Alice"})
+		},
+		"UpdateWithScript": func(bulk *BulkIndexer) error {
+			return bulk.UpdateWithScript(&User{ID: 1}, Script{Source: "ctx._source.count++"})
+		},
+	}
+	tooManyRequests := stubResponse{status: http.StatusTooManyRequests, body: `{"error":{"type":"es_rejected_execution_exception"},"status":429}`}
+	cases := []struct {
+		name         string
+		responses    []stubResponse
+		wantsRetried bool
+	}{
+		// NOTE: the items rejected by Elasticsearch have not been written, so they are retried.
+		{"item rejected", []stubResponse{bulkRejected, bulkIndexed}, true},
+		{"request rejected", []stubResponse{tooManyRequests, bulkIndexed}, true},
+		// NOTE: the bulk request may have been executed.
+		{"request failed", []stubResponse{unavailable, bulkIndexed}, false},
+	}
+	for name, request := range requests {
+		for _, c := range cases {
+			t.Run(name+"/"+c.name, func(t *testing.T) {
+				transport, client := newStubClient(t, c.responses...)
+				bulk := newRetryingBulkIndexer(t, client)
+				if err := request(bulk.WithRetryPolicy(policy)); err != nil {
+					t.Fatal(err)
+				}
+				waitForAttempts(t, transport, 1)
+				if c.wantsRetried {
+					waitForAttempts(t, transport, policy.MaxAttempts)
+				} else {
+					// NOTE: wait for the retry which should not be added after the backoff.
+					time.Sleep(50 * time.Millisecond)
+				}
+				if err := bulk.Close(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+
+				wants := 1
+				if c.wantsRetried {
+					wants = policy.MaxAttempts
+				}
+				if n := transport.attempts(); n != wants {
+					t.Errorf("invalid attempts: got %d, wants %d", n, wants)
+				}
+			})
+		}
+	}
+}
+
+func TestBulkIndexer_deleteNotFound(t *testing.T) {
+	notFound := stubResponse{status: http.StatusOK,
+		body: `{"errors":false,"items":[{"delete":{"_id":"1","status":404,"result":"not_found"}}]}`}
+	policies := map[string]*RetryPolicy{
+		"no policy": nil,
+		"policy":    {MaxAttempts: 2, InitialBackoff: time.Millisecond},
+	}
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			_, client := newStubClient(t, notFound)
+			bulk := newRetryingBulkIndexer(t, client)
+			if policy != nil {
+				bulk = bulk.WithRetryPolicy(*policy)
+			}
+
+			var (
+				mu     sync.Mutex
+				failed []*BulkItemError
+			)
+			bulk = bulk.WithFailureHandler(func(ctx context.Context, err *BulkItemError) {
+				mu.Lock()
+				defer mu.Unlock()
+				failed = append(failed, err)
+			})
+			if err := bulk.Delete(&User{ID: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if err := bulk.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if policy == nil {
+				if len(failed) != 1 || !errors.Is(failed[0], ErrDocumentNotFound) {
+					t.Errorf("the item should fail with ErrDocumentNotFound: got %#v", failed)
+				}
+			} else if len(failed) != 0 {
+				t.Errorf("the item should be regarded as succeeded: got %#v", failed)
+			}
+		})
+	}
+}
+
+func TestBulkIndexer_WithRetryPolicy_close(t *testing.T) {
+	policies := map[string]*RetryPolicy{
+		"no policy":     nil,
+		"after backoff": {MaxAttempts: 2, InitialBackoff: time.Hour},
+	}
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			transport, client := newStubClient(t, bulkRejected, bulkIndexed)
+			bulk := newRetryingBulkIndexer(t, client)
+			if policy != nil {
+				bulk = bulk.WithRetryPolicy(*policy)
+			}
+
+			var (
+				mu     sync.Mutex
+				failed []*BulkItemError
+			)
+			bulk = bulk.WithFailureHandler(func(ctx context.Context, err *BulkItemError) {
+				mu.Lock()
+				defer mu.Unlock()
+				failed = append(failed, err)
+			})
+			if err := bulk.Update(&Wallet{ID: 1, Balance: 100}); err != nil {
+				t.Fatal(err)
+			}
+			waitForAttempts(t, transport, 1)
+			if err := bulk.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if n := transport.attempts(); n != 1 {
+				t.Errorf("invalid attempts: got %d", n)
+			}
+			if len(failed) != 1 || !errors.Is(failed[0], ErrTooManyRequests) {
+				t.Errorf("invalid failures: got %#v", failed)
+			}
+		})
+	}
+}
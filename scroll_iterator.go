@@ -0,0 +1,164 @@
+package elsearm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// ScrollIterator iterates the pages of the search results with the scroll API.
+// Each page is set to the models which is passed to ScrollIterator.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/paginate-search-results.html#scroll-search-results
+type ScrollIterator struct {
+	indexer   *Indexer
+	models    reflect.Value
+	keepAlive time.Duration
+	reqFuncs  []func(*esapi.SearchRequest)
+
+	mu       sync.Mutex
+	scrollID string
+	result   *SearchResult
+	err      error
+	closed   bool
+	done     chan struct{}
+}
+
+// ScrollIterator returns an iterator of the pages of the search. models must be a pointer to a slice of the model.
+// The scroll context is renewed with keepAlive on each page. If keepAlive is zero, DefaultIteratorKeepAlive is used.
+// The scroll context is cleared on Close, at the end of the iteration or when the context of the Indexer is canceled.
+func (indexer *Indexer) ScrollIterator(models interface{}, keepAlive time.Duration, reqFuncs ...func(*esapi.SearchRequest)) (*ScrollIterator, error) {
+	v := reflect.ValueOf(models)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return nil, indexer.config().fail(invalidModelError(models))
+	}
+	t := v.Elem().Type().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, indexer.config().fail(invalidModelError(models))
+	}
+
+	if keepAlive == 0 {
+		keepAlive = DefaultIteratorKeepAlive
+	}
+
+	it := &ScrollIterator{
+		indexer:   indexer,
+		models:    v,
+		keepAlive: keepAlive,
+		reqFuncs:  reqFuncs,
+		done:      make(chan struct{}),
+	}
+	if ctxDone := indexer.ctx.Done(); ctxDone != nil {
+		go func() {
+			select {
+			case <-ctxDone:
+				it.mu.Lock()
+				defer it.mu.Unlock()
+				if it.err == nil && !it.closed {
+					it.err = indexer.ctx.Err()
+				}
+				_ = it.close()
+			case <-it.done:
+			}
+		}()
+	}
+	return it, nil
+}
+
+// Next fetches the next page and sets it to the models.
+// It returns false when the page is empty or an error occurred.
+func (it *ScrollIterator) Next() bool {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	if it.err != nil || it.closed {
+		return false
+	}
+
+	var (
+		result *SearchResult
+		err    error
+	)
+	if it.scrollID == "" {
+		reqFuncs := append(it.reqFuncs[:len(it.reqFuncs):len(it.reqFuncs)], func(req *esapi.SearchRequest) {
+			req.Scroll = it.keepAlive
+		})
+		result, err = it.indexer.Search(it.models.Interface(), reqFuncs...)
+	} else {
+		result, err = it.indexer.Scroll(it.models.Interface(), func(req *esapi.ScrollRequest) {
+			req.ScrollID = it.scrollID
+			req.Scroll = it.keepAlive
+		})
+	}
+	if err != nil {
+		it.err = err
+		_ = it.close()
+		return false
+	}
+
+	it.result = result
+	if result.ScrollID != "" {
+		it.scrollID = result.ScrollID
+	}
+	if it.models.Elem().Len() == 0 {
+		it.err = it.close()
+		return false
+	}
+	return true
+}
+
+// Result returns the metadata of the current page.
+func (it *ScrollIterator) Result() *SearchResult {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.result
+}
+
+// Err returns the error that occurred during the iteration.
+func (it *ScrollIterator) Err() error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.err
+}
+
+// Close clears the scroll context. It can be called multiple times.
+func (it *ScrollIterator) Close() error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.close()
+}
+
+func (it *ScrollIterator) close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	close(it.done)
+
+	if it.scrollID == "" {
+		return nil
+	}
+	b, err := json.Marshal(map[string]interface{}{"scroll_id": []string{it.scrollID}})
+	if err != nil {
+		return err
+	}
+	clearReq := &esapi.ClearScrollRequest{Body: bytes.NewReader(b)}
+	// NOTE: the scroll context should be cleared even if the context is canceled.
+	err = it.indexer.WithContext(context.Background()).Do(clearReq)
+
+	// NOTE: the scroll context has already expired.
+	var errRes *ErrorResponse
+	if errors.As(err, &errRes) && errRes.Status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
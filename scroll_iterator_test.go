@@ -0,0 +1,98 @@
+package elsearm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIndexerScrollIterator(t *testing.T) {
+	_ = indexer.DeleteIndex(&User{})
+	if err := indexer.CreateIndex(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"Alice", "Bob", "Carol"} {
+		if err := indexer.Update(&User{ID: uint(i + 1), Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// NOTE: default refresh interval.
+	time.Sleep(1 * time.Second)
+
+	var users []*User
+	it, err := indexer.ScrollIterator(&users, time.Minute, indexer.Q.Search.WithSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	var names []string
+	for it.Next() {
+		for _, user := range users {
+			names = append(names, user.Name)
+		}
+		if it.Result().Total != 3 {
+			t.Errorf("invalid total: gots %d, wants %d", it.Result().Total, 3)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 || names[0] != "Alice" || names[1] != "Bob" || names[2] != "Carol" {
+		t.Errorf("invalid result: got %v", names)
+	}
+
+	// the scroll context is cleared.
+	if _, err := indexer.Scroll(&users, indexer.Q.Scroll.WithScrollID(it.Result().ScrollID)); err == nil {
+		t.Errorf("Scroll should fail but succeeded")
+	}
+}
+
+func TestIndexerScrollIterator_cancel(t *testing.T) {
+	_ = indexer.DeleteIndex(&User{})
+	if err := indexer.CreateIndex(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"Alice", "Bob"} {
+		if err := indexer.Update(&User{ID: uint(i + 1), Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// NOTE: default refresh interval.
+	time.Sleep(1 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var users []User
+	it, err := indexer.WithContext(ctx).ScrollIterator(&users, 0, indexer.Q.Search.WithSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next() {
+		t.Fatal(it.Err())
+	}
+	scrollID := it.Result().ScrollID
+
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := indexer.Scroll(&users, indexer.Q.Scroll.WithScrollID(scrollID)); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the scroll context is not cleared")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if it.Next() || it.Err() != context.Canceled {
+		t.Errorf("invalid error: got %v", it.Err())
+	}
+}
+
+func TestIndexerScrollIterator_invalidModel(t *testing.T) {
+	var user User
+	if _, err := indexer.ScrollIterator(&user, 0); err == nil {
+		t.Errorf("ScrollIterator should fail but succeeded")
+	}
+}
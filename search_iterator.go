@@ -0,0 +1,247 @@
+package elsearm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/soranoba/elsearm/query"
+)
+
+const (
+	// DefaultIteratorPageSize is a number of documents per page when the size of the search source is not set.
+	DefaultIteratorPageSize = 1000
+	// DefaultIteratorKeepAlive is a keep alive of the search context when it is not set.
+	DefaultIteratorKeepAlive = 1 * time.Minute
+)
+
+// SearchIteratorOptions is options of SearchIterator.
+type SearchIteratorOptions struct {
+	// A search source that has the query and the sort. If it is nil, all documents are iterated.
+	// The size of the source is used as the page size. If it is not set, DefaultIteratorPageSize is used.
+	Source *query.SearchSource
+	// A keep alive of the point-in-time. If it is zero, DefaultIteratorKeepAlive is used.
+	KeepAlive time.Duration
+}
+
+// SearchIterator iterates the documents of the search with search_after and point-in-time.
+// Unlike from/size, it can iterate more than 10,000 documents, and the results are consistent during the iteration.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/paginate-search-results.html#search-after
+type SearchIterator struct {
+	indexer     *Indexer
+	modelType   reflect.Type
+	body        map[string]interface{}
+	size        int
+	keepAlive   time.Duration
+	pitID       string
+	searchAfter json.RawMessage
+	hits        []searchHit
+	lastPage    bool
+	model       interface{}
+	err         error
+}
+
+type searchHit struct {
+	ID     string          `json:"_id"`
+	Source json.RawMessage `json:"_source"`
+	Sort   json.RawMessage `json:"sort"`
+	documentMeta
+}
+
+// SearchIterator opens a point-in-time on the search index of the model, and returns an iterator of the documents.
+// The caller should call Close when finished. It is called automatically when all documents are iterated.
+func (indexer *Indexer) SearchIterator(model interface{}, opts SearchIteratorOptions) (*SearchIterator, error) {
+	if err := indexer.config().assertModel(model); err != nil {
+		return nil, err
+	}
+
+	source := opts.Source
+	if source == nil {
+		source = query.NewSearchSource()
+	}
+	body := source.Source()
+	delete(body, "from")
+	delete(body, "aggs")
+	if _, ok := body["track_total_hits"]; !ok {
+		body["track_total_hits"] = false
+	}
+	if _, ok := model.(VersionedModel); ok {
+		body["seq_no_primary_term"] = true
+		body["version"] = true
+	}
+
+	size := DefaultIteratorPageSize
+	if s, ok := body["size"].(int); ok && s > 0 {
+		size = s
+	}
+	body["size"] = size
+
+	// NOTE: _shard_doc is a tiebreaker that makes the order stable.
+	sort, _ := body["sort"].([]interface{})
+	sort = append([]interface{}{}, sort...)
+	if !hasSortField(sort, "_shard_doc") {
+		sort = append(sort, map[string]interface{}{"_shard_doc": "asc"})
+	}
+	body["sort"] = sort
+
+	keepAlive := opts.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = DefaultIteratorKeepAlive
+	}
+
+	rawIndexNames := indexer.SearchIndexName(model)
+	indexNames := make([]string, len(rawIndexNames))
+	for i, indexName := range rawIndexNames {
+		indexNames[i] = url.QueryEscape(indexName)
+	}
+
+	openReq := &rawRequest{
+		Name:   "OpenPointInTime",
+		Method: http.MethodPost,
+		Path:   "/" + strings.Join(indexNames, ",") + "/_pit",
+		Params: map[string]string{"keep_alive": timeUnit(keepAlive)},
+	}
+	var res struct {
+		ID string `json:"id"`
+	}
+	if err := indexer.Do(openReq, &res); err != nil {
+		return nil, err
+	}
+
+	return &SearchIterator{
+		indexer:   indexer,
+		modelType: reflect.TypeOf(model).Elem(),
+		body:      body,
+		size:      size,
+		keepAlive: keepAlive,
+		pitID:     res.ID,
+	}, nil
+}
+
+// Next advances the iterator to the next model. It returns false when all documents are iterated or an error occurred.
+func (it *SearchIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.hits) == 0 && !it.lastPage && it.pitID != "" {
+		if err := it.fetch(); err != nil {
+			it.err = err
+			_ = it.Close()
+			return false
+		}
+	}
+	if len(it.hits) == 0 {
+		it.model = nil
+		it.err = it.Close()
+		return false
+	}
+
+	hit := it.hits[0]
+	it.hits = it.hits[1:]
+
+	model := reflect.New(it.modelType).Interface()
+	if err := ParseDocument(model, bytes.NewReader(hit.Source)); err != nil {
+		it.err = err
+		_ = it.Close()
+		return false
+	}
+	if err := SetDocumentID(model, hit.ID); err != nil {
+		it.err = err
+		_ = it.Close()
+		return false
+	}
+	hit.setTo(model)
+	it.model = model
+	return true
+}
+
+// Model returns the current model. It is a pointer to the same type as the model passed to SearchIterator.
+func (it *SearchIterator) Model() interface{} {
+	return it.model
+}
+
+// Err returns the error that occurred during the iteration.
+func (it *SearchIterator) Err() error {
+	return it.err
+}
+
+// Close closes the point-in-time. It can be called multiple times.
+func (it *SearchIterator) Close() error {
+	if it.pitID == "" {
+		return nil
+	}
+	pitID := it.pitID
+	it.pitID = ""
+	it.hits = nil
+
+	b, err := json.Marshal(map[string]interface{}{"id": pitID})
+	if err != nil {
+		return err
+	}
+	closeReq := &rawRequest{
+		Name:   "ClosePointInTime",
+		Method: http.MethodDelete,
+		Path:   "/_pit",
+		Body:   bytes.NewReader(b),
+	}
+	// NOTE: the point-in-time should be closed even if the context is canceled.
+	return it.indexer.WithContext(context.Background()).Do(closeReq)
+}
+
+func (it *SearchIterator) fetch() error {
+	body := make(map[string]interface{}, len(it.body)+2)
+	for k, v := range it.body {
+		body[k] = v
+	}
+	body["pit"] = map[string]interface{}{"id": it.pitID, "keep_alive": timeUnit(it.keepAlive)}
+	if it.searchAfter != nil {
+		body["search_after"] = it.searchAfter
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		PitID string `json:"pit_id"`
+		Hits  struct {
+			Hits []searchHit `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := it.indexer.Do(&esapi.SearchRequest{Body: bytes.NewReader(b)}, &res); err != nil {
+		return err
+	}
+
+	if res.PitID != "" {
+		it.pitID = res.PitID
+	}
+	it.hits = res.Hits.Hits
+	it.lastPage = len(it.hits) < it.size
+	if len(it.hits) > 0 {
+		it.searchAfter = it.hits[len(it.hits)-1].Sort
+	}
+	return nil
+}
+
+func hasSortField(sort []interface{}, field string) bool {
+	for _, s := range sort {
+		switch s := s.(type) {
+		case string:
+			if s == field {
+				return true
+			}
+		case map[string]interface{}:
+			if _, ok := s[field]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package elsearm
+
+import (
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/soranoba/elsearm/query"
+)
+
+func TestIndexerSearchIterator(t *testing.T) {
+	_ = indexer.DeleteIndex(&User{})
+	if err := indexer.CreateIndex(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"Alice", "Bob", "Carol", "Dave", "Ellen"} {
+		if err := indexer.Update(&User{ID: uint(i + 1), Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := indexer.Do(&esapi.IndicesRefreshRequest{Index: []string{"user"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	it, err := indexer.SearchIterator(&User{}, SearchIteratorOptions{
+		Source: query.NewSearchSource().
+			Query(query.Bool().MustNot(query.Term("id", 3))).
+			Sort("id", "desc").
+			Size(2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	var names []string
+	for it.Next() {
+		user, ok := it.Model().(*User)
+		if !ok {
+			t.Fatalf("invalid model: got %#v", it.Model())
+		}
+		names = append(names, user.Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 4 || names[0] != "Ellen" || names[1] != "Dave" || names[2] != "Bob" || names[3] != "Alice" {
+		t.Errorf("invalid result: got %v", names)
+	}
+	if it.Next() {
+		t.Errorf("Next should return false after the iteration")
+	}
+	if err := it.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIndexerSearchIterator_automaticId(t *testing.T) {
+	_ = indexer.DeleteIndex(&Organization{})
+	if err := indexer.CreateIndex(&Organization{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.CreateWithoutID(&Organization{Name: "Doodle"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Do(&esapi.IndicesRefreshRequest{Index: []string{"organization"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	it, err := indexer.SearchIterator(&Organization{}, SearchIteratorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	if !it.Next() {
+		t.Fatalf("Next should return true: %v", it.Err())
+	}
+	org := it.Model().(*Organization)
+	if org.ID == nil || org.Name != "Doodle" {
+		t.Errorf("invalid result: got %#v", org)
+	}
+	if it.Next() || it.Err() != nil {
+		t.Errorf("invalid iteration: %v", it.Err())
+	}
+}
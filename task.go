@@ -0,0 +1,242 @@
+package elsearm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// DefaultTaskPollInterval is a default interval of Task.Wait.
+const DefaultTaskPollInterval = time.Second
+
+// taskActions are the APIs of the actions of the tasks, which are used to rethrottle.
+var taskActions = map[string]string{
+	"indices:data/write/delete/byquery": "_delete_by_query",
+	"indices:data/write/update/byquery": "_update_by_query",
+	"indices:data/write/reindex":        "_reindex",
+}
+
+// Task is a handle of the task which runs in the background of Elasticsearch.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/tasks.html
+type Task struct {
+	// An id of the task. (e.g. `oTUltX4IQMOUUVeiohTt8A:12345`)
+	ID string
+
+	indexer *Indexer
+	// action is the name of the API that started the task, which is used to rethrottle. (e.g. _delete_by_query)
+	action string
+}
+
+// TaskStatus is a status of the task.
+type TaskStatus struct {
+	// An action of the task. (e.g. `indices:data/write/reindex`)
+	Action string
+	// A description of the task.
+	Description string
+	// A time since the task started.
+	RunningTime time.Duration
+	// It is true if the task has been completed, including canceled and failed.
+	Completed bool
+	// A progress of the task. It is the final result if the task has been completed.
+	Progress TaskProgress
+	// An error of the task if it has failed.
+	Err error
+}
+
+// TaskProgress is a progress of the task of reindex, delete by query and update by query.
+// It is empty for the other tasks. (e.g. force merge)
+type TaskProgress struct {
+	Total            int           `json:"total"`
+	Created          int           `json:"created"`
+	Updated          int           `json:"updated"`
+	Deleted          int           `json:"deleted"`
+	Noops            int           `json:"noops"`
+	Batches          int           `json:"batches"`
+	VersionConflicts int           `json:"version_conflicts"`
+	Failures         []TaskFailure `json:"failures"`
+	// A reason of the cancellation if the task has been canceled. (e.g. `by user request`)
+	Canceled string `json:"canceled"`
+	// A throttle of the task. -1 means that the task is not throttled.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+}
+
+// TaskFailure is a failure of the document in the task.
+type TaskFailure struct {
+	Index  string `json:"index"`
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Cause  struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"cause"`
+}
+
+// TaskFailedError is an error of Task.Wait when the task has been completed with the failures of the documents.
+type TaskFailedError struct {
+	// The failures of the task. It is not empty when it is returned by Task.Wait.
+	Failures []TaskFailure
+}
+
+func (err *TaskFailedError) Error() string {
+	if len(err.Failures) == 0 {
+		return ErrTaskFailed.Error()
+	}
+	return fmt.Sprintf("%s: %d documents failed: %s", ErrTaskFailed, len(err.Failures), err.Failures[0].Cause.Reason)
+}
+
+// Is returns true if the target is ErrTaskFailed.
+func (err *TaskFailedError) Is(target error) bool {
+	return target == ErrTaskFailed
+}
+
+// Unwrap returns the first failure as *ErrorResponse. It can be used with errors.Is. (e.g. ErrVersionConflict)
+// It returns nil if the error has no failures.
+func (err *TaskFailedError) Unwrap() error {
+	if len(err.Failures) == 0 {
+		return nil
+	}
+	failure := err.Failures[0]
+	errRes := &ErrorResponse{Status: uint(failure.Status)}
+	errRes.Err.Type = failure.Cause.Type
+	errRes.Err.Reason = failure.Cause.Reason
+	return errRes
+}
+
+// Task returns a handle of the task of the id. It can be used to follow the task started by others.
+func (indexer *Indexer) Task(id string) *Task {
+	return indexer.newTask(id, "")
+}
+
+func (indexer *Indexer) newTask(id string, action string) *Task {
+	return &Task{ID: id, indexer: indexer, action: action}
+}
+
+// Status returns the current status of the task.
+func (task *Task) Status() (*TaskStatus, error) {
+	var res struct {
+		Completed bool `json:"completed"`
+		Task      struct {
+			Action           string       `json:"action"`
+			Description      string       `json:"description"`
+			RunningTimeNanos int64        `json:"running_time_in_nanos"`
+			Status           TaskProgress `json:"status"`
+		} `json:"task"`
+		Response *TaskProgress   `json:"response"`
+		Error    json.RawMessage `json:"error"`
+	}
+	if err := task.indexer.Do(&esapi.TasksGetRequest{TaskID: task.ID}, &res); err != nil {
+		return nil, err
+	}
+
+	status := &TaskStatus{
+		Action:      res.Task.Action,
+		Description: res.Task.Description,
+		RunningTime: time.Duration(res.Task.RunningTimeNanos),
+		Completed:   res.Completed,
+		Progress:    res.Task.Status,
+	}
+	if res.Response != nil {
+		status.Progress = *res.Response
+	}
+	if len(res.Error) > 0 {
+		b, err := json.Marshal(map[string]json.RawMessage{"error": res.Error})
+		if err != nil {
+			return nil, err
+		}
+		status.Err = newErrorResponse(http.StatusInternalServerError, b)
+	}
+	return status, nil
+}
+
+// Wait polls the status of the task with the interval until the task is completed, and returns the final status.
+// If pollInterval is zero, DefaultTaskPollInterval is used.
+// It returns an error if the task has failed or been canceled, or the context is done.
+// If some documents of the task have failed, it returns *TaskFailedError with the final status.
+// The task keeps running even if the context is done.
+func (task *Task) Wait(ctx context.Context, pollInterval time.Duration) (*TaskStatus, error) {
+	if pollInterval <= 0 {
+		pollInterval = DefaultTaskPollInterval
+	}
+	scoped := &Task{ID: task.ID, indexer: task.indexer.WithContext(ctx), action: task.action}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		status, err := scoped.Status()
+		if err != nil {
+			return nil, err
+		}
+		if status.Completed {
+			if status.Err != nil {
+				return status, status.Err
+			}
+			if status.Progress.Canceled != "" {
+				return status, fmt.Errorf("%w: %s", ErrTaskCanceled, status.Progress.Canceled)
+			}
+			if failures := status.Progress.Failures; len(failures) > 0 {
+				return status, &TaskFailedError{Failures: failures}
+			}
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cancel cancels the task. If the task has already been completed, it does nothing.
+func (task *Task) Cancel() error {
+	return task.indexer.doTaskRequest(&esapi.TasksCancelRequest{TaskID: task.ID})
+}
+
+// Rethrottle changes the throttle of the running task. -1 means that the task is not throttled.
+func (task *Task) Rethrottle(requestsPerSecond int) error {
+	action := task.action
+	if action == "" {
+		status, err := task.Status()
+		if err != nil {
+			return err
+		}
+		action = taskActions[status.Action]
+	}
+
+	var req Request
+	switch action {
+	case "_delete_by_query":
+		req = &esapi.DeleteByQueryRethrottleRequest{TaskID: task.ID, RequestsPerSecond: &requestsPerSecond}
+	case "_update_by_query":
+		req = &esapi.UpdateByQueryRethrottleRequest{TaskID: task.ID, RequestsPerSecond: &requestsPerSecond}
+	case "_reindex":
+		req = &esapi.ReindexRethrottleRequest{TaskID: task.ID, RequestsPerSecond: &requestsPerSecond}
+	default:
+		return fmt.Errorf("the task can not be rethrottled: %s", task.ID)
+	}
+	return task.indexer.doTaskRequest(req)
+}
+
+// doTaskRequest executes the request of the task management APIs, which reports the errors as node_failures.
+func (indexer *Indexer) doTaskRequest(req Request) error {
+	var res struct {
+		NodeFailures []struct {
+			CausedBy json.RawMessage `json:"caused_by"`
+		} `json:"node_failures"`
+	}
+	if err := indexer.Do(req, &res); err != nil {
+		return err
+	}
+	if len(res.NodeFailures) > 0 {
+		b, err := json.Marshal(map[string]json.RawMessage{"error": res.NodeFailures[0].CausedBy})
+		if err != nil {
+			return err
+		}
+		return newErrorResponse(http.StatusInternalServerError, b)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package elsearm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/soranoba/elsearm/query"
+)
+
+func TestTaskWait(t *testing.T) {
+	indexer := indexer.WithConfig(Config{Refresh: "true"})
+	seedUsers(t, indexer, "Alice", "Bob", "Carol")
+	_ = indexer.DeleteIndex(&Team{})
+
+	task, err := indexer.ReindexAsync("user", "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := task.Wait(context.Background(), 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Completed || status.Action != "indices:data/write/reindex" {
+		t.Errorf("invalid status: got %#v", status)
+	}
+	if p := status.Progress; p.Total != 3 || p.Created != 3 || p.Batches != 1 || len(p.Failures) != 0 {
+		t.Errorf("invalid progress: got %#v", p)
+	}
+
+	task, err = indexer.ForceMergeAsync(&Team{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := task.Wait(context.Background(), 100*time.Millisecond); err != nil {
+		t.Error(err)
+	}
+	_ = indexer.DeleteIndex(&Team{})
+}
+
+func TestTaskWait_failures(t *testing.T) {
+	indexer := indexer.WithConfig(Config{Refresh: "true"})
+	seedUsers(t, indexer, "Alice", "Bob")
+	_ = indexer.DeleteIndex(&Team{})
+	defer indexer.DeleteIndex(&Team{})
+
+	task, err := indexer.ReindexAsync("user", "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := task.Wait(context.Background(), 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: the documents already exist in the dest index, so the reindex fails with the version conflicts.
+	task, err = indexer.ReindexAsync("user", "team", func(req *esapi.ReindexRequest) {
+		req.Body = strings.NewReader(`{"source":{"index":"user"},"dest":{"index":"team","op_type":"create"}}`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := task.Wait(context.Background(), 100*time.Millisecond)
+	if !errors.Is(err, ErrTaskFailed) || !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("invalid error: got %#v", err)
+	}
+	var failedErr *TaskFailedError
+	if !errors.As(err, &failedErr) || len(failedErr.Failures) == 0 || failedErr.Failures[0].Status != 409 {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if status == nil || !status.Completed || status.Progress.VersionConflicts == 0 {
+		t.Errorf("invalid status: got %#v", status)
+	}
+}
+
+func TestTaskFailedError_noFailures(t *testing.T) {
+	err := &TaskFailedError{}
+	if err.Error() != ErrTaskFailed.Error() || err.Unwrap() != nil || !errors.Is(err, ErrTaskFailed) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
+
+func TestTaskWait_suspended(t *testing.T) {
+	if testCluster == nil {
+		t.Skip("the task can not be kept running in Elasticsearch")
+	}
+	indexer := indexer.WithConfig(Config{Refresh: "true"})
+	seedUsers(t, indexer, "Alice", "Bob")
+
+	testCluster.SuspendTasks()
+	defer testCluster.ResumeTasks()
+
+	started, err := indexer.DeleteByQueryAsync(&User{}, query.MatchAll())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := started.Wait(ctx, 10*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+
+	// NOTE: the handle from the id finds the API to rethrottle from the status.
+	task := indexer.Task(started.ID)
+	if err := task.Rethrottle(5); err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	status, err := started.Wait(context.Background(), 10*time.Millisecond)
+	if !errors.Is(err, ErrTaskCanceled) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if status == nil || status.Progress.RequestsPerSecond != 5 || status.Progress.Deleted != 0 {
+		t.Errorf("invalid status: got %#v", status)
+	}
+}
@@ -0,0 +1,304 @@
+package elsearm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+)
+
+// Script is a script to update the document.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/modules-scripting-using.html
+type Script struct {
+	// A source of the script. For example, `ctx._source.count += params.count`
+	Source string `json:"source"`
+	// A language of the script. If it is empty, painless is used.
+	Lang string `json:"lang,omitempty"`
+	// Parameters that are passed to the script as `params`.
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// PartialDocument returns the document body of the model which has only the fields.
+// The fields are names of the JSON. If no fields are specified, it returns all fields.
+// If the field is not in the document body (e.g. omitempty), it is set to null.
+// If the field is not a JSON field of the model, it returns ErrUnknownField.
+func PartialDocument(model interface{}, fields ...string) (map[string]interface{}, error) {
+	reader, err := DocumentBody(model)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.NewDecoder(reader).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	partial := make(map[string]interface{}, len(doc))
+	if len(fields) == 0 {
+		for k, v := range doc {
+			partial[k] = v
+		}
+		return partial, nil
+	}
+	var names map[string]bool
+	for _, field := range fields {
+		if v, ok := doc[field]; ok {
+			partial[field] = v
+			continue
+		}
+		if names == nil {
+			names = jsonFieldNames(reflectValue(model).Type(), map[reflect.Type]bool{})
+		}
+		if !names[field] {
+			return nil, fmt.Errorf("%w: %s is not a field of %T", ErrUnknownField, field, model)
+		}
+		partial[field] = nil
+	}
+	return partial, nil
+}
+
+// jsonFieldNames returns the names of the JSON fields of the struct type.
+func jsonFieldNames(t reflect.Type, visited map[reflect.Type]bool) map[string]bool {
+	names := map[string]bool{}
+	if t.Kind() != reflect.Struct || visited[t] {
+		return names
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := jsonFieldName(f)
+		if !ok {
+			continue
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		// Embedded structs are flattened the same as encoding/json.
+		if f.Anonymous && ft.Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			for embedded := range jsonFieldNames(ft, visited) {
+				names[embedded] = true
+			}
+			continue
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// PartialUpdate updates only the fields of the document with the update API.
+// The fields are names of the JSON. If the fields are empty, all fields of the model are merged into the document.
+// If the document does not exist, it returns ErrDocumentNotFound.
+// If the model implements VersionedModel and has the version, it fails with ErrVersionConflict
+// when the document has been changed since the model was read.
+// If the model has an external version, it returns ErrExternalVersionUnsupported, since the update API does not support it.
+// ref: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-update.html
+func (indexer *Indexer) PartialUpdate(model interface{}, fields []string, reqFuncs ...func(*esapi.UpdateRequest)) error {
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
+
+	body, err := partialUpdateBody(model, fields, false)
+	if err != nil {
+		return err
+	}
+	return indexer.update(model, body, reqFuncs)
+}
+
+// Upsert updates only the fields of the document in the same way as PartialUpdate.
+// If the document does not exist, it creates the document which has the fields. (doc_as_upsert)
+func (indexer *Indexer) Upsert(model interface{}, fields []string, reqFuncs ...func(*esapi.UpdateRequest)) error {
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
+
+	body, err := partialUpdateBody(model, fields, true)
+	if err != nil {
+		return err
+	}
+	return indexer.update(model, body, reqFuncs)
+}
+
+// UpdateWithScript updates the document of the model with the script.
+// If the document does not exist, it returns ErrDocumentNotFound.
+// The version of the model is checked in the same way as PartialUpdate.
+func (indexer *Indexer) UpdateWithScript(model interface{}, script Script, reqFuncs ...func(*esapi.UpdateRequest)) error {
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
+
+	body, err := scriptUpdateBody(script)
+	if err != nil {
+		return err
+	}
+	updateReq, err := indexer.updateRequest(model, body, reqFuncs)
+	if err != nil {
+		return err
+	}
+	// NOTE: the script may change the document again when the request is retried. (e.g. ctx._source.count++)
+	return indexer.doUpdate(model, &nonIdempotentRequest{Request: updateReq})
+}
+
+func (indexer *Indexer) update(model interface{}, body io.Reader, reqFuncs []func(*esapi.UpdateRequest)) error {
+	updateReq, err := indexer.updateRequest(model, body, reqFuncs)
+	if err != nil {
+		return err
+	}
+	return indexer.doUpdate(model, updateReq)
+}
+
+// doUpdate sends the update request, and sets the version of the updated document to the model.
+func (indexer *Indexer) doUpdate(model interface{}, req Request) error {
+	var meta documentMeta
+	if err := indexer.Do(req, &meta); err != nil {
+		return err
+	}
+	meta.setTo(model)
+	return nil
+}
+
+func (indexer *Indexer) updateRequest(model interface{}, body io.Reader, reqFuncs []func(*esapi.UpdateRequest)) (*esapi.UpdateRequest, error) {
+	if err := assertNoExternalVersion(model); err != nil {
+		return nil, err
+	}
+
+	documentId, err := DocumentID(model)
+	if err != nil {
+		return nil, err
+	}
+
+	updateReq := &esapi.UpdateRequest{
+		Index:      url.QueryEscape(indexer.IndexName(model)),
+		DocumentID: documentId,
+		Body:       body,
+		Refresh:    indexer.config().Refresh,
+	}
+	updateReq.IfSeqNo, updateReq.IfPrimaryTerm = concurrencyControl(model)
+	for _, f := range reqFuncs {
+		f(updateReq)
+	}
+	return updateReq, nil
+}
+
+// assertNoExternalVersion returns ErrExternalVersionUnsupported if the model has an external version,
+// because the update API rejects version_type=external and the model must not be written without the version.
+func assertNoExternalVersion(model interface{}) error {
+	_, hasVersion, err := ExternalVersion(model)
+	if err != nil {
+		return err
+	}
+	if hasVersion {
+		return fmt.Errorf("%w: %T", ErrExternalVersionUnsupported, model)
+	}
+	return nil
+}
+
+// PartialUpdate updates only the fields of the document with the bulk update action.
+// Returns an error if the addition to the bulk indexer fails.
+// The version of VersionedModel is not checked, since the bulk items can not have if_seq_no and if_primary_term.
+// If the model has an external version, it returns ErrExternalVersionUnsupported in the same way as Indexer.PartialUpdate.
+func (indexer *BulkIndexer) PartialUpdate(model interface{}, fields []string) error {
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
+
+	body, err := partialUpdateBody(model, fields, false)
+	if err != nil {
+		return err
+	}
+	return indexer.update(model, body)
+}
+
+// Upsert updates only the fields of the document, or creates the document which has the fields.
+// Returns an error if the addition to the bulk indexer fails.
+// The versions of the model are handled in the same way as PartialUpdate.
+func (indexer *BulkIndexer) Upsert(model interface{}, fields []string) error {
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
+
+	body, err := partialUpdateBody(model, fields, true)
+	if err != nil {
+		return err
+	}
+	return indexer.update(model, body)
+}
+
+// UpdateWithScript updates the document of the model with the script.
+// Returns an error if the addition to the bulk indexer fails.
+// The versions of the model are handled in the same way as PartialUpdate.
+func (indexer *BulkIndexer) UpdateWithScript(model interface{}, script Script) error {
+	if err := indexer.config().assertModel(model); err != nil {
+		return err
+	}
+
+	body, err := scriptUpdateBody(script)
+	if err != nil {
+		return err
+	}
+	item, err := indexer.updateItem(model, body)
+	if err != nil {
+		return err
+	}
+	// NOTE: the script may change the document again when the item is retried. (e.g. ctx._source.count++)
+	return indexer.addItem(model, item, false)
+}
+
+func (indexer *BulkIndexer) update(model interface{}, body io.Reader) error {
+	item, err := indexer.updateItem(model, body)
+	if err != nil {
+		return err
+	}
+	return indexer.add(model, item)
+}
+
+func (indexer *BulkIndexer) updateItem(model interface{}, body io.Reader) (esutil.BulkIndexerItem, error) {
+	if err := assertNoExternalVersion(model); err != nil {
+		return esutil.BulkIndexerItem{}, err
+	}
+
+	documentId, err := DocumentID(model)
+	if err != nil {
+		return esutil.BulkIndexerItem{}, err
+	}
+
+	return esutil.BulkIndexerItem{
+		Index:      indexer.IndexName(model),
+		DocumentID: documentId,
+		Action:     "update",
+		Body:       body,
+	}, nil
+}
+
+func partialUpdateBody(model interface{}, fields []string, docAsUpsert bool) (io.Reader, error) {
+	doc, err := PartialDocument(model, fields...)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{"doc": doc}
+	if docAsUpsert {
+		body["doc_as_upsert"] = true
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+func scriptUpdateBody(script Script) (io.Reader, error) {
+	b, err := json.Marshal(map[string]interface{}{"script": script})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
@@ -0,0 +1,161 @@
+package elsearm
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPartialDocument(t *testing.T) {
+	type Profile struct {
+		Name string `json:"name"`
+		Age  int    `json:"age,omitempty"`
+	}
+	type Member struct {
+		Profile
+		ID uint `json:"id"`
+	}
+
+	doc, err := PartialDocument(&Member{ID: 1, Profile: Profile{Name: "Alice"}}, "name", "age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"age":null,"name":"Alice"}` {
+		t.Errorf("invalid document: got %s", b)
+	}
+
+	if _, err := PartialDocument(&User{ID: 1, Name: "Alice"}, "name", "nmae"); !errors.Is(err, ErrUnknownField) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
+
+func TestIndexerPartialUpdate(t *testing.T) {
+	_ = indexer.DeleteIndex(&User{})
+	if err := indexer.CreateIndex(&User{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := indexer.PartialUpdate(&User{ID: 1, Name: "Alice"}, []string{"name"}); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := indexer.Upsert(&User{ID: 1, Name: "Alice"}, []string{"name"}, indexer.Q.Update.WithRefresh("true")); err != nil {
+		t.Fatal(err)
+	}
+	user := &User{ID: 1}
+	if err := indexer.Get(user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Alice" {
+		t.Errorf("invalid result: got %#v", user)
+	}
+
+	if err := indexer.PartialUpdate(&User{ID: 1, Name: "Bob"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	user = &User{ID: 1}
+	if err := indexer.Get(user); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 1 || user.Name != "Bob" {
+		t.Errorf("invalid result: got %#v", user)
+	}
+}
+
+func TestIndexerPartialUpdate_versions(t *testing.T) {
+	if err := indexer.CreateIndexIfNotExist(&Wallet{}); err != nil {
+		t.Fatal(err)
+	}
+	wallet := &Wallet{ID: 1, Balance: 100}
+	if err := indexer.Update(wallet); err != nil {
+		t.Fatal(err)
+	}
+	stale := &Wallet{DocumentVersion: wallet.DocumentVersion, ID: 1, Balance: 200}
+	wallet.Balance = 150
+	if err := indexer.PartialUpdate(wallet, []string{"balance"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.PartialUpdate(stale, []string{"balance"}); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	wallet.Balance = 300
+	if err := indexer.PartialUpdate(wallet, []string{"balance"}); err != nil {
+		t.Errorf("the version of the update should be set: got %v", err)
+	}
+
+	row := &Row{ID: 1, Name: "Alice", UpdatedAt: time.Now()}
+	if err := indexer.Upsert(row, []string{"name"}); !errors.Is(err, ErrExternalVersionUnsupported) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+	if err := bulkIndexer.PartialUpdate(row, []string{"name"}); !errors.Is(err, ErrExternalVersionUnsupported) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
+
+func TestIndexerUpdateWithScript(t *testing.T) {
+	if err := indexer.CreateIndexIfNotExist(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Update(&User{ID: 1, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	script := Script{
+		Source: "ctx._source.name += params.suffix",
+		Params: map[string]interface{}{"suffix": "!"},
+	}
+	if err := indexer.UpdateWithScript(&User{ID: 1}, script); err != nil {
+		t.Fatal(err)
+	}
+	user := &User{ID: 1}
+	if err := indexer.Get(user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Alice!" {
+		t.Errorf("invalid result: got %#v", user)
+	}
+
+	if err := indexer.UpdateWithScript(&User{ID: 2}, script); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("invalid error: got %#v", err)
+	}
+}
+
+func TestBulkIndexerPartialUpdate(t *testing.T) {
+	if err := indexer.CreateIndexIfNotExist(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Update(&User{ID: 1, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = indexer.Delete(&User{ID: 2})
+
+	if err := bulkIndexer.PartialUpdate(&User{ID: 1, Name: "Bob"}, []string{"name"}); err != nil {
+		t.Error(err)
+	}
+	if err := bulkIndexer.Upsert(&User{ID: 2, Name: "Carol"}, nil); err != nil {
+		t.Error(err)
+	}
+	if err := bulkIndexer.UpdateWithScript(&User{ID: 2}, Script{Source: "ctx._source.id += 1"}); err != nil {
+		t.Error(err)
+	}
+	waitForBulkFlush()
+
+	user := &User{ID: 1}
+	if err := indexer.Get(user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Bob" {
+		t.Errorf("invalid result: got %#v", user)
+	}
+	user = &User{ID: 2}
+	if err := indexer.Get(user); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 3 || user.Name != "Carol" {
+		t.Errorf("invalid result: got %#v", user)
+	}
+}